@@ -0,0 +1,358 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var annotationMutex sync.Mutex
+
+func getAnnotationSource() (source AnnotationSource, err error) {
+	annotationMutex.Lock()
+	defer annotationMutex.Unlock()
+	if session.Annotation.Backend != nil {
+		source = session.Annotation.Backend
+		return
+	}
+	switch session.Annotation.Source {
+	case "", "ensembl":
+		source = ensemblSource{}
+	case "gtf":
+		source = newGtfSource(map[string]string{
+			"37": session.Annotation.Gtf37,
+			"38": session.Annotation.Gtf38,
+		})
+	default:
+		err = errors.New(fmt.Sprintf("%s is not a valid annotation source (ensembl, gtf)", session.Annotation.Source))
+		return
+	}
+	source = newFeatureCache(source)
+	session.Annotation.Backend = source
+	return
+}
+
+// featureCache remembers the features of a run so that every region is only
+// resolved once per build, e.g. when extracting several analyses
+type featureCache struct {
+	AnnotationSource
+	features map[string]Feature
+	mutex    sync.Mutex
+}
+
+func newFeatureCache(source AnnotationSource) *featureCache {
+	return &featureCache{AnnotationSource: source, features: make(map[string]Feature)}
+}
+
+func getFeatureKey(build string, id string, expand bool) string {
+	return fmt.Sprintf("%s:%s:%t", build, id, expand)
+}
+
+func (f *featureCache) getFeature(ctx context.Context, build string, id string, expand bool) (feature Feature, err error) {
+	key := getFeatureKey(build, id, expand)
+	f.mutex.Lock()
+	feature, found := f.features[key]
+	f.mutex.Unlock()
+	if found {
+		return
+	}
+	if feature, err = f.AnnotationSource.getFeature(ctx, build, id, expand); err != nil {
+		return
+	}
+	f.mutex.Lock()
+	f.features[key] = feature
+	f.mutex.Unlock()
+	return
+}
+
+func (f *featureCache) lookupFeatures(ctx context.Context, build string, ids []string, expand bool) (features map[string]Feature, err error) {
+	features = make(map[string]Feature)
+	var missing []string
+	f.mutex.Lock()
+	for _, id := range ids {
+		if feature, found := f.features[getFeatureKey(build, id, expand)]; found {
+			features[id] = feature
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	f.mutex.Unlock()
+	if len(missing) == 0 {
+		return
+	}
+	found, err := f.AnnotationSource.lookupFeatures(ctx, build, missing, expand)
+	if err != nil {
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for id, feature := range found {
+		f.features[getFeatureKey(build, id, expand)] = feature
+		features[id] = feature
+	}
+	return
+}
+
+// getLiveRelease returns the annotation release answering lookups for a build
+// and compares it to the pinned release once per run
+func getLiveRelease(ctx context.Context, build string) (release string, err error) {
+	source, err := getAnnotationSource()
+	if err != nil {
+		return
+	}
+	strict := false
+	switch session.Annotation.ReleaseCheck {
+	case "", "warn":
+	case "strict":
+		strict = session.Annotation.Release != ""
+	default:
+		err = errors.New(fmt.Sprintf("%s is not a valid release check (warn, strict)", session.Annotation.ReleaseCheck))
+		return
+	}
+	annotationMutex.Lock()
+	release, checked := session.Annotation.liveReleases[build]
+	annotationMutex.Unlock()
+	if checked {
+		return
+	}
+	if release, err = source.getRelease(ctx, build); err != nil {
+		if strict {
+			release = ""
+			err = errors.Wrap(err, fmt.Sprintf("Could not verify that GRCh%s annotation is release %s", build, session.Annotation.Release))
+			return
+		}
+		log.Printf("Could not determine the GRCh%s annotation release: %v", build, err)
+		err = nil
+	} else if pinned := session.Annotation.Release; pinned != "" && release != pinned {
+		message := fmt.Sprintf("GRCh%s annotation is release %s but release %s is pinned", build, release, pinned)
+		if strict {
+			release = ""
+			err = errors.New(message)
+			return
+		}
+		log.Printf("Warning: %s", message)
+	}
+	annotationMutex.Lock()
+	if session.Annotation.liveReleases == nil {
+		session.Annotation.liveReleases = make(map[string]string)
+	}
+	session.Annotation.liveReleases[build] = release
+	annotationMutex.Unlock()
+	return
+}
+
+func (f Feature) setOnRow(row *DbTableRow, build string, release string) {
+	f.Region.Release = release
+	row.Coordinates[build] = f.Region
+	row.Exons[build] = f.Exons
+}
+
+func parseFeature(body []byte) (feature Feature, err error) {
+	var obj struct {
+		EnsemblBaseObj
+		Exons       []json.RawMessage `json:"Exon"`
+		Transcripts []json.RawMessage `json:"Transcript"`
+	}
+	if err = json.Unmarshal(body, &obj); err != nil {
+		err = errors.Wrap(err, "Could not parse coordinates")
+		return
+	}
+	feature.Region = obj.EnsemblBaseObj
+	class := "exon"
+	if obj.Transcripts != nil {
+		class = "gene"
+	} else if obj.Exons != nil {
+		class = "transcript"
+	}
+	feature.Exons, err = parseExons(class, body)
+	return
+}
+
+func resolveNewRows(ctx context.Context, rows []DbTableRow) (err error) {
+	var index []int
+	var pending []DbTableRow
+	for i, row := range rows {
+		if row.Action == "remove" || row.Class == "region" || session.Db.Connection.checkRegionExists(ctx, row) {
+			continue
+		}
+		index = append(index, i)
+		pending = append(pending, row)
+	}
+	if len(pending) == 0 {
+		return
+	}
+	log.Printf("Resolving %d new regions in Ensembl", len(pending))
+	if err = lookupEnsemblIds(ctx, pending); err != nil {
+		return
+	}
+	if err = lookupCoordinates(ctx, pending, builds); err != nil {
+		return
+	}
+	for i, row := range pending {
+		rows[index[i]] = row
+	}
+	return
+}
+
+func resolveMissingCoordinates(ctx context.Context, rows []DbTableRow, build string) (err error) {
+	var index []int
+	var pending []DbTableRow
+	for i, row := range rows {
+		if _, present := row.Coordinates[build]; present || row.Class == "region" {
+			continue
+		}
+		index = append(index, i)
+		pending = append(pending, row)
+	}
+	if len(pending) == 0 {
+		return
+	}
+	if !session.ResolveMissing {
+		var ids []string
+		for _, row := range pending {
+			ids = append(ids, row.Id)
+		}
+		err = missingDataError("coordinates", ids)
+		return
+	}
+	log.Printf("No stored GRCh%s coordinates for %d regions, querying Ensembl", build, len(pending))
+	if err = lookupCoordinates(ctx, pending, []string{build}); err != nil {
+		return
+	}
+	for i, row := range pending {
+		rows[index[i]] = row
+	}
+	return
+}
+
+func lookupEnsemblIds(ctx context.Context, rows []DbTableRow) (err error) {
+	source, err := getAnnotationSource()
+	if err != nil {
+		return
+	}
+	for _, build := range builds {
+		var symbols []string
+		for _, row := range rows {
+			if row.Class == "gene" && row.getBuildEnsemblId(build) == "" {
+				symbols = append(symbols, row.Id)
+			}
+		}
+		var ids map[string]string
+		if ids, err = source.lookupSymbols(ctx, build, symbols); err != nil {
+			return
+		}
+		var fallback []int
+		for i := range rows {
+			row := &rows[i]
+			switch row.Class {
+			case "exon":
+				row.EnsemblId37 = row.Id
+				row.EnsemblId38 = row.Id
+			case "gene", "transcript":
+				if row.getBuildEnsemblId(build) != "" {
+					continue
+				}
+				if id, found := ids[row.Id]; found {
+					row.setBuildEnsemblId(build, id)
+				} else {
+					fallback = append(fallback, i)
+				}
+			}
+		}
+		// Aliases and transcripts are not covered by the symbol lookup
+		errs := forEachConcurrently(ctx, len(fallback), func(i int) (err error) {
+			row := &rows[fallback[i]]
+			id, err := row.getEnsemblId(ctx, build)
+			row.setBuildEnsemblId(build, id)
+			return
+		})
+		err = collectErrors(errs, func(i int) string {
+			return rows[fallback[i]].Id
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// lookupCoordinates fails for rows without a feature in a build their id was
+// resolved for, unless partial results are allowed
+func lookupCoordinates(ctx context.Context, rows []DbTableRow, builds []string) (err error) {
+	missing, err := findCoordinates(ctx, rows, builds)
+	if err != nil || len(missing) == 0 {
+		return
+	}
+	if session.AllowPartial {
+		log.Printf("Could not find coordinates of %s", strings.Join(missing, ", "))
+		return
+	}
+	err = errors.New(fmt.Sprintf("Could not find coordinates of %s. Double check the ids or use --allow-partial", strings.Join(missing, ", ")))
+	return
+}
+
+// findCoordinates sets the coordinates and exons of rows and lists the rows
+// without a feature
+func findCoordinates(ctx context.Context, rows []DbTableRow, builds []string) (missing []string, err error) {
+	source, err := getAnnotationSource()
+	if err != nil {
+		return
+	}
+	for i := range rows {
+		if rows[i].Class == "region" {
+			continue
+		}
+		if rows[i].Coordinates == nil {
+			rows[i].Coordinates = make(map[string]EnsemblBaseObj)
+		}
+		if rows[i].Exons == nil {
+			rows[i].Exons = make(map[string][]EnsemblBaseObj)
+		}
+	}
+	for _, build := range builds {
+		var expanded, plain []string
+		for _, row := range rows {
+			id := row.getBuildEnsemblId(build)
+			if row.Class == "region" || id == "" {
+				continue
+			} else if row.Class == "exon" {
+				plain = append(plain, id)
+			} else {
+				expanded = append(expanded, id)
+			}
+		}
+		var release string
+		if release, err = getLiveRelease(ctx, build); err != nil {
+			return
+		}
+		var features, exonFeatures map[string]Feature
+		if features, err = source.lookupFeatures(ctx, build, expanded, true); err != nil {
+			return
+		}
+		if exonFeatures, err = source.lookupFeatures(ctx, build, plain, false); err != nil {
+			return
+		}
+		for id, feature := range exonFeatures {
+			features[id] = feature
+		}
+		for i := range rows {
+			row := &rows[i]
+			id := row.getBuildEnsemblId(build)
+			if row.Class == "region" || id == "" {
+				continue
+			}
+			feature, found := features[id]
+			if !found {
+				missing = append(missing, fmt.Sprintf("%s (%s) in GRCh%s", row.Id, id, build))
+				continue
+			}
+			feature.setOnRow(row, build, release)
+		}
+	}
+	return
+}
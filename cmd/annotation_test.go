@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+type countingSource struct {
+	AnnotationSource
+	lookups []string
+}
+
+func (c *countingSource) getFeature(ctx context.Context, build string, id string, expand bool) (feature Feature, err error) {
+	c.lookups = append(c.lookups, id)
+	feature.Region = EnsemblBaseObj{EnsemblId: id, Start: len(c.lookups)}
+	return
+}
+
+func (c *countingSource) lookupFeatures(ctx context.Context, build string, ids []string, expand bool) (features map[string]Feature, err error) {
+	features = make(map[string]Feature)
+	for _, id := range ids {
+		if id == "ENSG_MISSING" {
+			continue
+		}
+		features[id], _ = c.getFeature(ctx, build, id, expand)
+	}
+	return
+}
+
+func TestFeatureCache(t *testing.T) {
+	ctx := context.Background()
+	source := &countingSource{}
+	cache := newFeatureCache(source)
+	features, err := cache.lookupFeatures(ctx, "38", []string{"ENSG001", "ENSG002", "ENSG_MISSING"}, true)
+	checkError(t, err, false)
+	if len(features) != 2 {
+		t.Errorf("Expected 2 features, got %d", len(features))
+	}
+	features, err = cache.lookupFeatures(ctx, "38", []string{"ENSG002", "ENSG003"}, true)
+	checkError(t, err, false)
+	if features["ENSG002"].Region.Start != 2 || features["ENSG003"].Region.Start != 3 {
+		t.Errorf("Unexpected features %v", features)
+	}
+	feature, err := cache.getFeature(ctx, "38", "ENSG001", true)
+	checkError(t, err, false)
+	if feature.Region.Start != 1 {
+		t.Errorf("Expected cached feature, got %v", feature)
+	}
+	_, err = cache.getFeature(ctx, "37", "ENSG001", true)
+	checkError(t, err, false)
+	_, err = cache.getFeature(ctx, "38", "ENSG001", false)
+	checkError(t, err, false)
+	expected := []string{"ENSG001", "ENSG002", "ENSG003", "ENSG001", "ENSG001"}
+	if diff := deep.Equal(source.lookups, expected); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestLookupCoordinates(t *testing.T) {
+	var cases = map[string]struct {
+		allowPartial bool
+		wantErr      bool
+	}{
+		"Missing feature fails": {
+			false,
+			true,
+		},
+		"Missing feature is skipped with allow partial": {
+			true,
+			false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{AllowPartial: c.allowPartial}
+			session.Annotation.Backend = stubSource{features: map[string]Feature{
+				"38:ENSE001": {Region: EnsemblBaseObj{Chromosome: "1", End: 200, EnsemblId: "ENSE001", Start: 100}},
+			}}
+			rows := []DbTableRow{
+				{Class: "exon", EnsemblId38: "ENSE001", Id: "ENSE001"},
+				{Class: "exon", EnsemblId38: "ENSE_MISSING", Id: "ENSE_MISSING"},
+			}
+			err := lookupCoordinates(context.Background(), rows, []string{"38"})
+			checkError(t, err, c.wantErr)
+			if rows[0].Coordinates["38"].Start != 100 || rows[0].Coordinates["38"].Release != "110" {
+				t.Errorf("Unexpected coordinates %v", rows[0].Coordinates)
+			}
+			if _, present := rows[1].Coordinates["38"]; present {
+				t.Errorf("Unexpected coordinates %v", rows[1].Coordinates)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type auditRegion struct {
+	Build       string                    `json:"build,omitempty"`
+	Chromosome  string                    `json:"chromosome,omitempty"`
+	Class       string                    `json:"class"`
+	Coordinates map[string]EnsemblBaseObj `json:"coordinates,omitempty"`
+	End         string                    `json:"end,omitempty"`
+	EnsemblId37 string                    `json:"ensembl_id_37,omitempty"`
+	EnsemblId38 string                    `json:"ensembl_id_38,omitempty"`
+	Start       string                    `json:"start,omitempty"`
+}
+
+type auditMembership struct {
+	Analyses []string `json:"analyses"`
+}
+
+func getCurrentUser() string {
+	if session.User != "" {
+		return session.User
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return "unknown"
+}
+
+func getChecksum(path string) (checksum string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return
+	}
+	checksum = hex.EncodeToString(hash.Sum(nil))
+	return
+}
+
+func (s *Session) setSource(path string) (err error) {
+	checksum, err := getChecksum(path)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not calculate checksum of %s", path))
+		return
+	}
+	s.Source = source{
+		Checksum: checksum,
+		File:     path,
+	}
+	return
+}
+
+func newAuditEntry(action string, list string, regionId string, oldValue interface{}, newValue interface{}) (entry AuditEntry, err error) {
+	entry = AuditEntry{
+		Action:         action,
+		ChangedAt:      time.Now().UTC().Truncate(time.Microsecond),
+		ChangedBy:      getCurrentUser(),
+		List:           list,
+		RegionId:       regionId,
+		SourceChecksum: session.Source.Checksum,
+		SourceFile:     session.Source.File,
+	}
+	if entry.OldValue, err = getAuditValue(oldValue); err != nil {
+		return
+	}
+	entry.NewValue, err = getAuditValue(newValue)
+	return
+}
+
+func getAuditValue(value interface{}) (text string, err error) {
+	if value == nil {
+		return
+	}
+	var data []byte
+	if data, err = json.Marshal(value); err != nil {
+		err = errors.Wrap(err, "Could not serialize audit value")
+		return
+	}
+	text = string(data)
+	return
+}
+
+func (d DbTableRow) getAuditRegion() auditRegion {
+	return auditRegion{
+		Build:       d.Build,
+		Chromosome:  d.Chromosome,
+		Class:       d.Class,
+		Coordinates: d.Coordinates,
+		End:         d.End,
+		EnsemblId37: d.EnsemblId37,
+		EnsemblId38: d.EnsemblId38,
+		Start:       d.Start,
+	}
+}
+
+func (d dbConnection) addAuditEntry(ctx context.Context, entry AuditEntry) (err error) {
+	_, err = d.conn().ExecContext(ctx, `INSERT INTO audit_log (changed_at, changed_by, source_file, source_checksum, action, list, region_id, old_value, new_value) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`, entry.ChangedAt, entry.ChangedBy, entry.SourceFile, entry.SourceChecksum, entry.Action, entry.List, entry.RegionId, entry.OldValue, entry.NewValue)
+	if err != nil {
+		err = errors.Wrap(err, "Could not write audit log")
+	}
+	return
+}
+
+func (d dbConnection) getHistory(ctx context.Context, filter HistoryFilter) (entries []AuditEntry, err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	var conditions []string
+	var args []interface{}
+	if filter.List != "" {
+		args = append(args, filter.List)
+		conditions = append(conditions, fmt.Sprintf("list = $%d", len(args)))
+	}
+	if filter.RegionId != "" {
+		args = append(args, filter.RegionId)
+		conditions = append(conditions, fmt.Sprintf("region_id = $%d", len(args)))
+	}
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since.UTC())
+		conditions = append(conditions, fmt.Sprintf("changed_at >= $%d", len(args)))
+	}
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until.UTC())
+		conditions = append(conditions, fmt.Sprintf("changed_at <= $%d", len(args)))
+	}
+	query := `SELECT changed_at, changed_by, source_file, source_checksum, action, list, region_id, old_value, new_value FROM audit_log`
+	if len(conditions) > 0 {
+		query = fmt.Sprintf("%s WHERE %s", query, strings.Join(conditions, " AND "))
+	}
+	query = fmt.Sprintf("%s ORDER BY id;", query)
+	rows, err := d.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry AuditEntry
+		if err = rows.Scan(&entry.ChangedAt, &entry.ChangedBy, &entry.SourceFile, &entry.SourceChecksum, &entry.Action, &entry.List, &entry.RegionId, &entry.OldValue, &entry.NewValue); err != nil {
+			return
+		}
+		entries = append(entries, entry)
+	}
+	return
+}
+
+func historyToSlices(entries []AuditEntry) (lines [][]string) {
+	lines = append(lines, []string{"changed_at", "changed_by", "action", "list", "region_id", "old_value", "new_value", "source_file", "source_checksum"})
+	for _, entry := range entries {
+		lines = append(lines, []string{entry.ChangedAt.UTC().Format(time.RFC3339), entry.ChangedBy, entry.Action, entry.List, entry.RegionId, entry.OldValue, entry.NewValue, entry.SourceFile, entry.SourceChecksum})
+	}
+	return
+}
+
+// parseHistoryDate reads an inclusive bound. Dates ending a range end at the
+// last microsecond of the day, the precision audit timestamps are stored with.
+func parseHistoryDate(value string, endOfDay bool) (date time.Time, err error) {
+	if value == "" {
+		return
+	}
+	if date, err = time.Parse(time.RFC3339, value); err == nil {
+		return
+	}
+	if date, err = time.Parse("2006-01-02", value); err != nil {
+		err = errors.New(fmt.Sprintf("%s is not a valid date (e.g. 2022-01-31 or 2022-01-31T12:00:00Z)", value))
+		return
+	}
+	if endOfDay {
+		date = date.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	return
+}
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestGetChecksum(t *testing.T) {
+	var cases = map[string]struct {
+		content string
+		result  string
+		wantErr bool
+	}{
+		"File exists": {
+			"abc",
+			"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+			false,
+		},
+		"File does not exist": {
+			"",
+			"",
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "list.tsv")
+			if !c.wantErr {
+				if err := os.WriteFile(path, []byte(c.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			result, err := getChecksum(path)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestParseHistoryDate(t *testing.T) {
+	var cases = map[string]struct {
+		value    string
+		endOfDay bool
+		result   time.Time
+		wantErr  bool
+	}{
+		"No date given": {
+			"",
+			false,
+			time.Time{},
+			false,
+		},
+		"Start of day": {
+			"2022-01-31",
+			false,
+			time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC),
+			false,
+		},
+		"End of day": {
+			"2022-01-31",
+			true,
+			time.Date(2022, 1, 31, 23, 59, 59, 999999000, time.UTC),
+			false,
+		},
+		"Timestamp": {
+			"2022-01-31T12:00:00Z",
+			true,
+			time.Date(2022, 1, 31, 12, 0, 0, 0, time.UTC),
+			false,
+		},
+		"Invalid date": {
+			"31.01.2022",
+			false,
+			time.Time{},
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result, err := parseHistoryDate(c.value, c.endOfDay)
+			checkError(t, err, c.wantErr)
+			if c.wantErr {
+				return
+			}
+			if !result.Equal(c.result) {
+				t.Errorf("%v != %v", result, c.result)
+			}
+		})
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	var cases = map[string]struct {
+		filter HistoryFilter
+		result [][]string
+	}{
+		"All changes": {
+			HistoryFilter{},
+			[][]string{
+				{"create_list", "aml", ""},
+				{"add_region", "", "REGION1"},
+				{"add_to_list", "aml", "REGION1"},
+				{"create_list", "all", ""},
+				{"add_to_list", "all", "REGION1"},
+			},
+		},
+		"Changes of list": {
+			HistoryFilter{
+				List: "all",
+			},
+			[][]string{
+				{"create_list", "all", ""},
+				{"add_to_list", "all", "REGION1"},
+			},
+		},
+		"Changes of region in list": {
+			HistoryFilter{
+				List:     "aml",
+				RegionId: "REGION1",
+			},
+			[][]string{
+				{"add_to_list", "aml", "REGION1"},
+			},
+		},
+		"Changes in the future": {
+			HistoryFilter{
+				Since: time.Now().AddDate(0, 0, 1),
+			},
+			nil,
+		},
+		"Changes in the past": {
+			HistoryFilter{
+				Until: time.Now().AddDate(0, 0, -1),
+			},
+			nil,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, true)
+			session.User = "itsme"
+			session.Tsv = filepath.Join(t.TempDir(), "list.tsv")
+			tsv := "id\tclass\tanalyses\ttables\tinclude_partners\tcoordinates\nREGION1\tregion\tsnv\taml,all\tfalse\tchr1:100-200\n"
+			if err := os.WriteFile(session.Tsv, []byte(tsv), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := tsvToDb(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := session.Db.Connection.getHistory(context.Background(), c.filter)
+			checkError(t, err, false)
+			var result [][]string
+			for _, entry := range entries {
+				if entry.ChangedBy != "itsme" || entry.SourceFile != session.Tsv || len(entry.SourceChecksum) != 64 {
+					t.Errorf("Entry is missing source or user: %v", entry)
+				}
+				result = append(result, []string{entry.Action, entry.List, entry.RegionId})
+			}
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSqliteHistoryUntil(t *testing.T) {
+	var cases = map[string]struct {
+		until  string
+		result []string
+	}{
+		"Timestamp includes changes at that instant": {
+			"2022-01-31T12:00:00Z",
+			[]string{"NOON"},
+		},
+		"Timestamp excludes later changes": {
+			"2022-01-31T11:59:59Z",
+			nil,
+		},
+		"Date includes the whole day": {
+			"2022-01-31",
+			[]string{"NOON", "MIDNIGHT"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, true)
+			connection := session.Db.Connection.(sqliteConnection)
+			for id, changedAt := range map[string]time.Time{
+				"NOON":     time.Date(2022, 1, 31, 12, 0, 0, 0, time.UTC),
+				"MIDNIGHT": time.Date(2022, 1, 31, 23, 59, 59, 999999000, time.UTC),
+				"NEXT_DAY": time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+			} {
+				if err := connection.addAuditEntry(context.Background(), AuditEntry{Action: "add_to_list", ChangedAt: changedAt, RegionId: id}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			until, err := parseHistoryDate(c.until, true)
+			checkError(t, err, false)
+			entries, err := session.Db.Connection.getHistory(context.Background(), HistoryFilter{Until: until})
+			checkError(t, err, false)
+			var result []string
+			for _, entry := range entries {
+				result = append(result, entry.RegionId)
+			}
+			sort.Strings(result)
+			sort.Strings(c.result)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// backfillRegions resolves and stores coordinates and exons of regions that
+// were stored without them, e.g. by the store_coordinates migration, or whose
+// exons lack the coding regions added by the add_coding_regions migration, so
+// that extract does not depend on Ensembl
+func backfillRegions(ctx context.Context) (err error) {
+	queryCtx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	regions, err := session.Db.Connection.getStoredRegions(queryCtx)
+	if err != nil {
+		return
+	}
+	var pending []DbTableRow
+	var missing []int
+	for _, region := range regions {
+		if incomplete := region.getIncompleteBuilds(); len(incomplete) > 0 {
+			pending = append(pending, region)
+			missing = append(missing, len(incomplete))
+		}
+	}
+	if len(pending) == 0 {
+		log.Printf("All regions in database %s have stored coordinates, exons and coding regions.", session.Db.Name)
+		return
+	}
+	log.Printf("Resolving %d regions without stored coordinates, exons or coding regions", len(pending))
+	for _, build := range builds {
+		var index []int
+		var rows []DbTableRow
+		for i, region := range pending {
+			for _, incomplete := range region.getIncompleteBuilds() {
+				if incomplete == build {
+					index = append(index, i)
+					rows = append(rows, region)
+				}
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		// Regions without a feature are reported as unresolved below
+		if _, err = findCoordinates(ctx, rows, []string{build}); err != nil {
+			err = errors.Wrap(err, "Could not resolve coordinates")
+			return
+		}
+		for i, row := range rows {
+			pending[index[i]] = row
+		}
+	}
+	var resolved []DbTableRow
+	var unresolved []string
+	for i, region := range pending {
+		incomplete := region.getIncompleteBuilds()
+		if len(incomplete) > 0 {
+			unresolved = append(unresolved, fmt.Sprintf("%s (GRCh%s)", region.Id, strings.Join(incomplete, ", GRCh")))
+		}
+		if len(incomplete) < missing[i] {
+			resolved = append(resolved, region)
+		}
+	}
+	err = inTransaction(ctx, func() (err error) {
+		for _, region := range resolved {
+			if err = session.Db.Connection.replaceCoordinates(ctx, region); err != nil {
+				err = errors.Wrap(err, fmt.Sprintf("Could not store coordinates of region %s", region.Id))
+				return
+			}
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	log.Printf("Stored coordinates and exons of %d regions in database %s.", len(resolved), session.Db.Name)
+	if len(unresolved) > 0 {
+		err = errors.New(fmt.Sprintf("Could not resolve %d regions: %s", len(unresolved), strings.Join(unresolved, ", ")))
+	}
+	return
+}
+
+// getIncompleteBuilds lists the builds a region lacks stored coordinates,
+// exons or coding regions for
+func (d DbTableRow) getIncompleteBuilds() (incomplete []string) {
+	if d.Class == "region" {
+		return
+	}
+	for _, build := range builds {
+		if _, present := d.Coordinates[build]; !present {
+			incomplete = append(incomplete, build)
+		} else if d.Class != "exon" && (len(d.Exons[build]) == 0 || !hasTranscriptBiotypes(d.Exons[build])) {
+			incomplete = append(incomplete, build)
+		}
+	}
+	return
+}
+
+// missingDataError explains how to make regions without stored data available
+// to extract
+func missingDataError(what string, ids []string) error {
+	return errors.New(fmt.Sprintf("No stored GRCh%s %s for %s. Run migrate backfill to store them or pass --resolve-missing to query the annotation source", session.Build, what, strings.Join(ids, ", ")))
+}
+
+func (d dbConnection) getStoredRegions(ctx context.Context) (regions []DbTableRow, err error) {
+	rows, err := d.conn().QueryContext(ctx, `SELECT id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end", build FROM regions WHERE class <> 'region' ORDER BY id;`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var region DbTableRow
+		if err = rows.Scan(&region.Id, &region.EnsemblId38, &region.EnsemblId37, &region.Class, &region.Chromosome, &region.Start, &region.End, &region.Build); err != nil {
+			return
+		}
+		regions = append(regions, region)
+	}
+	if err = rows.Close(); err != nil {
+		return
+	}
+	err = d.getStoredCoordinates(ctx, regions, "")
+	return
+}
+
+// getStoredCoordinates adds the coordinates and exons of all builds to regions,
+// restricted by a condition on region_id
+func (d dbConnection) getStoredCoordinates(ctx context.Context, regions []DbTableRow, condition string, args ...interface{}) (err error) {
+	index := make(map[string]int)
+	for i, region := range regions {
+		index[region.Id] = i
+	}
+	coordinates, err := d.conn().QueryContext(ctx, fmt.Sprintf(`SELECT region_id, build, chromosome, start, "end", ensembl_release, strand FROM region_coordinates %s;`, condition), args...)
+	if err != nil {
+		return
+	}
+	defer coordinates.Close()
+	for coordinates.Next() {
+		var id, build string
+		var coordinate EnsemblBaseObj
+		if err = coordinates.Scan(&id, &build, &coordinate.Chromosome, &coordinate.Start, &coordinate.End, &coordinate.Release, &coordinate.Strand); err != nil {
+			return
+		}
+		i, present := index[id]
+		if !present {
+			continue
+		}
+		region := &regions[i]
+		coordinate.EnsemblId = region.getBuildEnsemblId(build)
+		if region.Coordinates == nil {
+			region.Coordinates = make(map[string]EnsemblBaseObj)
+		}
+		region.Coordinates[build] = coordinate
+	}
+	if err = coordinates.Close(); err != nil {
+		return
+	}
+	exons, err := d.conn().QueryContext(ctx, fmt.Sprintf(`SELECT region_id, build, transcript_id, exon_id, chromosome, start, "end", transcript_tags, transcript_biotype, coding_start, coding_end, strand FROM region_exons %s ORDER BY region_id, build, transcript_id, start;`, condition), args...)
+	if err != nil {
+		return
+	}
+	defer exons.Close()
+	for exons.Next() {
+		var id, build, tags string
+		var exon EnsemblBaseObj
+		if err = exons.Scan(&id, &build, &exon.Transcript, &exon.EnsemblId, &exon.Chromosome, &exon.Start, &exon.End, &tags, &exon.Biotype, &exon.CodingStart, &exon.CodingEnd, &exon.Strand); err != nil {
+			return
+		}
+		i, present := index[id]
+		if !present {
+			continue
+		}
+		exon.Tags = splitTags(tags)
+		region := &regions[i]
+		if region.Exons == nil {
+			region.Exons = make(map[string][]EnsemblBaseObj)
+		}
+		region.Exons[build] = append(region.Exons[build], exon)
+	}
+	return
+}
+
+// replaceCoordinates overwrites the stored coordinates and exons of a region
+func (d dbConnection) replaceCoordinates(ctx context.Context, region DbTableRow) (err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	if _, err = d.conn().ExecContext(ctx, `DELETE FROM region_exons WHERE region_id = $1;`, region.Id); err != nil {
+		return
+	}
+	if _, err = d.conn().ExecContext(ctx, `DELETE FROM region_coordinates WHERE region_id = $1;`, region.Id); err != nil {
+		return
+	}
+	if err = d.addCoordinates(ctx, region); err != nil {
+		return
+	}
+	var entry AuditEntry
+	if entry, err = newAuditEntry("backfill_region", "", region.Id, nil, region.getAuditRegion()); err != nil {
+		return
+	}
+	err = d.addAuditEntry(ctx, entry)
+	return
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+type stubSource struct {
+	AnnotationSource
+	features map[string]Feature
+}
+
+func (s stubSource) getRelease(ctx context.Context, build string) (release string, err error) {
+	release = "110"
+	return
+}
+
+func (s stubSource) lookupFeatures(ctx context.Context, build string, ids []string, expand bool) (features map[string]Feature, err error) {
+	features = make(map[string]Feature)
+	for _, id := range ids {
+		if feature, found := s.features[build+":"+id]; found {
+			features[id] = feature
+		}
+	}
+	return
+}
+
+func TestGetIncompleteBuilds(t *testing.T) {
+	var cases = map[string]struct {
+		row    DbTableRow
+		result []string
+	}{
+		"Regions are never incomplete": {
+			DbTableRow{Class: "region"},
+			nil,
+		},
+		"Exons only need coordinates": {
+			DbTableRow{Class: "exon", Coordinates: map[string]EnsemblBaseObj{"37": {}, "38": {}}},
+			nil,
+		},
+		"Gene without exons": {
+			DbTableRow{Class: "gene", Coordinates: map[string]EnsemblBaseObj{"37": {}, "38": {}}, Exons: map[string][]EnsemblBaseObj{"38": {{Biotype: "protein_coding"}}}},
+			[]string{"37"},
+		},
+		"Exons stored before coding regions": {
+			DbTableRow{Class: "transcript", Coordinates: map[string]EnsemblBaseObj{"37": {}, "38": {}}, Exons: map[string][]EnsemblBaseObj{"37": {{Biotype: "protein_coding"}}, "38": {{}}}},
+			[]string{"38"},
+		},
+		"Transcript without coordinates": {
+			DbTableRow{Class: "transcript"},
+			[]string{"37", "38"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result := c.row.getIncompleteBuilds()
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSqliteBackfillRegions(t *testing.T) {
+	getSqliteDb(t, true)
+	ctx := context.Background()
+	exon := EnsemblBaseObj{Biotype: "protein_coding", Chromosome: "1", End: 150, EnsemblId: "ENSE001", Start: 100, Transcript: "ENST001"}
+	session.Annotation.Backend = stubSource{features: map[string]Feature{
+		"37:ENSG001": {Region: EnsemblBaseObj{Chromosome: "1", End: 200, EnsemblId: "ENSG001", Start: 50}, Exons: []EnsemblBaseObj{exon}},
+		"38:ENSG001": {Region: EnsemblBaseObj{Chromosome: "1", End: 300, EnsemblId: "ENSG001", Start: 150}, Exons: []EnsemblBaseObj{exon}},
+		"37:ENSE002": {Region: EnsemblBaseObj{Chromosome: "2", End: 20, EnsemblId: "ENSE002", Start: 10}},
+	}}
+	rows := []DbTableRow{
+		{Class: "gene", EnsemblId37: "ENSG001", EnsemblId38: "ENSG001", Id: "GENE1"},
+		{Class: "exon", Coordinates: map[string]EnsemblBaseObj{"38": {Chromosome: "2", End: 30, Start: 20}}, EnsemblId37: "ENSE002", EnsemblId38: "ENSE002", Id: "ENSE002"},
+		{Class: "exon", EnsemblId37: "ENSE003", EnsemblId38: "ENSE003", Id: "ENSE003"},
+		{Build: "38", Chromosome: "3", Class: "region", End: "40", Id: "REGION1", Start: "30"},
+	}
+	for _, row := range rows {
+		if err := session.Db.Connection.addNewRow(ctx, row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := backfillRegions(ctx)
+	checkError(t, err, true)
+	regions, err := session.Db.Connection.getStoredRegions(ctx)
+	checkError(t, err, false)
+	var incomplete []string
+	for _, region := range regions {
+		incomplete = append(incomplete, region.getIncompleteBuilds()...)
+	}
+	if diff := deep.Equal(incomplete, []string{"37", "38"}); diff != nil {
+		t.Error(diff)
+	}
+	// Regions are ordered by id
+	if regions[0].Coordinates["37"].Release != "110" || regions[0].Coordinates["38"].Start != 20 {
+		t.Errorf("Unexpected coordinates %v", regions[0])
+	}
+	if regions[2].Coordinates["38"].Start != 150 || len(regions[2].Exons["37"]) != 1 {
+		t.Errorf("Unexpected coordinates %v", regions[2])
+	}
+	entries, err := session.Db.Connection.getHistory(ctx, HistoryFilter{})
+	checkError(t, err, false)
+	var backfilled []string
+	for _, entry := range entries {
+		if entry.Action == "backfill_region" {
+			backfilled = append(backfilled, entry.RegionId)
+		}
+	}
+	if len(backfilled) != 2 {
+		t.Errorf("Expected two backfilled regions, got %v", backfilled)
+	}
+}
+
+func TestResolveMissingCoordinates(t *testing.T) {
+	var cases = map[string]struct {
+		resolveMissing bool
+		wantErr        bool
+	}{
+		"Missing coordinates fail by default": {
+			false,
+			true,
+		},
+		"Missing coordinates are resolved on request": {
+			true,
+			false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{ResolveMissing: c.resolveMissing}
+			session.Annotation.Backend = stubSource{features: map[string]Feature{
+				"38:ENSG001": {Region: EnsemblBaseObj{Chromosome: "1", End: 300, EnsemblId: "ENSG001", Start: 150}},
+			}}
+			rows := []DbTableRow{{Class: "gene", EnsemblId38: "ENSG001", Id: "GENE1"}}
+			err := resolveMissingCoordinates(context.Background(), rows, "38")
+			checkError(t, err, c.wantErr)
+			if _, present := rows[0].Coordinates["38"]; present == c.wantErr {
+				t.Errorf("Unexpected coordinates %v", rows[0].Coordinates)
+			}
+		})
+	}
+}
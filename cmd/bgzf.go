@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Uncompressed size of a BGZF block, small enough for incompressible data to
+// stay below the 64 KiB limit of a block, as in htslib
+const bgzfBlockSize = 0xff00
+
+// Empty block marking the end of a BGZF file
+var bgzfEOF = []byte{0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43, 0x02, 0x00, 0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+const (
+	tabixMinShift  = 14
+	tabixUcscFlags = 0x10000
+	tabixUnset     = ^uint64(0)
+)
+
+type bgzfWriter struct {
+	buffer []byte
+	offset int64
+	writer io.Writer
+}
+
+type tabixChunk struct {
+	begin uint64
+	end   uint64
+}
+
+type tabixReference struct {
+	bins   map[uint32][]tabixChunk
+	linear []uint64
+}
+
+type tabixIndex struct {
+	names      []string
+	references map[string]*tabixReference
+}
+
+func newBgzfWriter(writer io.Writer) *bgzfWriter {
+	return &bgzfWriter{writer: writer}
+}
+
+func (b *bgzfWriter) Write(data []byte) (n int, err error) {
+	b.buffer = append(b.buffer, data...)
+	for len(b.buffer) >= bgzfBlockSize {
+		if err = b.writeBlock(b.buffer[:bgzfBlockSize]); err != nil {
+			return
+		}
+		b.buffer = b.buffer[bgzfBlockSize:]
+	}
+	n = len(data)
+	return
+}
+
+// virtualOffset points to the next byte written, combining the offset of its
+// compressed block with the position inside the uncompressed block
+func (b *bgzfWriter) virtualOffset() uint64 {
+	return uint64(b.offset)<<16 | uint64(len(b.buffer))
+}
+
+// Close writes the remaining data and the end of file marker without closing
+// the underlying writer
+func (b *bgzfWriter) Close() (err error) {
+	if len(b.buffer) > 0 {
+		if err = b.writeBlock(b.buffer); err != nil {
+			return
+		}
+		b.buffer = nil
+	}
+	_, err = b.writer.Write(bgzfEOF)
+	return
+}
+
+func (b *bgzfWriter) writeBlock(data []byte) (err error) {
+	var compressed bytes.Buffer
+	deflate, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return
+	}
+	if _, err = deflate.Write(data); err != nil {
+		return
+	}
+	if err = deflate.Close(); err != nil {
+		return
+	}
+	// gzip header with the BC extra field holding the block size minus one
+	block := []byte{0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43, 0x02, 0x00, 0x00, 0x00}
+	binary.LittleEndian.PutUint16(block[16:], uint16(len(block)+compressed.Len()+8-1))
+	block = append(block, compressed.Bytes()...)
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer, crc32.ChecksumIEEE(data))
+	binary.LittleEndian.PutUint32(trailer[4:], uint32(len(data)))
+	block = append(block, trailer...)
+	if _, err = b.writer.Write(block); err != nil {
+		return
+	}
+	b.offset += int64(len(block))
+	return
+}
+
+func newTabixIndex() *tabixIndex {
+	return &tabixIndex{references: make(map[string]*tabixReference)}
+}
+
+// add indexes a BED line written between the virtual offsets begin and end
+func (t *tabixIndex) add(line []string, begin uint64, end uint64) (err error) {
+	if len(line) < 3 {
+		err = errors.New(fmt.Sprintf("Cannot index line with %d columns", len(line)))
+		return
+	}
+	start, err := strconv.Atoi(line[1])
+	if err != nil {
+		return
+	}
+	stop, err := strconv.Atoi(line[2])
+	if err != nil {
+		return
+	}
+	reference, present := t.references[line[0]]
+	if !present {
+		reference = &tabixReference{bins: make(map[uint32][]tabixChunk)}
+		t.references[line[0]] = reference
+		t.names = append(t.names, line[0])
+	}
+	bin := getTabixBin(start, stop)
+	chunks := reference.bins[bin]
+	if len(chunks) > 0 && chunks[len(chunks)-1].end == begin {
+		chunks[len(chunks)-1].end = end
+	} else {
+		reference.bins[bin] = append(chunks, tabixChunk{begin: begin, end: end})
+	}
+	last := stop - 1
+	if last < start {
+		last = start
+	}
+	for window := start >> tabixMinShift; window <= last>>tabixMinShift; window++ {
+		for len(reference.linear) <= window {
+			reference.linear = append(reference.linear, tabixUnset)
+		}
+		if reference.linear[window] == tabixUnset {
+			reference.linear[window] = begin
+		}
+	}
+	return
+}
+
+// getTabixBin returns the smallest bin of the UCSC binning scheme containing
+// the 0-based, half-open interval
+func getTabixBin(start int, end int) uint32 {
+	end--
+	if end < start {
+		end = start
+	}
+	for level, shift := 5, tabixMinShift; level > 0; level, shift = level-1, shift+3 {
+		if start>>shift == end>>shift {
+			return uint32(((1<<(3*level))-1)/7 + start>>shift)
+		}
+	}
+	return 0
+}
+
+func (t *tabixIndex) write(path string) (err error) {
+	var data bytes.Buffer
+	data.WriteString("TBI\x01")
+	var names []byte
+	for _, name := range t.names {
+		names = append(append(names, name...), 0)
+	}
+	// Sequence, start and end are read from the first three columns, lines
+	// starting with # are skipped
+	for _, value := range []int32{int32(len(t.names)), tabixUcscFlags, 1, 2, 3, '#', 0, int32(len(names))} {
+		binary.Write(&data, binary.LittleEndian, value)
+	}
+	data.Write(names)
+	for _, name := range t.names {
+		reference := t.references[name]
+		var bins []uint32
+		for bin := range reference.bins {
+			bins = append(bins, bin)
+		}
+		sort.Slice(bins, func(i, j int) bool { return bins[i] < bins[j] })
+		binary.Write(&data, binary.LittleEndian, int32(len(bins)))
+		for _, bin := range bins {
+			binary.Write(&data, binary.LittleEndian, bin)
+			binary.Write(&data, binary.LittleEndian, int32(len(reference.bins[bin])))
+			for _, chunk := range reference.bins[bin] {
+				binary.Write(&data, binary.LittleEndian, chunk.begin)
+				binary.Write(&data, binary.LittleEndian, chunk.end)
+			}
+		}
+		// Windows without own lines point to the previous line
+		for i := range reference.linear {
+			if reference.linear[i] != tabixUnset {
+				continue
+			}
+			reference.linear[i] = 0
+			if i > 0 {
+				reference.linear[i] = reference.linear[i-1]
+			}
+		}
+		binary.Write(&data, binary.LittleEndian, int32(len(reference.linear)))
+		for _, offset := range reference.linear {
+			binary.Write(&data, binary.LittleEndian, offset)
+		}
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not create index %s", path))
+		return
+	}
+	defer file.Close()
+	bgzf := newBgzfWriter(file)
+	if _, err = bgzf.Write(data.Bytes()); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not write index %s", path))
+		return
+	}
+	if err = bgzf.Close(); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not write index %s", path))
+	}
+	return
+}
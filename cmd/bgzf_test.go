@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+// readBgzfBlocks returns the uncompressed data and where each block starts in it
+func readBgzfBlocks(t *testing.T, path string) (blocks map[uint64]int, data []byte) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(content, bgzfEOF) {
+		t.Error("End of file marker is missing")
+	}
+	blocks = make(map[uint64]int)
+	for offset := 0; offset < len(content); {
+		if content[offset+12] != 'B' || content[offset+13] != 'C' {
+			t.Fatalf("Block at %d has no BC field", offset)
+		}
+		size := int(binary.LittleEndian.Uint16(content[offset+16:])) + 1
+		reader, err := gzip.NewReader(bytes.NewReader(content[offset : offset+size]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader.Multistream(false)
+		block, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks[uint64(offset)] = len(data)
+		data = append(data, block...)
+		offset += size
+	}
+	return
+}
+
+// queryTabix reads the lines overlapping a 0-based, half-open interval via the index
+func queryTabix(t *testing.T, path string, name string, start int, end int) (lines []string) {
+	blocks, content := readBgzfBlocks(t, path)
+	_, index := readBgzfBlocks(t, path+".tbi")
+	reader := bytes.NewReader(index)
+	var magic [4]byte
+	var header [8]int32
+	binary.Read(reader, binary.LittleEndian, &magic)
+	binary.Read(reader, binary.LittleEndian, &header)
+	names := make([]byte, header[7])
+	reader.Read(names)
+	for _, reference := range strings.Split(strings.TrimSuffix(string(names), "\x00"), "\x00") {
+		var nBins int32
+		binary.Read(reader, binary.LittleEndian, &nBins)
+		chunks := make(map[uint32][]tabixChunk)
+		for i := 0; i < int(nBins); i++ {
+			var bin uint32
+			var nChunks int32
+			binary.Read(reader, binary.LittleEndian, &bin)
+			binary.Read(reader, binary.LittleEndian, &nChunks)
+			for j := 0; j < int(nChunks); j++ {
+				var chunk [2]uint64
+				binary.Read(reader, binary.LittleEndian, &chunk)
+				chunks[bin] = append(chunks[bin], tabixChunk{begin: chunk[0], end: chunk[1]})
+			}
+		}
+		var nIntervals int32
+		binary.Read(reader, binary.LittleEndian, &nIntervals)
+		linear := make([]uint64, nIntervals)
+		binary.Read(reader, binary.LittleEndian, &linear)
+		if reference != name {
+			continue
+		}
+		var minOffset uint64
+		if window := start >> tabixMinShift; window < len(linear) {
+			minOffset = linear[window]
+		}
+		seen := make(map[string]struct{})
+		for bin, binChunks := range chunks {
+			if !binOverlaps(bin, start, end) {
+				continue
+			}
+			for _, chunk := range binChunks {
+				if chunk.end <= minOffset {
+					continue
+				}
+				begin := blocks[chunk.begin>>16] + int(chunk.begin&0xffff)
+				scanner := bufio.NewScanner(bytes.NewReader(content[begin:]))
+				for scanner.Scan() {
+					fields := strings.Split(scanner.Text(), "\t")
+					var lineStart, lineEnd int
+					fmt.Sscan(fields[1], &lineStart)
+					fmt.Sscan(fields[2], &lineEnd)
+					if fields[0] != name || lineStart >= end {
+						break
+					}
+					if _, present := seen[scanner.Text()]; !present && lineEnd > start {
+						seen[scanner.Text()] = struct{}{}
+						lines = append(lines, scanner.Text())
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+func binOverlaps(bin uint32, start int, end int) bool {
+	for level, shift, offset := 0, 29, 0; level <= 5; level, shift = level+1, shift-3 {
+		size := 1 << (3 * level)
+		if int(bin) >= offset && int(bin) < offset+size {
+			first := (int(bin) - offset) << shift
+			return first < end && first+(1<<shift) > start
+		}
+		offset += size
+	}
+	return false
+}
+
+func TestGetTabixBin(t *testing.T) {
+	var cases = map[string]struct {
+		start  int
+		end    int
+		result uint32
+	}{
+		"Smallest bin": {
+			0,
+			100,
+			4681,
+		},
+		"Second level": {
+			16000,
+			17000,
+			585,
+		},
+		"Whole chromosome": {
+			0,
+			1 << 29,
+			0,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result := getTabixBin(c.start, c.end)
+			if result != c.result {
+				t.Errorf("Expected %d, got %d", c.result, result)
+			}
+		})
+	}
+}
+
+func TestWriteCompressedIntervals(t *testing.T) {
+	var data [][]string
+	var expected []string
+	for i := 0; i < 20000; i++ {
+		data = append(data, []string{"chr1", fmt.Sprint(i * 100), fmt.Sprint(i*100 + 50), fmt.Sprintf("REGION%d", i)})
+		if i*100+50 > 1500000 && i*100 < 1500300 {
+			expected = append(expected, strings.Join(data[i], "\t"))
+		}
+	}
+	data = append(data, []string{"chr2", "10", "5000000", "LONG"}, []string{"chr2", "4000000", "4000100", "SHORT"})
+	path := filepath.Join(t.TempDir(), "test.bed.gz")
+	err := writeIntervals(path, []string{"# build: GRCh38"}, data, true, true)
+	checkError(t, err, false)
+	blocks, content := readBgzfBlocks(t, path)
+	if len(blocks) < 3 {
+		t.Errorf("Expected several blocks, got %d", len(blocks))
+	}
+	if !strings.HasPrefix(string(content), "# build: GRCh38\nchr1\t0\t50\tREGION0\n") || !strings.HasSuffix(string(content), "chr2\t4000000\t4000100\tSHORT\n") {
+		t.Error("Uncompressed content differs")
+	}
+	if diff := deep.Equal(queryTabix(t, path, "chr1", 1500000, 1500300), expected); diff != nil {
+		t.Error(diff)
+	}
+	result := queryTabix(t, path, "chr2", 4000050, 4000060)
+	if len(result) != 2 {
+		t.Errorf("Expected both chr2 lines, got %v", result)
+	}
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func sendEnsemblRequest(ctx context.Context, build string, url string) (body []byte, err error) {
+	var found bool
+	if body, found, err = getCachedResponse(ctx, build, url); err != nil || found {
+		return
+	}
+	if session.Web.Offline {
+		err = errors.New(fmt.Sprintf("%s is not cached for GRCh%s and --offline is set. Run the same command online first", getEndpoint(build, url), build))
+		return
+	}
+	if body, err = sendHttpRequest(ctx, url); err != nil {
+		return
+	}
+	cacheResponse(ctx, build, url, body)
+	return
+}
+
+func getCachedResponse(ctx context.Context, build string, url string) (body []byte, found bool, err error) {
+	path, err := getCachePath(ctx, build, url)
+	if err != nil || path == "" {
+		return
+	}
+	var fresh bool
+	if body, fresh, err = readCache(path); err != nil {
+		return
+	}
+	// Stale entries are still better than nothing on air-gapped nodes
+	found = fresh || (body != nil && session.Web.Offline)
+	if !found {
+		body = nil
+	}
+	return
+}
+
+func cacheResponse(ctx context.Context, build string, url string, body []byte) {
+	path, err := getCachePath(ctx, build, url)
+	if err != nil || path == "" {
+		return
+	}
+	if err = writeCache(path, body); err != nil {
+		log.Printf("Could not cache response of %s: %v", url, err)
+	}
+}
+
+func getEndpoint(build string, url string) string {
+	return strings.TrimPrefix(url, getBuildUrl(build))
+}
+
+// isReleaseUrl tells whether url asks for the release itself, which is cached
+// independent of the release
+func isReleaseUrl(build string, url string) bool {
+	return strings.HasPrefix(getEndpoint(build, url), "/info/data")
+}
+
+// getCachePath keeps responses in a directory per build and Ensembl release so
+// that responses of an earlier release are not reused after an update
+func getCachePath(ctx context.Context, build string, url string) (path string, err error) {
+	if session.Web.CacheTTL <= 0 && !session.Web.Offline {
+		return
+	}
+	dir := session.Web.CacheDir
+	if dir == "" {
+		if dir, err = os.UserCacheDir(); err != nil {
+			err = errors.Wrap(err, "Could not determine cache directory, set ENSEMBL_CACHE_DIR")
+			return
+		}
+		dir = filepath.Join(dir, "gene_list_svc", "ensembl")
+	}
+	// The host is part of the key so that moving a build to an archive host
+	// does not serve responses of the previous one
+	hash := sha256.Sum256([]byte(url))
+	var release string
+	if !isReleaseUrl(build, url) {
+		if release, err = (ensemblSource{}).getRelease(ctx, build); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not determine the GRCh%s Ensembl release of cached responses", build))
+			return
+		}
+	}
+	path = filepath.Join(dir, build, release, fmt.Sprintf("%s.json", hex.EncodeToString(hash[:])))
+	return
+}
+
+func readCache(path string) (body []byte, fresh bool, err error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not read cache entry %s", path))
+		return
+	}
+	if body, err = ioutil.ReadFile(path); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not read cache entry %s", path))
+		return
+	}
+	fresh = time.Since(info.ModTime()) < session.Web.CacheTTL
+	return
+}
+
+func writeCache(path string, body []byte) (err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	// Write to a temporary file first so concurrent runs never read partial entries
+	file, err := ioutil.TempFile(filepath.Dir(path), "entry-*")
+	if err != nil {
+		return
+	}
+	if _, err = file.Write(body); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return
+	}
+	if err = file.Close(); err != nil {
+		os.Remove(file.Name())
+		return
+	}
+	err = os.Rename(file.Name(), path)
+	return
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestSendEnsemblRequest(t *testing.T) {
+	var cases = map[string]struct {
+		cached  string
+		age     time.Duration
+		offline bool
+		result  []byte
+		wantErr bool
+	}{
+		"Response is not cached yet": {
+			"",
+			0,
+			false,
+			[]byte(`{"id": "new"}`),
+			false,
+		},
+		"Response is served from cache": {
+			`{"id": "cached"}`,
+			time.Hour,
+			false,
+			[]byte(`{"id": "cached"}`),
+			false,
+		},
+		"Cached response is expired": {
+			`{"id": "cached"}`,
+			48 * time.Hour,
+			false,
+			[]byte(`{"id": "new"}`),
+			false,
+		},
+		"Expired response is served offline": {
+			`{"id": "cached"}`,
+			48 * time.Hour,
+			true,
+			[]byte(`{"id": "cached"}`),
+			false,
+		},
+		"Response is missing offline": {
+			"",
+			0,
+			true,
+			nil,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{
+				Web: web{
+					CacheDir: t.TempDir(),
+					CacheTTL: 24 * time.Hour,
+					Offline:  c.offline,
+					releases: map[string]string{"38": "110"},
+				},
+			}
+			url := getLookUpUrl("ENSG0001", "38", false)
+			if c.cached != "" {
+				path, err := getCachePath(context.Background(), "38", url)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err = writeCache(path, []byte(c.cached)); err != nil {
+					t.Fatal(err)
+				}
+				modified := time.Now().Add(-c.age)
+				if err = os.Chtimes(path, modified, modified); err != nil {
+					t.Fatal(err)
+				}
+			}
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+			httpmock.RegisterResponder("GET", "/lookup/id/ENSG0001?content-type=application/json",
+				httpmock.NewStringResponder(200, `{"id": "new"}`))
+			result, err := sendEnsemblRequest(context.Background(), "38", url)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+			if c.wantErr {
+				return
+			}
+			httpmock.Reset()
+			cached, err := sendEnsemblRequest(context.Background(), "38", url)
+			checkError(t, err, false)
+			if diff := deep.Equal(cached, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestGetCachePath(t *testing.T) {
+	var cases = map[string]struct {
+		ttl   time.Duration
+		build string
+		other string
+		same  bool
+	}{
+		"Builds are cached separately": {
+			time.Hour,
+			"38",
+			"37",
+			false,
+		},
+		"Same endpoint of same build": {
+			time.Hour,
+			"38",
+			"38",
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{
+				Web: web{
+					CacheDir: t.TempDir(),
+					CacheTTL: c.ttl,
+					releases: map[string]string{"37": "110", "38": "110"},
+				},
+			}
+			path, err := getCachePath(context.Background(), c.build, getLookUpUrl("ENSG0001", c.build, true))
+			checkError(t, err, false)
+			other, err := getCachePath(context.Background(), c.other, getLookUpUrl("ENSG0001", c.other, true))
+			checkError(t, err, false)
+			if (path == other) != c.same {
+				t.Errorf("Cache paths %s and %s should be the same: %t", path, other, c.same)
+			}
+			session.Web.CacheTTL = 0
+			if path, _ = getCachePath(context.Background(), c.build, getLookUpUrl("ENSG0001", c.build, true)); path != "" {
+				t.Errorf("Cache should be disabled but got %s", path)
+			}
+		})
+	}
+}
+
+func TestCacheIsKeyedByHost(t *testing.T) {
+	session = Session{
+		Web: web{
+			CacheDir:  t.TempDir(),
+			CacheTTL:  24 * time.Hour,
+			Ensembl38: "https://rest.ensembl.org",
+			releases:  map[string]string{"38": "110"},
+		},
+	}
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://rest.ensembl.org/lookup/id/ENSG0001?content-type=application/json",
+		httpmock.NewStringResponder(200, `{"id": "current"}`))
+	httpmock.RegisterResponder("GET", "https://may2017.archive.ensembl.org/lookup/id/ENSG0001?content-type=application/json",
+		httpmock.NewStringResponder(200, `{"id": "archive"}`))
+	current, err := sendEnsemblRequest(context.Background(), "38", getLookUpUrl("ENSG0001", "38", false))
+	checkError(t, err, false)
+	session.Web.Ensembl38 = "https://may2017.archive.ensembl.org"
+	archive, err := sendEnsemblRequest(context.Background(), "38", getLookUpUrl("ENSG0001", "38", false))
+	checkError(t, err, false)
+	if diff := deep.Equal([]string{string(current), string(archive)}, []string{`{"id": "current"}`, `{"id": "archive"}`}); diff != nil {
+		t.Error(diff)
+	}
+	if calls := httpmock.GetTotalCallCount(); calls != 2 {
+		t.Errorf("Expected a request to each host, got %d", calls)
+	}
+}
+
+func TestCacheIsKeyedByRelease(t *testing.T) {
+	session = Session{
+		Web: web{
+			CacheDir: t.TempDir(),
+			CacheTTL: 24 * time.Hour,
+		},
+	}
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "/info/data?content-type=application/json",
+		httpmock.NewStringResponder(200, `{"releases": [109]}`))
+	httpmock.RegisterResponder("GET", "/lookup/id/ENSG0001?content-type=application/json",
+		httpmock.NewStringResponder(200, `{"id": "109"}`))
+	url := getLookUpUrl("ENSG0001", "38", false)
+	if _, err := sendEnsemblRequest(context.Background(), "38", url); err != nil {
+		t.Fatal(err)
+	}
+	session.Web.releases = nil
+	httpmock.RegisterResponder("GET", "/info/data?content-type=application/json",
+		httpmock.NewStringResponder(200, `{"releases": [110]}`))
+	httpmock.RegisterResponder("GET", "/lookup/id/ENSG0001?content-type=application/json",
+		httpmock.NewStringResponder(200, `{"id": "110"}`))
+	result, err := sendEnsemblRequest(context.Background(), "38", url)
+	checkError(t, err, false)
+	if diff := deep.Equal(string(result), `{"id": "110"}`); diff != nil {
+		t.Error(diff)
+	}
+	session.Web.Offline = true
+	result, err = sendEnsemblRequest(context.Background(), "38", url)
+	checkError(t, err, false)
+	if diff := deep.Equal(string(result), `{"id": "110"}`); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+)
+
+// hasCodingRegions tells whether exons were stored together with the coding
+// regions of their transcripts, which the full exon mode does not need
+func hasCodingRegions(exons []EnsemblBaseObj) bool {
+	if session.ExonMode == "" || session.ExonMode == "full" {
+		return true
+	}
+	return hasTranscriptBiotypes(exons)
+}
+
+// hasTranscriptBiotypes tells whether exons were stored after the
+// add_coding_regions migration, which every exon mode can use
+func hasTranscriptBiotypes(exons []EnsemblBaseObj) bool {
+	for _, exon := range exons {
+		if exon.Biotype == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// selectCodingTranscripts drops non-coding transcripts when exons are trimmed
+// to coding regions. Regions without any coding transcript keep their exons.
+func (d DbTableRow) selectCodingTranscripts(exons []EnsemblBaseObj) (selected []EnsemblBaseObj) {
+	if session.ExonMode == "" || session.ExonMode == "full" {
+		selected = exons
+		return
+	}
+	nonCoding := make(map[string]struct{})
+	for _, exon := range exons {
+		if exon.CodingStart > 0 {
+			selected = append(selected, exon)
+		} else {
+			nonCoding[exon.Transcript] = struct{}{}
+		}
+	}
+	if len(selected) == 0 {
+		log.Printf("Warning: %s has no coding transcripts in GRCh%s, writing its full exons as non_coding", d.Id, session.Build)
+		selected = exons
+	} else if len(nonCoding) > 0 {
+		log.Printf("Skipping %d non-coding transcripts of %s", len(nonCoding), d.Id)
+	}
+	return
+}
+
+// getParts splits an exon according to the exon mode. Only the outer edges of
+// the exon are padded, so that coding and UTR parts stay separate intervals.
+func (o EnsemblBaseObj) getParts(size int) (parts []EnsemblBaseObj) {
+	if session.ExonMode == "" || session.ExonMode == "full" {
+		o.addWindow(size)
+		parts = []EnsemblBaseObj{o}
+		return
+	}
+	if o.CodingStart == 0 {
+		parts = []EnsemblBaseObj{o.getPart("non_coding", o.Start, o.End, size)}
+		return
+	}
+	if o.Start < o.CodingStart && session.ExonMode == "cds_utr" {
+		parts = append(parts, o.getPart("utr", o.Start, min(o.End, o.CodingStart-1), size))
+	}
+	if start, end := max(o.Start, o.CodingStart), min(o.End, o.CodingEnd); start <= end {
+		parts = append(parts, o.getPart("cds", start, end, size))
+	}
+	if o.End > o.CodingEnd && session.ExonMode == "cds_utr" {
+		parts = append(parts, o.getPart("utr", max(o.Start, o.CodingEnd+1), o.End, size))
+	}
+	return
+}
+
+func (o EnsemblBaseObj) getPart(label string, start int, end int, size int) (part EnsemblBaseObj) {
+	part = o
+	part.EnsemblId = fmt.Sprintf("%s:%s", o.EnsemblId, label)
+	part.Start = start
+	part.End = end
+	if start == o.Start {
+		part.Start -= size
+	}
+	if end == o.End {
+		part.End += size
+	}
+	return
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestGetParts(t *testing.T) {
+	coding := EnsemblBaseObj{Biotype: "protein_coding", CodingEnd: 500, CodingStart: 150, End: 200, EnsemblId: "ENSE0001", Start: 100, Transcript: "ENST0001"}
+	var cases = map[string]struct {
+		mode   string
+		exon   EnsemblBaseObj
+		result []EnsemblBaseObj
+	}{
+		"Full exon": {
+			"full",
+			coding,
+			[]EnsemblBaseObj{
+				{Biotype: "protein_coding", CodingEnd: 500, CodingStart: 150, End: 210, EnsemblId: "ENSE0001", Start: 90, Transcript: "ENST0001"},
+			},
+		},
+		"Exon is trimmed to coding region": {
+			"cds",
+			coding,
+			[]EnsemblBaseObj{
+				{Biotype: "protein_coding", CodingEnd: 500, CodingStart: 150, End: 210, EnsemblId: "ENSE0001:cds", Start: 150, Transcript: "ENST0001"},
+			},
+		},
+		"UTR is kept separately": {
+			"cds_utr",
+			coding,
+			[]EnsemblBaseObj{
+				{Biotype: "protein_coding", CodingEnd: 500, CodingStart: 150, End: 149, EnsemblId: "ENSE0001:utr", Start: 90, Transcript: "ENST0001"},
+				{Biotype: "protein_coding", CodingEnd: 500, CodingStart: 150, End: 210, EnsemblId: "ENSE0001:cds", Start: 150, Transcript: "ENST0001"},
+			},
+		},
+		"Coding region within exon": {
+			"cds_utr",
+			EnsemblBaseObj{Biotype: "protein_coding", CodingEnd: 180, CodingStart: 120, End: 200, EnsemblId: "ENSE0001", Start: 100, Transcript: "ENST0001"},
+			[]EnsemblBaseObj{
+				{Biotype: "protein_coding", CodingEnd: 180, CodingStart: 120, End: 119, EnsemblId: "ENSE0001:utr", Start: 90, Transcript: "ENST0001"},
+				{Biotype: "protein_coding", CodingEnd: 180, CodingStart: 120, End: 180, EnsemblId: "ENSE0001:cds", Start: 120, Transcript: "ENST0001"},
+				{Biotype: "protein_coding", CodingEnd: 180, CodingStart: 120, End: 210, EnsemblId: "ENSE0001:utr", Start: 181, Transcript: "ENST0001"},
+			},
+		},
+		"Untranslated exon is dropped": {
+			"cds",
+			EnsemblBaseObj{Biotype: "protein_coding", CodingEnd: 500, CodingStart: 300, End: 200, EnsemblId: "ENSE0001", Start: 100, Transcript: "ENST0001"},
+			nil,
+		},
+		"Non-coding exon": {
+			"cds",
+			EnsemblBaseObj{Biotype: "lncRNA", End: 200, EnsemblId: "ENSE0002", Start: 100, Transcript: "ENST0002"},
+			[]EnsemblBaseObj{
+				{Biotype: "lncRNA", End: 210, EnsemblId: "ENSE0002:non_coding", Start: 90, Transcript: "ENST0002"},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{ExonMode: c.mode}
+			result := c.exon.getParts(10)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSelectCodingTranscripts(t *testing.T) {
+	coding := EnsemblBaseObj{Biotype: "protein_coding", CodingEnd: 500, CodingStart: 150, End: 200, EnsemblId: "ENSE0001", Start: 100, Transcript: "ENST0001"}
+	nonCoding := EnsemblBaseObj{Biotype: "retained_intron", End: 200, EnsemblId: "ENSE0002", Start: 100, Transcript: "ENST0002"}
+	var cases = map[string]struct {
+		mode   string
+		exons  []EnsemblBaseObj
+		result []EnsemblBaseObj
+	}{
+		"All transcripts for full exons": {
+			"full",
+			[]EnsemblBaseObj{coding, nonCoding},
+			[]EnsemblBaseObj{coding, nonCoding},
+		},
+		"Non-coding transcripts are skipped": {
+			"cds",
+			[]EnsemblBaseObj{coding, nonCoding},
+			[]EnsemblBaseObj{coding},
+		},
+		"Non-coding gene is kept": {
+			"cds",
+			[]EnsemblBaseObj{nonCoding},
+			[]EnsemblBaseObj{nonCoding},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{ExonMode: c.mode}
+			result := DbTableRow{Id: "GENE1"}.selectCodingTranscripts(c.exons)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestUniqueExons(t *testing.T) {
+	var cases = map[string]struct {
+		mode   string
+		exons  []EnsemblBaseObj
+		result []EnsemblBaseObj
+	}{
+		"Shared exon is merged": {
+			"full",
+			[]EnsemblBaseObj{
+				{End: 200, EnsemblId: "ENSE0001", Start: 100, Transcript: "ENST0001"},
+				{End: 200, EnsemblId: "ENSE0001", Start: 100, Transcript: "ENST0002"},
+			},
+			[]EnsemblBaseObj{
+				{Annotation: "GENE1|ENSG0001|ENST0001&ENST0002|ENSE0001", End: 210, EnsemblId: "ENSE0001", Start: 90, Transcript: "ENST0001"},
+			},
+		},
+		"Shared exon with different coding regions": {
+			"cds",
+			[]EnsemblBaseObj{
+				{Biotype: "protein_coding", CodingEnd: 500, CodingStart: 100, End: 200, EnsemblId: "ENSE0001", Start: 100, Transcript: "ENST0001"},
+				{Biotype: "protein_coding", CodingEnd: 500, CodingStart: 150, End: 200, EnsemblId: "ENSE0001", Start: 100, Transcript: "ENST0002"},
+			},
+			[]EnsemblBaseObj{
+				{Annotation: "GENE1|ENSG0001|ENST0001|ENSE0001:cds", Biotype: "protein_coding", CodingEnd: 500, CodingStart: 100, End: 210, EnsemblId: "ENSE0001:cds", Start: 90, Transcript: "ENST0001"},
+				{Annotation: "GENE1|ENSG0001|ENST0002|ENSE0001:cds", Biotype: "protein_coding", CodingEnd: 500, CodingStart: 150, End: 210, EnsemblId: "ENSE0001:cds", Start: 150, Transcript: "ENST0002"},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{ExonMode: c.mode}
+			result := uniqueExons("GENE1|ENSG0001", c.exons, 10)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestGetBuildExons(t *testing.T) {
+	coding := []EnsemblBaseObj{{Biotype: "protein_coding", End: 200, EnsemblId: "ENSE0001", Start: 100}}
+	legacy := []EnsemblBaseObj{{End: 200, EnsemblId: "ENSE0001", Start: 100}}
+	var cases = map[string]struct {
+		mode    string
+		exons   map[string][]EnsemblBaseObj
+		result  []EnsemblBaseObj
+		wantErr bool
+	}{
+		"Stored exons with coding regions": {
+			"cds",
+			map[string][]EnsemblBaseObj{"38": coding},
+			coding,
+			false,
+		},
+		"Full exons do not need coding regions": {
+			"full",
+			map[string][]EnsemblBaseObj{"38": legacy},
+			legacy,
+			false,
+		},
+		"Coding regions are missing": {
+			"cds",
+			map[string][]EnsemblBaseObj{"38": legacy},
+			nil,
+			true,
+		},
+		"Exons are missing": {
+			"full",
+			map[string][]EnsemblBaseObj{"37": coding},
+			nil,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{Build: "38", ExonMode: c.mode}
+			row := DbTableRow{Class: "gene", EnsemblId38: "ENSG0001", Exons: c.exons, Id: "GENE1"}
+			result, err := row.getBuildExons(context.Background())
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -26,6 +26,31 @@ var atlasIds = map[string]string{
 	"RUNX1":  "52",
 }
 
+var builds = []string{"37", "38"}
+
+// Lengths of the primary assembly used when no sequence dictionary is given
+var chromosomeLengths = map[string]map[string]int{
+	"37": {
+		"1": 249250621, "2": 243199373, "3": 198022430, "4": 191154276, "5": 180915260,
+		"6": 171115067, "7": 159138663, "8": 146364022, "9": 141213431, "10": 135534747,
+		"11": 135006516, "12": 133851895, "13": 115169878, "14": 107349540, "15": 102531392,
+		"16": 90354753, "17": 81195210, "18": 78077248, "19": 59128983, "20": 63025520,
+		"21": 48129895, "22": 51304566, "X": 155270560, "Y": 59373566, "M": 16569,
+	},
+	"38": {
+		"1": 248956422, "2": 242193529, "3": 198295559, "4": 190214555, "5": 181538259,
+		"6": 170805979, "7": 159345973, "8": 145138636, "9": 138394717, "10": 133797422,
+		"11": 135086622, "12": 133275309, "13": 114364328, "14": 107043718, "15": 101991189,
+		"16": 90338345, "17": 83257441, "18": 80373285, "19": 58617616, "20": 64444167,
+		"21": 46709983, "22": 50818468, "X": 156040895, "Y": 57227415, "M": 16569,
+	},
+}
+
+var actions = map[string]struct{}{
+	"add":    {},
+	"remove": {},
+}
+
 var classes = map[string]struct{}{
 	"gene":       {},
 	"transcript": {},
@@ -33,8 +58,41 @@ var classes = map[string]struct{}{
 	"region":     {},
 }
 
+var exonModes = map[string]struct{}{
+	"cds":     {},
+	"cds_utr": {},
+	"full":    {},
+}
+
+var transcriptPolicies = map[string]struct{}{
+	"all":                {},
+	"canonical":          {},
+	"mane_plus_clinical": {},
+	"mane_select":        {},
+	"pinned":             {},
+}
+
+var transcriptTags = map[string]struct{}{
+	"Ensembl_canonical":  {},
+	"MANE_Plus_Clinical": {},
+	"MANE_Select":        {},
+}
+
+// Padding of genes, transcripts and exons unless a rule overrides it
+var defaultPadding = map[string]int{
+	"cnv":    10,
+	"pindel": 50,
+	"snv":    10,
+	"sv":     50,
+}
+
+// Columns of the tables of the one table per gene list schema
+var legacyListColumns = []string{"id", "ensembl_id_38", "ensembl_id_37", "class", "chromosome", "start", "end", "cnv", "pindel", "snv", "sv"}
+
 var tsvHeader = map[string]bool{
+	"action":           false,
 	"analyses":         true,
+	"build":            false,
 	"class":            true,
 	"coordinates":      false,
 	"id":               true,
@@ -12,17 +12,29 @@ import (
 	"github.com/pkg/errors"
 )
 
-func (s *Session) initDbConnection() (err error) {
+func (s *Session) initDbConnection(ctx context.Context) (err error) {
+	switch s.Db.Driver {
+	case "postgres":
+		err = s.initPostgresConnection(ctx)
+	case "sqlite":
+		err = s.initSqliteConnection(ctx)
+	default:
+		err = errors.New(fmt.Sprintf("%s is not a supported database driver (postgres, sqlite)", s.Db.Driver))
+	}
+	return
+}
+
+func (s *Session) initPostgresConnection(ctx context.Context) (err error) {
 	var connection *sql.DB
 	if connection, err = sql.Open("postgres", getConnectionString()); err != nil {
 		err = errors.Wrap(err, fmt.Sprintf("Could not establish connection to database %s.", s.Db.Name))
 		return
 	}
-	if err = connection.Ping(); err != nil {
+	if err = connection.PingContext(ctx); err != nil {
 		err = errors.Wrap(err, fmt.Sprintf("Could not establish connection to database %s.", s.Db.Name))
 
 	}
-	s.Db.Connection = dbConnection{connection}
+	s.Db.Connection = dbConnection{db: connection}
 	return
 }
 
@@ -30,43 +42,141 @@ func getConnectionString() string {
 	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", session.Db.Host, session.Db.Port, session.Db.User, session.Db.Password, session.Db.Name)
 }
 
-func ensureTableExists(table string) (err error) {
-	if session.Db.Connection.checkTableExists(table) {
+func (d dbConnection) conn() queryer {
+	if d.tx != nil {
+		return d.tx
+	}
+	return d.db
+}
+
+func (d dbConnection) begin(ctx context.Context) (tx DbConnection, err error) {
+	var sqlTx *sql.Tx
+	if sqlTx, err = d.db.BeginTx(ctx, nil); err != nil {
+		err = errors.Wrap(err, "Could not start transaction")
+		return
+	}
+	tx = dbConnection{d.db, sqlTx}
+	return
+}
+
+func (d dbConnection) commit() (err error) {
+	if d.tx == nil {
+		err = errors.New("No transaction to commit")
+		return
+	}
+	err = d.tx.Commit()
+	return
+}
+
+func (d dbConnection) rollback() (err error) {
+	if d.tx == nil {
+		err = errors.New("No transaction to roll back")
+		return
+	}
+	err = d.tx.Rollback()
+	return
+}
+
+func inTransaction(ctx context.Context, fn func() error) (err error) {
+	connection := session.Db.Connection
+	tx, err := connection.begin(ctx)
+	if err != nil {
 		return
-	} else if err = session.Db.Connection.createTable(table); err != nil {
-		err = errors.Wrap(err, fmt.Sprintf("Could not create table %s", table))
+	}
+	session.Db.Connection = tx
+	defer func() {
+		session.Db.Connection = connection
+	}()
+	if err = fn(); err != nil {
+		// A cancelled context already rolled back the transaction
+		if rollbackErr := tx.rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			log.Printf("Could not roll back transaction: %v", rollbackErr)
+		} else {
+			log.Printf("All changes to database %s were rolled back.", session.Db.Name)
+		}
 		return
 	}
+	if err = tx.commit(); err != nil {
+		err = errors.Wrap(err, "Could not commit transaction")
+	}
 	return
 }
 
-func (d dbConnection) checkTableExists(table string) (exists bool) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func ensureListExists(ctx context.Context, list string) (err error) {
+	if err = validateListName(list); err != nil {
+		return
+	}
+	if session.Db.Connection.checkListExists(ctx, list) {
+		return
+	} else if err = session.Db.Connection.createList(ctx, list); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not create list %s", list))
+		return
+	}
+	return
+}
+
+func validateListName(list string) (err error) {
+	if err = validateIdentifier(list); err != nil {
+		err = errors.Wrap(err, "Invalid list name")
+	}
+	return
+}
+
+func (d dbConnection) checkTableExists(ctx context.Context, table string) (exists bool) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
 	defer cancel()
-	rows, err := d.db.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM "%s"`, table))
+	rows, err := d.conn().QueryContext(ctx, `SELECT EXISTS (SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_name = $1);`, table)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
-	exists = true
+	for rows.Next() {
+		err = rows.Scan(&exists)
+		if err != nil {
+			return
+		}
+	}
 	return
 }
 
-func (d dbConnection) createTable(table string) (err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (d dbConnection) checkListExists(ctx context.Context, list string) (exists bool) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	rows, err := d.conn().QueryContext(ctx, `SELECT EXISTS (SELECT name FROM lists WHERE name = $1);`, list)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err = rows.Scan(&exists)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (d dbConnection) createList(ctx context.Context, list string) (err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
 	defer cancel()
-	query := fmt.Sprintf(`CREATE TABLE "%s" (id varchar(20) NOT NULL, ensembl_id_38 varchar(20) NOT NULL, ensembl_id_37 varchar(20) NOT NULL, class varchar(10) NOT NULL, chromosome varchar(2) NOT NULL, start varchar(10) NOT NULL, "end" varchar(10) NOT NULL, %s boolean, PRIMARY KEY (id));`, table, strings.Join(getAnalyses(analyses), " boolean, "))
 	var stmt *sql.Stmt
-	stmt, err = d.db.PrepareContext(ctx, query)
+	stmt, err = d.conn().PrepareContext(ctx, `INSERT INTO lists (name) VALUES ($1);`)
 	if err != nil {
 		return
 	}
 	defer stmt.Close()
-	_, err = stmt.ExecContext(ctx)
+	_, err = stmt.ExecContext(ctx, list)
 	if err != nil {
 		return
 	}
-	log.Println(fmt.Sprintf("Table %s was added to database %s.", table, session.Db.Name))
+	var entry AuditEntry
+	if entry, err = newAuditEntry("create_list", list, "", nil, map[string]string{"name": list}); err != nil {
+		return
+	}
+	if err = d.addAuditEntry(ctx, entry); err != nil {
+		return
+	}
+	log.Printf("List %s was added to database %s.", list, session.Db.Name)
 	return
 }
 
@@ -78,10 +188,10 @@ func getAnalyses(analyses map[string]struct{}) (analysesSlice []string) {
 	return
 }
 
-func (d dbConnection) checkRegionExists(table string, region DbTableRow) (exists bool) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (d dbConnection) checkRegionExists(ctx context.Context, region DbTableRow) (exists bool) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
 	defer cancel()
-	rows, err := d.db.QueryContext(ctx, fmt.Sprintf(`SELECT EXISTS (SELECT id FROM "%s" WHERE id = '%s');`, table, region.Id))
+	rows, err := d.conn().QueryContext(ctx, `SELECT EXISTS (SELECT id FROM regions WHERE id = $1);`, region.Id)
 	if err != nil {
 		return
 	}
@@ -95,40 +205,199 @@ func (d dbConnection) checkRegionExists(table string, region DbTableRow) (exists
 	return
 }
 
-func (d dbConnection) updateRow(table string, region DbTableRow) (err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (d dbConnection) updateRow(ctx context.Context, list string, region DbTableRow) (err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
 	defer cancel()
-	query := fmt.Sprintf(`UPDATE "%s" SET %s = true WHERE id = '%s';`, table, strings.Join(getAnalyses(region.Analyses), " = true, "), region.Id)
+	if err = validateAnalysisColumns(region.Analyses); err != nil {
+		return
+	}
+	current, err := d.getListAnalyses(ctx, list, region)
+	if err != nil {
+		return
+	}
+	var added []string
+	for _, analysis := range getAnalyses(region.Analyses) {
+		if _, present := current[analysis]; !present {
+			added = append(added, analysis)
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
 	var stmt *sql.Stmt
-	stmt, err = d.db.PrepareContext(ctx, query)
+	stmt, err = d.conn().PrepareContext(ctx, `INSERT INTO list_regions (list, region_id, analysis) VALUES ($1, $2, $3) ON CONFLICT (list, region_id, analysis) DO UPDATE SET removed_at = NULL;`)
 	if err != nil {
 		return
 	}
 	defer stmt.Close()
-	_, err = stmt.ExecContext(ctx)
+	for _, analysis := range added {
+		_, err = stmt.ExecContext(ctx, list, region.Id, analysis)
+		if err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not add region %s to list %s", region.Id, list))
+			return
+		}
+	}
+	updated := make(map[string]struct{})
+	for analysis := range current {
+		updated[analysis] = struct{}{}
+	}
+	for _, analysis := range added {
+		updated[analysis] = struct{}{}
+	}
+	var entry AuditEntry
+	if entry, err = newAuditEntry("add_to_list", list, region.Id, auditMembership{getAnalyses(current)}, auditMembership{getAnalyses(updated)}); err != nil {
+		return
+	}
+	if err = d.addAuditEntry(ctx, entry); err != nil {
+		return
+	}
+	log.Printf("Region %s in list %s was updated (%s).", region.Id, list, strings.Join(added, ", "))
+	return
+}
+
+func (d dbConnection) removeRow(ctx context.Context, list string, region DbTableRow) (err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	if err = validateAnalysisColumns(region.Analyses); err != nil {
+		return
+	}
+	current, err := d.getListAnalyses(ctx, list, region)
 	if err != nil {
 		return
 	}
-	log.Printf("Region %s in table %s was updated.", region.Id, table)
+	if len(current) == 0 {
+		err = errors.New(fmt.Sprintf("Region %s is not part of list %s", region.Id, list))
+		return
+	}
+	var removed []string
+	for _, analysis := range getAnalyses(region.Analyses) {
+		if _, present := current[analysis]; present {
+			removed = append(removed, analysis)
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	var stmt *sql.Stmt
+	stmt, err = d.conn().PrepareContext(ctx, `UPDATE list_regions SET removed_at = $1 WHERE list = $2 AND region_id = $3 AND analysis = $4 AND removed_at IS NULL;`)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+	removedAt := time.Now().UTC()
+	updated := make(map[string]struct{})
+	for analysis := range current {
+		updated[analysis] = struct{}{}
+	}
+	for _, analysis := range removed {
+		_, err = stmt.ExecContext(ctx, removedAt, list, region.Id, analysis)
+		if err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not remove region %s from list %s", region.Id, list))
+			return
+		}
+		delete(updated, analysis)
+	}
+	var entry AuditEntry
+	if entry, err = newAuditEntry("remove_from_list", list, region.Id, auditMembership{getAnalyses(current)}, auditMembership{getAnalyses(updated)}); err != nil {
+		return
+	}
+	if err = d.addAuditEntry(ctx, entry); err != nil {
+		return
+	}
+	log.Printf("Region %s in list %s was removed (%s).", region.Id, list, strings.Join(removed, ", "))
 	return
 }
 
-func (d dbConnection) addNewRow(table string, region DbTableRow) (err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (d dbConnection) getListAnalyses(ctx context.Context, list string, region DbTableRow) (current map[string]struct{}, err error) {
+	rows, err := d.conn().QueryContext(ctx, `SELECT analysis FROM list_regions WHERE list = $1 AND region_id = $2 AND removed_at IS NULL;`, list, region.Id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	current = make(map[string]struct{})
+	var analysis string
+	for rows.Next() {
+		if err = rows.Scan(&analysis); err != nil {
+			return
+		}
+		current[analysis] = struct{}{}
+	}
+	return
+}
+
+func validateAnalysisColumns(columns map[string]struct{}) (err error) {
+	if len(columns) == 0 {
+		err = errors.New("No analysis was selected")
+		return
+	}
+	for column := range columns {
+		if _, valid := analyses[column]; !valid {
+			err = errors.New(fmt.Sprintf("%s is not a valid analysis", column))
+			return
+		}
+	}
+	return
+}
+
+func (d dbConnection) addNewRow(ctx context.Context, region DbTableRow) (err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
 	defer cancel()
-	query := fmt.Sprintf(`INSERT INTO "%s" (id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end", cnv, pindel, snv, sv) VALUES ('%s', '%s', '%s', '%s', '%s', '%s', '%s', %t, %t, %t, %t)`, table, region.Id, region.EnsemblId38, region.EnsemblId37, region.Class, region.Chromosome, region.Start, region.End, region.getAnalysis("cnv"), region.getAnalysis("pindel"), region.getAnalysis("snv"), region.getAnalysis("sv"))
 	var stmt *sql.Stmt
-	stmt, err = d.db.PrepareContext(ctx, query)
+	stmt, err = d.conn().PrepareContext(ctx, `INSERT INTO regions (id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end", build) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`)
 	if err != nil {
 		return
 	}
 	defer stmt.Close()
-	_, err = stmt.ExecContext(ctx)
+	_, err = stmt.ExecContext(ctx, region.Id, region.EnsemblId38, region.EnsemblId37, region.Class, region.Chromosome, region.Start, region.End, region.Build)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not add region %s", region.Id))
+		return
+	}
+	if err = d.addCoordinates(ctx, region); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not add coordinates of region %s", region.Id))
+		return
+	}
+	var entry AuditEntry
+	if entry, err = newAuditEntry("add_region", "", region.Id, nil, region.getAuditRegion()); err != nil {
+		return
+	}
+	if err = d.addAuditEntry(ctx, entry); err != nil {
+		return
+	}
+	log.Printf("Region %s was added to database %s.", region.Id, session.Db.Name)
+	return
+}
+
+func (d dbConnection) addCoordinates(ctx context.Context, region DbTableRow) (err error) {
+	if len(region.Coordinates) == 0 {
+		return
+	}
+	var stmt *sql.Stmt
+	stmt, err = d.conn().PrepareContext(ctx, `INSERT INTO region_coordinates (region_id, build, chromosome, start, "end", ensembl_release, strand) VALUES ($1, $2, $3, $4, $5, $6, $7);`)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+	var exonStmt *sql.Stmt
+	exonStmt, err = d.conn().PrepareContext(ctx, `INSERT INTO region_exons (region_id, build, transcript_id, exon_id, chromosome, start, "end", transcript_tags, transcript_biotype, coding_start, coding_end, strand) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) ON CONFLICT (region_id, build, transcript_id, exon_id) DO NOTHING;`)
 	if err != nil {
-		err = errors.Wrap(err, fmt.Sprintf("Could not add region %s to table %s", region.Id, table))
 		return
 	}
-	log.Printf("Region %s was added to table %s.", region.Id, table)
+	defer exonStmt.Close()
+	for _, build := range builds {
+		coordinates, present := region.Coordinates[build]
+		if !present {
+			continue
+		}
+		if _, err = stmt.ExecContext(ctx, region.Id, build, coordinates.Chromosome, coordinates.Start, coordinates.End, coordinates.Release, coordinates.Strand); err != nil {
+			return
+		}
+		for _, exon := range region.Exons[build] {
+			if _, err = exonStmt.ExecContext(ctx, region.Id, build, exon.Transcript, exon.EnsemblId, exon.Chromosome, exon.Start, exon.End, strings.Join(exon.Tags, ","), exon.Biotype, exon.CodingStart, exon.CodingEnd, exon.Strand); err != nil {
+				return
+			}
+		}
+	}
 	return
 }
 
@@ -137,53 +406,259 @@ func (d DbTableRow) getAnalysis(analysis string) (include bool) {
 	return
 }
 
-func (d dbConnection) getTables() (tables map[string]struct{}, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// getLegacyListTables finds tables of the one table per gene list schema by
+// their columns so that unrelated tables are left alone
+func (d dbConnection) getLegacyListTables(ctx context.Context) (tables map[string]struct{}, err error) {
+	args, placeholders := getLegacyColumnArgs()
+	err = d.queryTables(ctx, fmt.Sprintf(`SELECT table_name FROM information_schema.columns WHERE table_schema = 'public' AND column_name IN (%s) GROUP BY table_name HAVING COUNT(DISTINCT column_name) = %d;`, strings.Join(placeholders, ", "), len(args)), args, &tables)
+	return
+}
+
+func getLegacyColumnArgs() (args []interface{}, placeholders []string) {
+	for _, column := range legacyListColumns {
+		args = append(args, column)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	return
+}
+
+func (d dbConnection) queryTables(ctx context.Context, query string, args []interface{}, tables *map[string]struct{}) (err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
 	defer cancel()
-	rows, err := d.db.QueryContext(ctx, `SELECT table_name FROM information_schema.tables WHERE table_schema = 'public';`)
+	rows, err := d.conn().QueryContext(ctx, query, args...)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
 	var table string
-	tables = make(map[string]struct{})
+	*tables = make(map[string]struct{})
 	for rows.Next() {
 		err = rows.Scan(&table)
 		if err != nil {
 			return
 		}
-		tables[table] = struct{}{}
+		(*tables)[table] = struct{}{}
+	}
+	return
+}
+
+// getConflictingRegions lists region ids whose data differs between legacy
+// list tables or from an already normalized region
+func (d dbConnection) getConflictingRegions(ctx context.Context, tables []string) (ids []string, err error) {
+	var selects []string
+	for _, table := range tables {
+		var quotedTable string
+		if quotedTable, err = quoteIdentifier(table); err != nil {
+			return
+		}
+		selects = append(selects, fmt.Sprintf(`SELECT id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end" FROM %s`, quotedTable))
 	}
-	if len(tables) == 0 {
-		err = errors.New(fmt.Sprintf("Could not find any tables in %s", session.Db.Name))
+	if len(selects) == 0 {
+		return
+	}
+	if d.checkTableExists(ctx, "regions") {
+		selects = append(selects, `SELECT id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end" FROM regions`)
+	}
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	rows, err := d.conn().QueryContext(ctx, fmt.Sprintf(`SELECT id FROM (%s) r GROUP BY id HAVING COUNT(*) > 1 ORDER BY id;`, strings.Join(selects, " UNION ")))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+		ids = append(ids, id)
 	}
 	return
 }
 
-func (d dbConnection) getRegions() (regions []DbTableRow, err error) {
-	log.Printf("Retriewing %s gene list from %s", session.Analysis, strings.Join(session.Tables, ", "))
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (d dbConnection) getLists(ctx context.Context) (lists map[string]struct{}, err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
 	defer cancel()
-	var tableQueries []string
-	for _, table := range session.Tables {
-		tableQueries = append(tableQueries, fmt.Sprintf(`SELECT id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end" FROM "%s" WHERE %s = true`, table, session.Analysis))
+	rows, err := d.conn().QueryContext(ctx, `SELECT name FROM lists;`)
+	if err != nil {
+		return
 	}
-	query := fmt.Sprintf("%s;", strings.Join(tableQueries, " UNION "))
-	rows, err := d.db.QueryContext(ctx, query)
+	defer rows.Close()
+	var list string
+	lists = make(map[string]struct{})
+	for rows.Next() {
+		err = rows.Scan(&list)
+		if err != nil {
+			return
+		}
+		lists[list] = struct{}{}
+	}
+	if len(lists) == 0 {
+		err = errors.New(fmt.Sprintf("Could not find any lists in %s", session.Db.Name))
+	}
+	return
+}
+
+// getRegions retrieves the regions of all analyses at once, recording which
+// analyses each region belongs to
+func (d dbConnection) getRegions(ctx context.Context, selected []string) (regions []DbTableRow, err error) {
+	log.Printf("Retriewing %s gene list from %s", strings.Join(selected, ", "), strings.Join(session.Tables, ", "))
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	args := []interface{}{session.Build}
+	var analysisPlaceholders, listPlaceholders []string
+	for _, analysis := range selected {
+		if _, valid := analyses[analysis]; !valid {
+			err = errors.New(fmt.Sprintf("%s is not a valid analysis", analysis))
+			return
+		}
+		args = append(args, analysis)
+		analysisPlaceholders = append(analysisPlaceholders, fmt.Sprintf("$%d", len(args)))
+	}
+	for _, list := range session.Tables {
+		args = append(args, list)
+		listPlaceholders = append(listPlaceholders, fmt.Sprintf("$%d", len(args)))
+	}
+	query := fmt.Sprintf(`SELECT DISTINCT r.id, r.ensembl_id_38, r.ensembl_id_37, r.class, r.chromosome, r.start, r."end", r.build, c.chromosome, c.start, c."end", c.ensembl_release, c.strand, l.analysis FROM regions r JOIN list_regions l ON l.region_id = r.id LEFT JOIN region_coordinates c ON c.region_id = r.id AND c.build = $1 WHERE l.analysis IN (%s) AND l.removed_at IS NULL AND l.list IN (%s) ORDER BY r.id, l.analysis;`, strings.Join(analysisPlaceholders, ", "), strings.Join(listPlaceholders, ", "))
+	rows, err := d.conn().QueryContext(ctx, query, args...)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
-	var region DbTableRow
 	for rows.Next() {
-		err = rows.Scan(&region.Id, &region.EnsemblId38, &region.EnsemblId37, &region.Class, &region.Chromosome, &region.Start, &region.End)
+		var region DbTableRow
+		var analysis string
+		var chromosome, release sql.NullString
+		var start, end, strand sql.NullInt64
+		err = rows.Scan(&region.Id, &region.EnsemblId38, &region.EnsemblId37, &region.Class, &region.Chromosome, &region.Start, &region.End, &region.Build, &chromosome, &start, &end, &release, &strand, &analysis)
 		if err != nil {
 			return
 		}
+		if last := len(regions) - 1; last >= 0 && regions[last].Id == region.Id {
+			regions[last].Analyses[analysis] = struct{}{}
+			continue
+		}
+		region.Analyses = map[string]struct{}{analysis: {}}
+		if chromosome.Valid {
+			region.Coordinates = map[string]EnsemblBaseObj{
+				session.Build: {
+					Chromosome: chromosome.String,
+					End:        int(end.Int64),
+					EnsemblId:  region.getBuildEnsemblId(session.Build),
+					Release:    release.String,
+					Start:      int(start.Int64),
+					Strand:     int(strand.Int64),
+				},
+			}
+		}
 		regions = append(regions, region)
 	}
 	if len(regions) == 0 {
-		err = errors.New(fmt.Sprintf("Could not find any data for %s in table %s", session.Analysis, strings.Join(session.Tables, ", ")))
+		err = errors.New(fmt.Sprintf("Could not find any data for %s in list %s", strings.Join(selected, ", "), strings.Join(session.Tables, ", ")))
+		return
+	}
+	err = d.getExons(ctx, regions)
+	return
+}
+
+func (d dbConnection) getExons(ctx context.Context, regions []DbTableRow) (err error) {
+	args := []interface{}{session.Build}
+	var placeholders []string
+	index := make(map[string]int)
+	for i, region := range regions {
+		if region.Coordinates == nil || region.Class == "region" || region.Class == "exon" {
+			continue
+		}
+		index[region.Id] = i
+		args = append(args, region.Id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	if len(placeholders) == 0 {
+		return
+	}
+	query := fmt.Sprintf(`SELECT region_id, transcript_id, exon_id, chromosome, start, "end", transcript_tags, transcript_biotype, coding_start, coding_end, strand FROM region_exons WHERE build = $1 AND region_id IN (%s) ORDER BY region_id, transcript_id, start;`, strings.Join(placeholders, ", "))
+	rows, err := d.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, tags string
+		var exon EnsemblBaseObj
+		if err = rows.Scan(&id, &exon.Transcript, &exon.EnsemblId, &exon.Chromosome, &exon.Start, &exon.End, &tags, &exon.Biotype, &exon.CodingStart, &exon.CodingEnd, &exon.Strand); err != nil {
+			return
+		}
+		exon.Tags = splitTags(tags)
+		region := &regions[index[id]]
+		if region.Exons == nil {
+			region.Exons = make(map[string][]EnsemblBaseObj)
+		}
+		region.Exons[session.Build] = append(region.Exons[session.Build], exon)
+	}
+	return
+}
+
+func (d dbConnection) createMigrationTable(ctx context.Context) (err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	var stmt *sql.Stmt
+	stmt, err = d.conn().PrepareContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version integer NOT NULL, name varchar(100) NOT NULL, applied_at timestamptz NOT NULL DEFAULT now(), PRIMARY KEY (version));`)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx)
+	return
+}
+
+func (d dbConnection) getAppliedMigrations(ctx context.Context) (applied map[int]string, err error) {
+	applied = make(map[int]string)
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	rows, err := d.conn().QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations ORDER BY version;`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	var version int
+	var appliedAt time.Time
+	for rows.Next() {
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return
+		}
+		applied[version] = appliedAt.Format(time.RFC3339)
+	}
+	return
+}
+
+func (d dbConnection) getMigrations() []migration {
+	return postgresMigrations
+}
+
+// applyMigration runs all statements of a migration within the migration
+// timeout, as copying data can take much longer than a single query
+func (d dbConnection) applyMigration(ctx context.Context, m migration, statements []string) (err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.MigrationTimeout)
+	defer cancel()
+	var tx *sql.Tx
+	if tx, err = d.db.BeginTx(ctx, nil); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	for _, statement := range statements {
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not execute %s", statement))
+			return
+		}
+	}
+	if _, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`, m.Version, m.Name); err != nil {
+		return
 	}
+	err = tx.Commit()
 	return
 }
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+)
+
+var sqliteMigrations = []migration{
+	{
+		Version:    1,
+		Name:       "widen_list_columns",
+		Statements: noStatements,
+	},
+	{
+		Version:    2,
+		Name:       "normalize_lists",
+		Statements: sqliteNormalizeLists,
+	},
+	{
+		Version:    3,
+		Name:       "store_coordinates",
+		Statements: storeCoordinates,
+	},
+	{
+		Version:    4,
+		Name:       "add_audit_log",
+		Statements: sqliteAddAuditLog,
+	},
+	{
+		Version:    5,
+		Name:       "add_releases",
+		Statements: sqliteAddReleases,
+	},
+	{
+		Version:    6,
+		Name:       "soft_delete_list_regions",
+		Statements: sqliteSoftDeleteListRegions,
+	},
+	{
+		Version:    7,
+		Name:       "add_transcript_tags",
+		Statements: addTranscriptTags,
+	},
+	{
+		Version:    8,
+		Name:       "record_ensembl_release",
+		Statements: recordEnsemblRelease,
+	},
+	{
+		Version:    9,
+		Name:       "add_region_build",
+		Statements: addRegionBuild,
+	},
+	{
+		Version:    10,
+		Name:       "add_coding_regions",
+		Statements: addCodingRegions,
+	},
+	{
+		Version:    11,
+		Name:       "add_padding_rules",
+		Statements: addPaddingRules,
+	},
+	{
+		Version:    12,
+		Name:       "add_strand",
+		Statements: addStrand,
+	},
+	{
+		Version:    13,
+		Name:       "add_release_padding",
+		Statements: sqliteAddReleasePadding,
+	},
+}
+
+func (s *Session) initSqliteConnection(ctx context.Context) (err error) {
+	var connection *sql.DB
+	if connection, err = sql.Open("sqlite", getSqliteDataSource()); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not open database %s.", s.Db.Path))
+		return
+	}
+	// SQLite allows a single writer only
+	connection.SetMaxOpenConns(1)
+	if err = connection.PingContext(ctx); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not open database %s.", s.Db.Path))
+	}
+	s.Db.Connection = sqliteConnection{dbConnection{db: connection}}
+	return
+}
+
+func getSqliteDataSource() string {
+	return fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", session.Db.Path)
+}
+
+func noStatements(tables map[string]struct{}) (statements []string, err error) {
+	return
+}
+
+func sqliteNormalizeLists(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`CREATE TABLE IF NOT EXISTS regions (id varchar(64) NOT NULL, ensembl_id_38 varchar(32) NOT NULL, ensembl_id_37 varchar(32) NOT NULL, class varchar(10) NOT NULL, chromosome varchar(8) NOT NULL, start varchar(10) NOT NULL, "end" varchar(10) NOT NULL, PRIMARY KEY (id));`,
+		`CREATE TABLE IF NOT EXISTS lists (name varchar(63) NOT NULL, created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (name));`,
+		`CREATE TABLE IF NOT EXISTS list_regions (list varchar(63) NOT NULL REFERENCES lists (name), region_id varchar(64) NOT NULL REFERENCES regions (id), analysis varchar(10) NOT NULL, PRIMARY KEY (list, region_id, analysis));`,
+	}
+	return
+}
+
+func sqliteAddAuditLog(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`CREATE TABLE IF NOT EXISTS audit_log (id integer NOT NULL PRIMARY KEY AUTOINCREMENT, changed_at timestamp NOT NULL, changed_by varchar(64) NOT NULL, source_file text NOT NULL, source_checksum varchar(64) NOT NULL, action varchar(20) NOT NULL, list varchar(63) NOT NULL, region_id varchar(64) NOT NULL, old_value text NOT NULL, new_value text NOT NULL);`,
+		`CREATE INDEX IF NOT EXISTS audit_log_list_region ON audit_log (list, region_id);`,
+	}
+	return
+}
+
+func sqliteAddReleases(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`CREATE TABLE IF NOT EXISTS releases (list varchar(63) NOT NULL REFERENCES lists (name), version varchar(32) NOT NULL, notes text NOT NULL, created_at timestamp NOT NULL, created_by varchar(64) NOT NULL, PRIMARY KEY (list, version));`,
+		`CREATE TABLE IF NOT EXISTS release_regions (list varchar(63) NOT NULL, version varchar(32) NOT NULL, region_id varchar(64) NOT NULL, analysis varchar(10) NOT NULL, data text NOT NULL, PRIMARY KEY (list, version, region_id, analysis), FOREIGN KEY (list, version) REFERENCES releases (list, version));`,
+	}
+	for _, table := range []string{"releases", "release_regions"} {
+		for _, event := range []string{"UPDATE", "DELETE"} {
+			statements = append(statements, fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s_reject_%s BEFORE %s ON %s BEGIN SELECT RAISE(ABORT, 'releases are immutable'); END;`, table, strings.ToLower(event), event, table))
+		}
+	}
+	return
+}
+
+func sqliteAddReleasePadding(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`CREATE TABLE IF NOT EXISTS release_padding (list varchar(63) NOT NULL, version varchar(32) NOT NULL, analysis varchar(10) NOT NULL, class varchar(16) NOT NULL, size integer NOT NULL, PRIMARY KEY (list, version, analysis, class), FOREIGN KEY (list, version) REFERENCES releases (list, version));`,
+	}
+	for _, event := range []string{"UPDATE", "DELETE"} {
+		statements = append(statements, fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS release_padding_reject_%s BEFORE %s ON release_padding BEGIN SELECT RAISE(ABORT, 'releases are immutable'); END;`, strings.ToLower(event), event))
+	}
+	return
+}
+
+func sqliteSoftDeleteListRegions(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`ALTER TABLE list_regions ADD COLUMN removed_at timestamp;`,
+	}
+	return
+}
+
+func (d sqliteConnection) begin(ctx context.Context) (tx DbConnection, err error) {
+	var sqlTx DbConnection
+	if sqlTx, err = d.dbConnection.begin(ctx); err != nil {
+		return
+	}
+	tx = sqliteConnection{sqlTx.(dbConnection)}
+	return
+}
+
+func (d sqliteConnection) checkTableExists(ctx context.Context, table string) (exists bool) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	rows, err := d.conn().QueryContext(ctx, `SELECT EXISTS (SELECT name FROM sqlite_master WHERE type = 'table' AND name = $1);`, table)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err = rows.Scan(&exists)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (d sqliteConnection) getLegacyListTables(ctx context.Context) (tables map[string]struct{}, err error) {
+	args, placeholders := getLegacyColumnArgs()
+	err = d.queryTables(ctx, fmt.Sprintf(`SELECT m.name FROM sqlite_master m JOIN pragma_table_info(m.name) p WHERE m.type = 'table' AND p.name IN (%s) GROUP BY m.name HAVING COUNT(DISTINCT p.name) = %d;`, strings.Join(placeholders, ", "), len(args)), args, &tables)
+	return
+}
+
+func (d sqliteConnection) createMigrationTable(ctx context.Context) (err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	var stmt *sql.Stmt
+	stmt, err = d.conn().PrepareContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version integer NOT NULL, name varchar(100) NOT NULL, applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (version));`)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx)
+	return
+}
+
+func (d sqliteConnection) getMigrations() []migration {
+	return sqliteMigrations
+}
@@ -0,0 +1,432 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func getSqliteDb(t *testing.T, migrate bool) {
+	session = Session{
+		Db: database{
+			Driver: "sqlite",
+			Path:   filepath.Join(t.TempDir(), "gene_list.db"),
+		},
+	}
+	if err := session.initDbConnection(context.Background()); err != nil {
+		log.Fatalf(fmt.Sprintf("Could not create sqlite database. Got Error\n%v", err))
+	}
+	if migrate {
+		if err := migrateUp(context.Background(), false); err != nil {
+			log.Fatalf(fmt.Sprintf("Could not migrate sqlite database. Got Error\n%v", err))
+		}
+	}
+}
+
+// addTestRow ingests a row into lists the way update does
+func addTestRow(t *testing.T, row DbTableRow, lists ...string) {
+	row.Tables = lists
+	rows, err := row.resolveRows(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = row.addToDb(context.Background(), rows); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSqliteMigrations(t *testing.T) {
+	var cases = map[string]struct {
+		migrate bool
+		wantErr bool
+	}{
+		"Schema is up to date": {
+			true,
+			false,
+		},
+		"Schema is outdated": {
+			false,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, c.migrate)
+			err := checkSchemaVersion(context.Background())
+			checkError(t, err, c.wantErr)
+		})
+	}
+}
+
+func TestSqliteGetLegacyListTables(t *testing.T) {
+	var cases = map[string]struct {
+		tables []string
+		result map[string]struct{}
+	}{
+		"Only normalized schema": {
+			nil,
+			map[string]struct{}{},
+		},
+		"Legacy list table next to unrelated table": {
+			[]string{
+				`CREATE TABLE aml (id varchar(64), ensembl_id_38 varchar(32), ensembl_id_37 varchar(32), class varchar(10), chromosome varchar(8), start varchar(10), "end" varchar(10), cnv boolean, pindel boolean, snv boolean, sv boolean);`,
+				`CREATE TABLE notes (id varchar(64), class varchar(10), text text);`,
+			},
+			map[string]struct{}{
+				"aml": {},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, true)
+			connection := session.Db.Connection.(sqliteConnection)
+			for _, statement := range c.tables {
+				if _, err := connection.db.ExecContext(context.Background(), statement); err != nil {
+					t.Fatal(err)
+				}
+			}
+			result, err := session.Db.Connection.getLegacyListTables(context.Background())
+			checkError(t, err, false)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSqliteAddAndGetRegions(t *testing.T) {
+	var cases = map[string]struct {
+		rows     []DbTableRow
+		analyses []string
+		tables   []string
+		result   []DbTableRow
+		wantErr  bool
+	}{
+		"Region is stored once for several lists": {
+			[]DbTableRow{
+				{
+					Analyses: map[string]struct{}{
+						"snv": {},
+						"cnv": {},
+					},
+					Chromosome: "1",
+					Class:      "region",
+					End:        "200",
+					Id:         "REGION1",
+					Start:      "100",
+					Tables:     []string{"aml", "all"},
+				},
+			},
+			[]string{"snv", "cnv"},
+			[]string{"aml", "all"},
+			[]DbTableRow{
+				{
+					Analyses: map[string]struct{}{
+						"cnv": {},
+						"snv": {},
+					},
+					Chromosome: "1",
+					Class:      "region",
+					End:        "200",
+					Id:         "REGION1",
+					Start:      "100",
+				},
+			},
+			false,
+		},
+		"Analysis is not part of list": {
+			[]DbTableRow{
+				{
+					Analyses: map[string]struct{}{
+						"cnv": {},
+					},
+					Chromosome: "1",
+					Class:      "region",
+					End:        "200",
+					Id:         "REGION1",
+					Start:      "100",
+					Tables:     []string{"aml"},
+				},
+			},
+			[]string{"sv"},
+			[]string{"aml"},
+			nil,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, true)
+			for _, row := range c.rows {
+				addTestRow(t, row, row.Tables...)
+			}
+			lists, err := session.Db.Connection.getLists(context.Background())
+			checkError(t, err, false)
+			for _, list := range c.tables {
+				if _, present := lists[list]; !present {
+					t.Errorf("List %s is missing", list)
+				}
+			}
+			session.Tables = c.tables
+			result, err := session.Db.Connection.getRegions(context.Background(), c.analyses)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSqliteStoredCoordinates(t *testing.T) {
+	var cases = map[string]struct {
+		row    DbTableRow
+		build  string
+		result DbTableRow
+	}{
+		"Coordinates of requested build are returned": {
+			DbTableRow{
+				Class: "gene",
+				Coordinates: map[string]EnsemblBaseObj{
+					"37": {Chromosome: "1", Start: 50, End: 150},
+					"38": {Chromosome: "1", Start: 100, End: 200},
+				},
+				EnsemblId37: "ENSG001",
+				EnsemblId38: "ENSG001",
+				Exons: map[string][]EnsemblBaseObj{
+					"37": {
+						{Chromosome: "1", Start: 50, End: 80, EnsemblId: "ENSE001", Transcript: "ENST001"},
+					},
+					"38": {
+						{Chromosome: "1", Start: 100, End: 130, EnsemblId: "ENSE001", Transcript: "ENST001"},
+						{Chromosome: "1", Start: 170, End: 200, EnsemblId: "ENSE002", Transcript: "ENST001"},
+					},
+				},
+				Id: "GENE1",
+			},
+			"38",
+			DbTableRow{
+				Class: "gene",
+				Coordinates: map[string]EnsemblBaseObj{
+					"38": {Chromosome: "1", Start: 100, End: 200, EnsemblId: "ENSG001"},
+				},
+				EnsemblId37: "ENSG001",
+				EnsemblId38: "ENSG001",
+				Exons: map[string][]EnsemblBaseObj{
+					"38": {
+						{Chromosome: "1", Start: 100, End: 130, EnsemblId: "ENSE001", Transcript: "ENST001"},
+						{Chromosome: "1", Start: 170, End: 200, EnsemblId: "ENSE002", Transcript: "ENST001"},
+					},
+				},
+				Id: "GENE1",
+			},
+		},
+		"Ensembl release is kept": {
+			DbTableRow{
+				Class: "gene",
+				Coordinates: map[string]EnsemblBaseObj{
+					"38": {Chromosome: "1", Start: 100, End: 200, Release: "110"},
+				},
+				EnsemblId38: "ENSG001",
+				Id:          "GENE1",
+			},
+			"38",
+			DbTableRow{
+				Class: "gene",
+				Coordinates: map[string]EnsemblBaseObj{
+					"38": {Chromosome: "1", Start: 100, End: 200, EnsemblId: "ENSG001", Release: "110"},
+				},
+				EnsemblId38: "ENSG001",
+				Id:          "GENE1",
+			},
+		},
+		"Transcript tags are kept": {
+			DbTableRow{
+				Class: "gene",
+				Coordinates: map[string]EnsemblBaseObj{
+					"38": {Chromosome: "1", Start: 100, End: 200},
+				},
+				EnsemblId38: "ENSG001",
+				Exons: map[string][]EnsemblBaseObj{
+					"38": {
+						{Chromosome: "1", Start: 100, End: 130, EnsemblId: "ENSE001", Tags: []string{"Ensembl_canonical", "MANE_Select"}, Transcript: "ENST001"},
+						{Chromosome: "1", Start: 100, End: 130, EnsemblId: "ENSE001", Transcript: "ENST002"},
+					},
+				},
+				Id: "GENE1",
+			},
+			"38",
+			DbTableRow{
+				Class: "gene",
+				Coordinates: map[string]EnsemblBaseObj{
+					"38": {Chromosome: "1", Start: 100, End: 200, EnsemblId: "ENSG001"},
+				},
+				EnsemblId38: "ENSG001",
+				Exons: map[string][]EnsemblBaseObj{
+					"38": {
+						{Chromosome: "1", Start: 100, End: 130, EnsemblId: "ENSE001", Tags: []string{"Ensembl_canonical", "MANE_Select"}, Transcript: "ENST001"},
+						{Chromosome: "1", Start: 100, End: 130, EnsemblId: "ENSE001", Transcript: "ENST002"},
+					},
+				},
+				Id: "GENE1",
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, true)
+			c.row.Analyses = map[string]struct{}{"snv": {}}
+			c.result.Analyses = c.row.Analyses
+			if err := ensureListExists(context.Background(), "aml"); err != nil {
+				t.Fatal(err)
+			}
+			if err := session.Db.Connection.addNewRow(context.Background(), c.row); err != nil {
+				t.Fatal(err)
+			}
+			if err := session.Db.Connection.updateRow(context.Background(), "aml", c.row); err != nil {
+				t.Fatal(err)
+			}
+			session.Build = c.build
+			session.Tables = []string{"aml"}
+			result, err := session.Db.Connection.getRegions(context.Background(), []string{"snv"})
+			checkError(t, err, false)
+			if diff := deep.Equal(result, []DbTableRow{c.result}); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSqliteRemoveRow(t *testing.T) {
+	var cases = map[string]struct {
+		removed DbTableRow
+		readded bool
+		result  []DbTableRow
+		wantErr bool
+		actions []string
+	}{
+		"Analysis is removed from list": {
+			DbTableRow{
+				Analyses: map[string]struct{}{"snv": {}},
+				Id:       "REGION1",
+			},
+			false,
+			nil,
+			false,
+			[]string{"add_to_list", "remove_from_list"},
+		},
+		"Region is added again after removal": {
+			DbTableRow{
+				Analyses: map[string]struct{}{"snv": {}, "cnv": {}},
+				Id:       "REGION1",
+			},
+			true,
+			[]DbTableRow{
+				{
+					Analyses:   map[string]struct{}{"snv": {}},
+					Chromosome: "1",
+					Class:      "region",
+					End:        "200",
+					Id:         "REGION1",
+					Start:      "100",
+				},
+			},
+			false,
+			[]string{"add_to_list", "remove_from_list", "add_to_list"},
+		},
+		"Region is not part of list": {
+			DbTableRow{
+				Analyses: map[string]struct{}{"snv": {}},
+				Id:       "REGION2",
+			},
+			false,
+			[]DbTableRow{
+				{
+					Analyses:   map[string]struct{}{"snv": {}},
+					Chromosome: "1",
+					Class:      "region",
+					End:        "200",
+					Id:         "REGION1",
+					Start:      "100",
+				},
+			},
+			true,
+			[]string{"add_to_list"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, true)
+			row := DbTableRow{
+				Analyses:   map[string]struct{}{"snv": {}, "cnv": {}},
+				Chromosome: "1",
+				Class:      "region",
+				End:        "200",
+				Id:         "REGION1",
+				Start:      "100",
+			}
+			addTestRow(t, row, "aml")
+			err := session.Db.Connection.removeRow(context.Background(), "aml", c.removed)
+			checkError(t, err, c.wantErr)
+			if c.readded {
+				addTestRow(t, row, "aml")
+			}
+			session.Tables = []string{"aml"}
+			result, _ := session.Db.Connection.getRegions(context.Background(), []string{"snv"})
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+			entries, err := session.Db.Connection.getHistory(context.Background(), HistoryFilter{List: "aml", RegionId: "REGION1"})
+			checkError(t, err, false)
+			var actions []string
+			for _, entry := range entries {
+				actions = append(actions, entry.Action)
+			}
+			if diff := deep.Equal(actions, c.actions); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSqliteCancelledTransaction(t *testing.T) {
+	var cases = map[string]struct {
+		cancelled bool
+		wantErr   bool
+	}{
+		"Changes are committed": {
+			false,
+			false,
+		},
+		"Changes are rolled back on cancel": {
+			true,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, true)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err := inTransaction(ctx, func() (err error) {
+				if err = ensureListExists(ctx, "aml"); err != nil {
+					return
+				}
+				if c.cancelled {
+					cancel()
+				}
+				err = ensureListExists(ctx, "all")
+				return
+			})
+			checkError(t, err, c.wantErr)
+			exists := session.Db.Connection.checkListExists(context.Background(), "aml")
+			if exists == c.cancelled {
+				t.Errorf("List aml exists: %t, but transaction was cancelled: %t", exists, c.cancelled)
+			}
+		})
+	}
+}
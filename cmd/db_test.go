@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-test/deep"
@@ -28,45 +30,142 @@ func getMockDb(route string) {
 		},
 	}
 	switch route {
+	case "addToList":
+		current := sqlmock.NewRows([]string{"analysis"}).AddRow("cnv")
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT analysis FROM list_regions WHERE list = $1 AND region_id = $2 AND removed_at IS NULL;`)).WithArgs("aml", "GENE1").WillReturnRows(current)
+		prep := mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO list_regions (list, region_id, analysis) VALUES ($1, $2, $3) ON CONFLICT (list, region_id, analysis) DO UPDATE SET removed_at = NULL;`))
+		prep.ExpectExec().WithArgs("aml", "GENE1", "snv").WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAuditEntry(mock, "add_to_list")
+	case "cannotCreateNewList":
+		mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO lists (name) VALUES ($1);`)).WillReturnError(fmt.Errorf("Something went wrong"))
 	case "cannotCreateNewRow":
-		prep := mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO "existing_table" (id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end", cnv, pindel, snv, sv) VALUES ('GENE1', '', '', 'gene', '', '', '', true, false, true, false)`))
-		prep.ExpectExec().WithArgs().WillReturnError(fmt.Errorf("Something went wrong"))
-	case "cannotCreateNewTable":
-		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "nonexistent_table"`)).WillReturnError(fmt.Errorf("Something went wrong"))
+		prep := mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO regions (id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end", build) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`))
+		prep.ExpectExec().WithArgs("GENE1", "", "", "gene", "", "", "", "").WillReturnError(fmt.Errorf("Something went wrong"))
+	case "cannotGetLists":
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT name FROM lists;`)).WillReturnError(fmt.Errorf("Something went wrong"))
 	case "cannotGetRegions":
-		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end" FROM "test" WHERE snv = true;`)).WillReturnError(fmt.Errorf("Something went wrong"))
-	case "cannotGetTables":
-		mock.ExpectQuery(regexp.QuoteMeta(`SELECT table_name FROM information_schema.tables WHERE table_schema = 'public';`)).WillReturnError(fmt.Errorf("Something went wrong"))
-	case "checkAndCreateNewTable":
-		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "new_table"`)).WillReturnError(fmt.Errorf("Something went wrong"))
-		prep := mock.ExpectPrepare(regexp.QuoteMeta(`CREATE TABLE "new_table" (id varchar(20) NOT NULL, ensembl_id_38 varchar(20) NOT NULL, ensembl_id_37 varchar(20) NOT NULL, class varchar(10) NOT NULL, chromosome varchar(2) NOT NULL, start varchar(10) NOT NULL, "end" varchar(10) NOT NULL, cnv boolean, pindel boolean, snv boolean, sv boolean, PRIMARY KEY (id))`))
-		prep.ExpectExec().WithArgs().WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT r.id, r.ensembl_id_38, r.ensembl_id_37, r.class, r.chromosome, r.start, r."end", r.build, c.chromosome, c.start, c."end", c.ensembl_release, c.strand, l.analysis FROM regions r JOIN list_regions l ON l.region_id = r.id LEFT JOIN region_coordinates c ON c.region_id = r.id AND c.build = $1 WHERE l.analysis IN ($2) AND l.removed_at IS NULL AND l.list IN ($3) ORDER BY r.id, l.analysis;`)).WithArgs("38", "snv", "test").WillReturnError(fmt.Errorf("Something went wrong"))
+	case "checkAndCreateNewList":
+		rows := sqlmock.NewRows([]string{"exists"}).AddRow(false)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT name FROM lists WHERE name = $1);`)).WithArgs("new_list").WillReturnRows(rows)
+		prep := mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO lists (name) VALUES ($1);`))
+		prep.ExpectExec().WithArgs("new_list").WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAuditEntry(mock, "create_list")
+	case "conflictingRegions":
+		expectRegionComparison(mock, sqlmock.NewRows([]string{"id"}).AddRow("GENE1"))
+	case "createNewList":
+		prep := mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO lists (name) VALUES ($1);`))
+		prep.ExpectExec().WithArgs("new_list").WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAuditEntry(mock, "create_list")
 	case "createNewRow":
-		prep := mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO "existing_table" (id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end", cnv, pindel, snv, sv) VALUES ('GENE1', '', '', 'gene', '', '', '', true, false, true, false)`))
-		prep.ExpectExec().WithArgs().WillReturnResult(sqlmock.NewResult(0, 1))
-	case "createNewTable":
-		prep := mock.ExpectPrepare(regexp.QuoteMeta(`CREATE TABLE "new_table" (id varchar(20) NOT NULL, ensembl_id_38 varchar(20) NOT NULL, ensembl_id_37 varchar(20) NOT NULL, class varchar(10) NOT NULL, chromosome varchar(2) NOT NULL, start varchar(10) NOT NULL, "end" varchar(10) NOT NULL, cnv boolean, pindel boolean, snv boolean, sv boolean, PRIMARY KEY (id))`))
-		prep.ExpectExec().WithArgs().WillReturnResult(sqlmock.NewResult(0, 0))
+		prep := mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO regions (id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end", build) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`))
+		prep.ExpectExec().WithArgs("GENE1", "", "", "gene", "", "", "", "").WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAuditEntry(mock, "add_region")
+	case "createNewRowWithQuote":
+		prep := mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO regions (id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end", build) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`))
+		prep.ExpectExec().WithArgs("GENE1'); DROP TABLE regions; --", "", "", "gene", "", "", "", "").WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAuditEntry(mock, "add_region")
 	case "default":
+	case "transactionCommit":
+		mock.ExpectBegin()
+		prep := mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO lists (name) VALUES ($1);`))
+		prep.ExpectExec().WithArgs("new_list").WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAuditEntry(mock, "create_list")
+		mock.ExpectCommit()
+	case "transactionRollback":
+		mock.ExpectBegin()
+		prep := mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO lists (name) VALUES ($1);`))
+		prep.ExpectExec().WithArgs("new_list").WillReturnError(fmt.Errorf("Something went wrong"))
+		mock.ExpectRollback()
+	case "getLists":
+		rows := sqlmock.NewRows([]string{"name"}).AddRow("test")
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT name FROM lists;`)).WillReturnRows(rows)
 	case "getRegions":
-		rows := sqlmock.NewRows([]string{"id", "ensembl_id_38", "ensembl_id_37", "class", "chromosome", "start", "end"}).AddRow("GENE1", "ENSG001", "ENSG001", "gene", "1", "1", "100")
-		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end" FROM "test" WHERE snv = true;`)).WillReturnRows(rows)
-	case "getTables":
-		rows := sqlmock.NewRows([]string{"table_name"}).AddRow("test")
-		mock.ExpectQuery(regexp.QuoteMeta(`SELECT table_name FROM information_schema.tables WHERE table_schema = 'public';`)).WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "ensembl_id_38", "ensembl_id_37", "class", "chromosome", "start", "end", "build", "chromosome", "start", "end", "ensembl_release", "strand", "analysis"}).AddRow("GENE1", "ENSG001", "ENSG001", "gene", "", "", "", "", "1", 1, 100, "110", -1, "snv").AddRow("REGION1", "", "", "region", "2", "10", "20", "38", nil, nil, nil, nil, nil, "snv")
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT r.id, r.ensembl_id_38, r.ensembl_id_37, r.class, r.chromosome, r.start, r."end", r.build, c.chromosome, c.start, c."end", c.ensembl_release, c.strand, l.analysis FROM regions r JOIN list_regions l ON l.region_id = r.id LEFT JOIN region_coordinates c ON c.region_id = r.id AND c.build = $1 WHERE l.analysis IN ($2) AND l.removed_at IS NULL AND l.list IN ($3) ORDER BY r.id, l.analysis;`)).WithArgs("38", "snv", "test").WillReturnRows(rows)
+		exons := sqlmock.NewRows([]string{"region_id", "transcript_id", "exon_id", "chromosome", "start", "end", "transcript_tags", "transcript_biotype", "coding_start", "coding_end", "strand"}).AddRow("GENE1", "ENST001", "ENSE001", "1", 1, 50, "", "protein_coding", 20, 50, -1)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT region_id, transcript_id, exon_id, chromosome, start, "end", transcript_tags, transcript_biotype, coding_start, coding_end, strand FROM region_exons WHERE build = $1 AND region_id IN ($2) ORDER BY region_id, transcript_id, start;`)).WithArgs("38", "GENE1").WillReturnRows(exons)
+	case "getLegacyListTables":
+		rows := sqlmock.NewRows([]string{"table_name"}).AddRow("aml").AddRow("all")
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT table_name FROM information_schema.columns WHERE table_schema = 'public' AND column_name IN ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) GROUP BY table_name HAVING COUNT(DISTINCT column_name) = 11;`)).WillReturnRows(rows)
+	case "identicalRegions":
+		expectRegionComparison(mock, sqlmock.NewRows([]string{"id"}))
+	case "listExists":
+		rows := sqlmock.NewRows([]string{"exists"}).AddRow(true)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT name FROM lists WHERE name = $1);`)).WithArgs("existing_list").WillReturnRows(rows)
+	case "listDoesNotExist":
+		rows := sqlmock.NewRows([]string{"exists"}).AddRow(false)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT name FROM lists WHERE name = $1);`)).WithArgs("new_list").WillReturnRows(rows)
+	case "migrateUp":
+		exists := sqlmock.NewRows([]string{"exists"}).AddRow(false)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_name = $1);`)).WithArgs("schema_migrations").WillReturnRows(exists)
+		prep := mock.ExpectPrepare(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS schema_migrations (version integer NOT NULL, name varchar(100) NOT NULL, applied_at timestamptz NOT NULL DEFAULT now(), PRIMARY KEY (version));`))
+		prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+		for _, m := range postgresMigrations {
+			tables := sqlmock.NewRows([]string{"table_name"}).AddRow("aml")
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT table_name FROM information_schema.columns WHERE table_schema = 'public' AND column_name IN ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) GROUP BY table_name HAVING COUNT(DISTINCT column_name) = 11;`)).WillReturnRows(tables)
+			if m.Check != nil {
+				expectRegionComparison(mock, sqlmock.NewRows([]string{"id"}))
+			}
+			statements, _ := m.Statements(map[string]struct{}{"aml": {}})
+			mock.ExpectBegin()
+			for _, statement := range statements {
+				mock.ExpectExec(regexp.QuoteMeta(statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`)).WithArgs(m.Version, m.Name).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}
+	case "migrateUpFails":
+		exists := sqlmock.NewRows([]string{"exists"}).AddRow(false)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_name = $1);`)).WithArgs("schema_migrations").WillReturnRows(exists)
+		prep := mock.ExpectPrepare(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS schema_migrations`))
+		prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+		tables := sqlmock.NewRows([]string{"table_name"}).AddRow("aml")
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT table_name FROM information_schema.columns WHERE table_schema = 'public' AND column_name IN ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) GROUP BY table_name HAVING COUNT(DISTINCT column_name) = 11;`)).WillReturnRows(tables)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE "aml"`)).WillReturnError(fmt.Errorf("Something went wrong"))
+		mock.ExpectRollback()
 	case "regionExists":
 		rows := sqlmock.NewRows([]string{"exists"}).AddRow(true)
-		mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT id FROM "existing_table" WHERE id = 'GENE1');`)).WillReturnRows(rows)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT id FROM regions WHERE id = $1);`)).WithArgs("GENE1").WillReturnRows(rows)
+	case "schemaOutdated":
+		exists := sqlmock.NewRows([]string{"exists"}).AddRow(false)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_name = $1);`)).WithArgs("schema_migrations").WillReturnRows(exists)
+	case "schemaUpToDate":
+		exists := sqlmock.NewRows([]string{"exists"}).AddRow(true)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_name = $1);`)).WithArgs("schema_migrations").WillReturnRows(exists)
+		versions := sqlmock.NewRows([]string{"version", "applied_at"})
+		for _, m := range postgresMigrations {
+			versions.AddRow(m.Version, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, applied_at FROM schema_migrations ORDER BY version;`)).WillReturnRows(versions)
+	case "slowMigration":
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO regions SELECT * FROM "aml";`)).WillDelayFor(50 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 10))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`)).WithArgs(2, "normalize_lists").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
 	case "tableExists":
-		rows := sqlmock.NewRows([]string{"id", "ensembl_id_38", "ensembl_id_37", "class", "chromosome", "start", "end", "snv", "cnv", "sv", "pindel"})
-		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "existing_table"`)).WillReturnRows(rows)
-	case "updateRow":
-		prep := mock.ExpectPrepare(regexp.QuoteMeta(`UPDATE "existing_table" SET cnv = true WHERE id = 'GENE1';`))
-		prep.ExpectExec().WithArgs().WillReturnResult(sqlmock.NewResult(0, 1))
+		rows := sqlmock.NewRows([]string{"exists"}).AddRow(true)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_name = $1);`)).WithArgs("schema_migrations").WillReturnRows(rows)
+	case "tableDoesNotExist":
+		rows := sqlmock.NewRows([]string{"exists"}).AddRow(false)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_name = $1);`)).WithArgs("schema_migrations").WillReturnRows(rows)
 	}
 	return
 }
 
+// expectRegionComparison expects the comparison of legacy list tables with
+// existing regions
+func expectRegionComparison(mock sqlmock.Sqlmock, ids *sqlmock.Rows) {
+	exists := sqlmock.NewRows([]string{"exists"}).AddRow(true)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_name = $1);`)).WithArgs("regions").WillReturnRows(exists)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM (SELECT id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end" FROM `)).WillReturnRows(ids)
+}
+
+func expectAuditEntry(mock sqlmock.Sqlmock, action string) {
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log (changed_at, changed_by, source_file, source_checksum, action, list, region_id, old_value, new_value) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`)).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), action, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
 func TestGetConnectionString(t *testing.T) {
 	var cases = map[string]struct {
 		result string
@@ -86,27 +185,32 @@ func TestGetConnectionString(t *testing.T) {
 	}
 }
 
-func TestEnsureTableExists(t *testing.T) {
+func TestEnsureListExists(t *testing.T) {
 	var cases = map[string]struct {
-		table   string
+		list    string
 		route   string
 		wantErr bool
 	}{
-		"Table exists": {
-			"existing_table",
-			"tableExists",
+		"List exists": {
+			"existing_list",
+			"listExists",
 			false,
 		},
-		"Table does not exist": {
-			"new_table",
-			"checkAndCreateNewTable",
+		"List does not exist": {
+			"new_list",
+			"checkAndCreateNewList",
 			false,
 		},
+		"List name is invalid": {
+			`aml'); DROP TABLE lists; --`,
+			"default",
+			true,
+		},
 	}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
 			getMockDb(c.route)
-			err := ensureTableExists(c.table)
+			err := ensureListExists(context.Background(), c.list)
 			checkError(t, err, c.wantErr)
 		})
 	}
@@ -114,25 +218,22 @@ func TestEnsureTableExists(t *testing.T) {
 
 func TestCheckTableExists(t *testing.T) {
 	var cases = map[string]struct {
-		table  string
 		route  string
 		result bool
 	}{
 		"Table exists": {
-			"existing_table",
 			"tableExists",
 			true,
 		},
 		"Table does not exist": {
-			"new_table",
-			"createNewTable",
+			"tableDoesNotExist",
 			false,
 		},
 	}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
 			getMockDb(c.route)
-			result := session.Db.Connection.checkTableExists(c.table)
+			result := session.Db.Connection.checkTableExists(context.Background(), "schema_migrations")
 			if diff := deep.Equal(result, c.result); diff != nil {
 				t.Error(diff)
 			}
@@ -140,27 +241,52 @@ func TestCheckTableExists(t *testing.T) {
 	}
 }
 
-func TestCreateTable(t *testing.T) {
+func TestCheckListExists(t *testing.T) {
+	var cases = map[string]struct {
+		list   string
+		route  string
+		result bool
+	}{
+		"List exists": {
+			"existing_list",
+			"listExists",
+			true,
+		},
+		"List does not exist": {
+			"new_list",
+			"listDoesNotExist",
+			false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getMockDb(c.route)
+			result := session.Db.Connection.checkListExists(context.Background(), c.list)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCreateList(t *testing.T) {
 	var cases = map[string]struct {
-		table   string
 		route   string
 		wantErr bool
 	}{
-		"Add table successfully": {
-			"new_table",
-			"createNewTable",
+		"Add list successfully": {
+			"createNewList",
 			false,
 		},
-		"Table could not be added": {
-			"nonexistent_table",
-			"cannotCreateNewTable",
+		"List could not be added": {
+			"cannotCreateNewList",
 			true,
 		},
 	}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
 			getMockDb(c.route)
-			err := session.Db.Connection.createTable(c.table)
+			err := session.Db.Connection.createList(context.Background(), "new_list")
 			checkError(t, err, c.wantErr)
 		})
 	}
@@ -193,13 +319,11 @@ func TestGetAnalyses(t *testing.T) {
 
 func TestCheckRegionExists(t *testing.T) {
 	var cases = map[string]struct {
-		table  string
 		region DbTableRow
 		route  string
 		result bool
 	}{
 		"Region exists": {
-			"existing_table",
 			DbTableRow{
 				Id: "GENE1",
 			},
@@ -210,7 +334,7 @@ func TestCheckRegionExists(t *testing.T) {
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
 			getMockDb(c.route)
-			result := session.Db.Connection.checkRegionExists(c.table, c.region)
+			result := session.Db.Connection.checkRegionExists(context.Background(), c.region)
 			if diff := deep.Equal(result, c.result); diff != nil {
 				t.Error(diff)
 			}
@@ -220,27 +344,39 @@ func TestCheckRegionExists(t *testing.T) {
 
 func TestUpdateRow(t *testing.T) {
 	var cases = map[string]struct {
-		table   string
+		list    string
 		region  DbTableRow
 		route   string
 		wantErr bool
 	}{
 		"Update row successfully": {
-			"existing_table",
+			"aml",
 			DbTableRow{
 				Analyses: map[string]struct{}{
 					"cnv": struct{}{},
+					"snv": struct{}{},
 				},
 				Id: "GENE1",
 			},
-			"updateRow",
+			"addToList",
 			false,
 		},
+		"Analysis is invalid": {
+			"aml",
+			DbTableRow{
+				Analyses: map[string]struct{}{
+					"cnv = false; --": struct{}{},
+				},
+				Id: "GENE1",
+			},
+			"default",
+			true,
+		},
 	}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
 			getMockDb(c.route)
-			err := session.Db.Connection.updateRow(c.table, c.region)
+			err := session.Db.Connection.updateRow(context.Background(), c.list, c.region)
 			checkError(t, err, c.wantErr)
 		})
 	}
@@ -248,31 +384,28 @@ func TestUpdateRow(t *testing.T) {
 
 func TestAddNewRow(t *testing.T) {
 	var cases = map[string]struct {
-		table   string
 		region  DbTableRow
 		route   string
 		wantErr bool
 	}{
 		"Add row successfully": {
-			"existing_table",
 			DbTableRow{
-				Analyses: map[string]struct{}{
-					"cnv": struct{}{},
-					"snv": struct{}{},
-				},
 				Class: "gene",
 				Id:    "GENE1",
 			},
 			"createNewRow",
 			false,
 		},
+		"Region id is passed as parameter": {
+			DbTableRow{
+				Class: "gene",
+				Id:    "GENE1'); DROP TABLE regions; --",
+			},
+			"createNewRowWithQuote",
+			false,
+		},
 		"Row could not be added": {
-			"existing_table",
 			DbTableRow{
-				Analyses: map[string]struct{}{
-					"cnv": struct{}{},
-					"snv": struct{}{},
-				},
 				Class: "gene",
 				Id:    "GENE1",
 			},
@@ -283,7 +416,7 @@ func TestAddNewRow(t *testing.T) {
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
 			getMockDb(c.route)
-			err := session.Db.Connection.addNewRow(c.table, c.region)
+			err := session.Db.Connection.addNewRow(context.Background(), c.region)
 			checkError(t, err, c.wantErr)
 		})
 	}
@@ -318,21 +451,46 @@ func TestGetAnalysis(t *testing.T) {
 	}
 }
 
-func TestGetTables(t *testing.T) {
+func TestGetLegacyListTables(t *testing.T) {
+	var cases = map[string]struct {
+		route  string
+		result map[string]struct{}
+	}{
+		"Get tables successfully": {
+			"getLegacyListTables",
+			map[string]struct{}{
+				"all": {},
+				"aml": {},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getMockDb(c.route)
+			result, err := session.Db.Connection.getLegacyListTables(context.Background())
+			checkError(t, err, false)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestGetLists(t *testing.T) {
 	var cases = map[string]struct {
 		route   string
 		result  map[string]struct{}
 		wantErr bool
 	}{
-		"Get tables successfully": {
-			"getTables",
+		"Get lists successfully": {
+			"getLists",
 			map[string]struct{}{
 				"test": {},
 			},
 			false,
 		},
-		"Could not get tables": {
-			"cannotGetTables",
+		"Could not get lists": {
+			"cannotGetLists",
 			nil,
 			true,
 		},
@@ -340,7 +498,7 @@ func TestGetTables(t *testing.T) {
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
 			getMockDb(c.route)
-			result, err := session.Db.Connection.getTables()
+			result, err := session.Db.Connection.getLists(context.Background())
 			checkError(t, err, c.wantErr)
 			if diff := deep.Equal(result, c.result); diff != nil {
 				t.Error(diff)
@@ -359,13 +517,45 @@ func TestGetRegions(t *testing.T) {
 			"getRegions",
 			[]DbTableRow{
 				DbTableRow{
+					Analyses: map[string]struct{}{"snv": {}},
+					Coordinates: map[string]EnsemblBaseObj{
+						"38": {
+							Chromosome: "1",
+							End:        100,
+							EnsemblId:  "ENSG001",
+							Release:    "110",
+							Start:      1,
+							Strand:     -1,
+						},
+					},
 					Id:          "GENE1",
 					EnsemblId37: "ENSG001",
 					EnsemblId38: "ENSG001",
-					Class:       "gene",
-					Chromosome:  "1",
-					Start:       "1",
-					End:         "100",
+					Exons: map[string][]EnsemblBaseObj{
+						"38": {
+							{
+								Biotype:     "protein_coding",
+								Chromosome:  "1",
+								CodingEnd:   50,
+								CodingStart: 20,
+								End:         50,
+								EnsemblId:   "ENSE001",
+								Start:       1,
+								Strand:      -1,
+								Transcript:  "ENST001",
+							},
+						},
+					},
+					Class: "gene",
+				},
+				DbTableRow{
+					Analyses:   map[string]struct{}{"snv": {}},
+					Id:         "REGION1",
+					Build:      "38",
+					Class:      "region",
+					Chromosome: "2",
+					Start:      "10",
+					End:        "20",
 				},
 			},
 			false,
@@ -379,9 +569,9 @@ func TestGetRegions(t *testing.T) {
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
 			getMockDb(c.route)
-			session.Analysis = "snv"
+			session.Build = "38"
 			session.Tables = []string{"test"}
-			result, err := session.Db.Connection.getRegions()
+			result, err := session.Db.Connection.getRegions(context.Background(), []string{"snv"})
 			checkError(t, err, c.wantErr)
 			if diff := deep.Equal(result, c.result); diff != nil {
 				t.Error(diff)
@@ -389,3 +579,32 @@ func TestGetRegions(t *testing.T) {
 		})
 	}
 }
+
+func TestInTransaction(t *testing.T) {
+	var cases = map[string]struct {
+		route   string
+		wantErr bool
+	}{
+		"Commit changes": {
+			"transactionCommit",
+			false,
+		},
+		"Roll back changes": {
+			"transactionRollback",
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getMockDb(c.route)
+			connection := session.Db.Connection
+			err := inTransaction(context.Background(), func() error {
+				return session.Db.Connection.createList(context.Background(), "new_list")
+			})
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(session.Db.Connection, connection); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
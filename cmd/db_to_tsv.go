@@ -1,74 +1,201 @@
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"log"
 	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/pkg/errors"
 )
 
-func dbToTsv() (err error) {
-	rows, err := session.Db.Connection.getRegions()
+// extractTargets writes one file per analysis and build. Regions are retrieved
+// once per build and padding once per analysis, and shared between the files.
+func extractTargets(ctx context.Context) (err error) {
+	analyses, targetBuilds := splitTargets(session.Targets)
+	lists := session.Tables
+	for _, release := range session.Releases {
+		lists = append(lists, release.List)
+	}
+	padding, err := resolvePadding(ctx, analyses, lists)
+	if err != nil {
+		return
+	}
+	for _, build := range targetBuilds {
+		session.Build = build
+		var rows []DbTableRow
+		var releases []string
+		if rows, releases, err = getBuildRows(ctx, analyses); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not extract GRCh%s", build))
+			return
+		}
+		for _, analysis := range analyses {
+			session.Analysis = analysis
+			session.Padding = padding[analysis]
+			if len(session.Targets) > 1 {
+				if session.Bed, err = getDefaultBedName(); err != nil {
+					return
+				}
+				log.Printf("Extracting %s for GRCh%s to %s", analysis, build, session.Bed)
+			}
+			if err = dbToTsv(ctx, filterAnalysis(rows, analysis), releases); err != nil {
+				err = errors.Wrap(err, fmt.Sprintf("Could not extract %s for GRCh%s", analysis, build))
+				return
+			}
+		}
+	}
+	return
+}
+
+// getBuildRows retrieves the regions of all analyses for the current build and
+// resolves their missing coordinates
+func getBuildRows(ctx context.Context, analyses []string) (rows []DbTableRow, releases []string, err error) {
+	if len(session.Releases) > 0 {
+		rows, err = session.Db.Connection.getReleaseRegions(ctx, analyses)
+	} else {
+		rows, err = session.Db.Connection.getRegions(ctx, analyses)
+	}
 	if err != nil {
 		return
 	}
+	if err = resolveMissingCoordinates(ctx, rows, session.Build); err != nil {
+		return
+	}
+	releases, err = checkStoredReleases(rows)
+	return
+}
+
+// filterAnalysis selects the rows included in an analysis
+func filterAnalysis(rows []DbTableRow, analysis string) (selected []DbTableRow) {
+	for _, row := range rows {
+		if row.getAnalysis(analysis) {
+			selected = append(selected, row)
+		}
+	}
+	return
+}
+
+func dbToTsv(ctx context.Context, rows []DbTableRow, releases []string) (err error) {
+	if len(rows) == 0 {
+		err = errors.New(fmt.Sprintf("Could not find any data for %s", session.Analysis))
+		return
+	}
+	header := []string{fmt.Sprintf("build: GRCh%s", session.Build)}
+	if len(releases) > 0 {
+		header = append(header, fmt.Sprintf("ensembl_release: %s", strings.Join(releases, ",")))
+	}
+	header = append(header, fmt.Sprintf("padding: %s", formatPadding(session.Padding)))
 	var regions []EnsemblBaseObj
 	switch session.Analysis {
 	case "pindel", "sv":
-		regions, err = prepForPindelSv(rows)
+		regions, err = prepForPindelSv(ctx, rows)
 		if err != nil {
 			return
 		}
 	case "cnv", "snv":
-		regions, err = prepForCnvSnv(rows)
+		regions, err = prepForCnvSnv(ctx, rows)
 		if err != nil {
 			return
 		}
 	}
-	if err = regionsToTsv(regions); err != nil {
+	manifest, err := newManifest(ctx, releases)
+	if err != nil {
+		return
+	}
+	if err = regionsToTsv(header, regions, manifest); err != nil {
 		return
 	}
 	return
 }
 
-func prepForPindelSv(rows []DbTableRow) (regions []EnsemblBaseObj, err error) {
+// checkStoredReleases lists the Ensembl releases the coordinates of rows were
+// resolved with and compares them to the pinned release
+func checkStoredReleases(rows []DbTableRow) (releases []string, err error) {
+	seen := make(map[string]struct{})
 	for _, row := range rows {
-		var region EnsemblBaseObj
 		if row.Class == "region" {
-			region, err = row.rowToRegion()
-			if err != nil {
-				return
-			}
-		} else {
-			region, err = row.getCompleteRegion(50)
-			if err != nil {
+			continue
+		}
+		release := row.Coordinates[session.Build].Release
+		if release == "" {
+			release = "unknown"
+		}
+		if _, present := seen[release]; present {
+			continue
+		}
+		seen[release] = struct{}{}
+		releases = append(releases, release)
+		if pinned := session.Annotation.Release; pinned != "" && release != "unknown" && release != pinned {
+			message := fmt.Sprintf("%s was resolved with Ensembl release %s but release %s is pinned", row.Id, release, pinned)
+			if session.Annotation.ReleaseCheck == "strict" {
+				err = errors.New(message)
 				return
 			}
+			log.Printf("Warning: %s", message)
 		}
-		regions = append(regions, region)
 	}
+	sort.Strings(releases)
 	return
 }
 
-func (d DbTableRow) rowToRegion() (region EnsemblBaseObj, err error) {
-	region.Annotation = d.Id
-	region.Chromosome = d.Chromosome
-	if region.Start, err = strconv.Atoi(d.Start); err != nil {
+func prepForPindelSv(ctx context.Context, rows []DbTableRow) (regions []EnsemblBaseObj, err error) {
+	regions, err = prepRegions(ctx, rows, func(row DbTableRow) (regions []EnsemblBaseObj, err error) {
+		var region EnsemblBaseObj
+		if row.Class == "region" {
+			region, err = row.rowToRegion()
+			region.addWindow(getPadding(row.Class))
+		} else {
+			region, err = row.getCompleteRegion(ctx, getPadding(row.Class))
+		}
+		regions = []EnsemblBaseObj{region}
+		return
+	})
+	return
+}
+
+// prepRegions converts rows concurrently and concatenates the regions in row order
+func prepRegions(ctx context.Context, rows []DbTableRow, prep func(row DbTableRow) ([]EnsemblBaseObj, error)) (regions []EnsemblBaseObj, err error) {
+	prepared := make([][]EnsemblBaseObj, len(rows))
+	errs := forEachConcurrently(ctx, len(rows), func(i int) (err error) {
+		prepared[i], err = prep(rows[i])
 		return
+	})
+	if err = collectErrors(errs, func(i int) string { return rows[i].Id }); err != nil {
+		err = errors.Wrap(err, "Could not prepare regions")
+		return
+	}
+	for _, rowRegions := range prepared {
+		regions = append(regions, rowRegions...)
 	}
-	if region.End, err = strconv.Atoi(d.End); err != nil {
+	return
+}
+
+func (d DbTableRow) rowToRegion() (region EnsemblBaseObj, err error) {
+	if stored, present := d.Coordinates[session.Build]; present {
+		region = stored
+	} else if region, err = d.liftRegion(session.Build); err != nil {
 		return
 	}
+	region.Annotation = d.Id
 	return
 }
 
-func (d DbTableRow) getCompleteRegion(size int) (region EnsemblBaseObj, err error) {
-	body, err := d.getCoordinates(false)
-	if err != nil {
+func (d DbTableRow) getCompleteRegion(ctx context.Context, size int) (region EnsemblBaseObj, err error) {
+	if stored, present := d.Coordinates[session.Build]; present {
+		region = stored
+	} else if !session.ResolveMissing {
+		err = missingDataError("coordinates", []string{d.Id})
 		return
+	} else {
+		log.Printf("No stored GRCh%s coordinates for %s, querying Ensembl", session.Build, d.Id)
+		var feature Feature
+		if feature, err = d.getFeature(ctx, false); err != nil {
+			return
+		}
+		region = feature.Region
 	}
-	json.Unmarshal(body, &region)
 	if d.Id != region.EnsemblId {
 		region.Annotation = fmt.Sprintf("%s|%s", d.Id, region.EnsemblId)
 	} else {
@@ -83,86 +210,132 @@ func (o *EnsemblBaseObj) addWindow(size int) {
 	o.End = o.End + size
 }
 
-func prepForCnvSnv(rows []DbTableRow) (regions []EnsemblBaseObj, err error) {
-	for _, row := range rows {
+func prepForCnvSnv(ctx context.Context, rows []DbTableRow) (regions []EnsemblBaseObj, err error) {
+	regions, err = prepRegions(ctx, rows, func(row DbTableRow) (regions []EnsemblBaseObj, err error) {
 		var region EnsemblBaseObj
 		if row.Class == "region" {
 			region, err = row.rowToRegion()
-			if err != nil {
-				return
-			}
-			regions = append(regions, region)
+			region.addWindow(getPadding(row.Class))
+			regions = []EnsemblBaseObj{region}
 		} else if row.Class == "exon" {
-			region, err = row.getCompleteRegion(10)
-			if err != nil {
-				return
-			}
-			regions = append(regions, region)
+			region, err = row.getCompleteRegion(ctx, getPadding(row.Class))
+			regions = []EnsemblBaseObj{region}
 		} else {
-			var exons []EnsemblBaseObj
-			exons, err = row.getExons(10)
-			if err != nil {
-				return
-			}
-			regions = append(regions, exons...)
+			regions, err = row.getExons(ctx, getPadding(row.Class))
 		}
-	}
+		return
+	})
 	return
 }
 
-func (d DbTableRow) getExons(size int) (regions []EnsemblBaseObj, err error) {
-	body, err := d.getCoordinates(true)
+func (d DbTableRow) getExons(ctx context.Context, size int) (regions []EnsemblBaseObj, err error) {
+	exons, err := d.getBuildExons(ctx)
 	if err != nil {
 		return
 	}
 	if d.Class == "gene" {
-		var obj EnsemblGeneObj
-		json.Unmarshal(body, &obj)
-		var exons []EnsemblBaseObj
-		for _, transcript := range obj.Transcripts {
-			for _, exon := range transcript.Exons {
-				exon.Transcript = transcript.EnsemblId
-				exons = append(exons, exon)
-			}
+		if exons, err = d.selectTranscripts(exons); err != nil {
+			return
 		}
-		geneAnnotation := fmt.Sprintf("%s|%s", obj.Id, obj.EnsemblId)
-		regions = append(regions, uniqueExons(geneAnnotation, exons)...)
+	}
+	exons = d.selectCodingTranscripts(exons)
+	if d.Class == "gene" {
+		geneAnnotation := fmt.Sprintf("%s|%s", d.Id, d.getBuildEnsemblId(session.Build))
+		regions = append(regions, uniqueExons(geneAnnotation, exons, size)...)
 	} else if d.Class == "transcript" {
-		var obj EnsemblTransObj
-		json.Unmarshal(body, &obj)
-		for _, exon := range obj.Exons {
-			exon.addWindow(size)
-			exon.Annotation = fmt.Sprintf("%s|%s|%s", d.Id, obj.EnsemblId, exon.EnsemblId)
-			regions = append(regions, exon)
+		for _, exon := range exons {
+			for _, part := range exon.getParts(size) {
+				part.Annotation = fmt.Sprintf("%s|%s|%s", d.Id, part.Transcript, part.EnsemblId)
+				regions = append(regions, part)
+			}
 		}
 	}
 	return
 }
 
-func uniqueExons(annotation string, exons []EnsemblBaseObj) (uniqueExons []EnsemblBaseObj) {
+func (d DbTableRow) getBuildExons(ctx context.Context) (exons []EnsemblBaseObj, err error) {
+	stored, present := d.Exons[session.Build]
+	switch {
+	case present && hasCodingRegions(stored):
+		exons = stored
+		return
+	case !present && !session.ResolveMissing:
+		err = missingDataError("exons", []string{d.Id})
+		return
+	case !session.ResolveMissing:
+		err = missingDataError("coding regions", []string{d.Id})
+		return
+	case !present:
+		log.Printf("No stored GRCh%s exons for %s, querying Ensembl", session.Build, d.Id)
+	default:
+		log.Printf("No stored GRCh%s coding regions for %s, querying Ensembl", session.Build, d.Id)
+	}
+	feature, err := d.getFeature(ctx, true)
+	if err != nil {
+		return
+	}
+	exons = feature.Exons
+	return
+}
+
+func uniqueExons(annotation string, exons []EnsemblBaseObj, size int) (uniqueExons []EnsemblBaseObj) {
 	uniqs := make(map[string]EnsemblBaseObj)
+	var order []string
 	for _, exon := range exons {
-		if _, present := uniqs[exon.EnsemblId]; !present {
-			exon.addWindow(10)
-			exon.Annotation = fmt.Sprintf("%s|%s|%s", annotation, exon.Transcript, exon.EnsemblId)
-			uniqs[exon.EnsemblId] = exon
-		} else {
-			uniq := uniqs[exon.EnsemblId]
-			exonAnnotation := strings.Split(uniq.Annotation, "|")
-			uniq.Annotation = fmt.Sprintf("%s|%s|%s&%s|%s", exonAnnotation[0], exonAnnotation[1], exonAnnotation[2], exon.Transcript, exonAnnotation[3])
-			uniqs[exon.EnsemblId] = uniq
+		for _, part := range exon.getParts(size) {
+			// Trimmed parts of a shared exon differ between transcripts with different coding regions
+			key := fmt.Sprintf("%s:%d-%d", part.EnsemblId, part.Start, part.End)
+			if _, present := uniqs[key]; !present {
+				order = append(order, key)
+				part.Annotation = fmt.Sprintf("%s|%s|%s", annotation, part.Transcript, part.EnsemblId)
+				uniqs[key] = part
+			} else {
+				uniq := uniqs[key]
+				exonAnnotation := strings.Split(uniq.Annotation, "|")
+				uniq.Annotation = fmt.Sprintf("%s|%s|%s&%s|%s", exonAnnotation[0], exonAnnotation[1], exonAnnotation[2], part.Transcript, exonAnnotation[3])
+				uniqs[key] = uniq
+			}
 		}
 	}
-	for _, uniq := range uniqs {
-		uniqueExons = append(uniqueExons, uniq)
+	// Keep the order of the input so that identical runs produce identical files
+	for _, id := range order {
+		uniqueExons = append(uniqueExons, uniqs[id])
 	}
 	return
 }
 
-func regionsToTsv(regions []EnsemblBaseObj) (err error) {
-	regions = sortRegions(regions)
-	lines := regionsToSlices(regions)
-	err = writeTsv(session.Bed, lines)
+// regionsToTsv writes the regions together with a manifest recording how
+// they were generated
+func regionsToTsv(header []string, regions []EnsemblBaseObj, manifest Manifest) (err error) {
+	format, err := getIntervalFormat(session.Format)
+	if err != nil {
+		return
+	}
+	lines := format.toSlices(sortRegions(regions))
+	manifest.Intervals = len(lines)
+	if session.ProvenanceHeader {
+		header = append(header, manifest.headerLines()...)
+	}
+	if header, err = format.header(header); err != nil {
+		return
+	}
+	if manifest.Checksum, err = getIntervalChecksum(header, lines); err != nil {
+		return
+	}
+	setChecksumLine(header, manifest.Checksum)
+	index := session.Bgzip && session.Bed != "-"
+	if index && !format.indexable() {
+		log.Printf("Tabix indexes are only written for BED formats, %s is compressed only", session.Bed)
+		index = false
+	}
+	if err = writeIntervals(session.Bed, header, lines, session.Bgzip, index); err != nil {
+		return
+	}
+	if session.Bed == "-" {
+		log.Printf("Output is written to stdout, skipping manifest")
+		return
+	}
+	err = writeManifest(getManifestPath(session.Bed), manifest)
 	return
 }
 
@@ -195,51 +368,9 @@ func generateChromosomeSlice() (chromosomes []string) {
 	return
 }
 
-func regionsToSlices(regions []EnsemblBaseObj) (lines [][]string) {
-	var overlapRegions []EnsemblBaseObj
-	for i, region := range regions {
-		if i == 0 {
-			overlapRegions = []EnsemblBaseObj{region}
-		} else if identifyOverlap(regions[i-1], region) {
-			overlapRegions = append(overlapRegions, region)
-		} else {
-			lines = append(lines, mergeOverlappingRegions(overlapRegions))
-			overlapRegions = []EnsemblBaseObj{region}
-		}
-	}
-	return
-}
-
 func identifyOverlap(a, b EnsemblBaseObj) bool {
 	if a.Chromosome == b.Chromosome && a.End >= b.Start {
 		return true
 	}
 	return false
 }
-
-func mergeOverlappingRegions(regions []EnsemblBaseObj) (line []string) {
-	var chromosome, annotation string
-	var start, end int
-	for i, region := range regions {
-		if i == 0 {
-			start = region.Start
-			end = region.End
-			annotation = region.Annotation
-		} else {
-			annotation = fmt.Sprintf("%s;%s", annotation, region.Annotation)
-		}
-		if region.Start < start {
-			start = region.Start
-		}
-		if region.End > end {
-			end = region.End
-		}
-	}
-	if session.Chr {
-		chromosome = fmt.Sprintf("chr%s", regions[0].Chromosome)
-	} else {
-		chromosome = regions[0].Chromosome
-	}
-	line = []string{chromosome, strconv.Itoa(start), strconv.Itoa(end), annotation}
-	return
-}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const ensemblBatchSize = 1000
+
+func (e ensemblSource) lookupFeatures(ctx context.Context, build string, ids []string, expand bool) (features map[string]Feature, err error) {
+	objects, err := lookupIds(ctx, build, ids, expand)
+	if err != nil {
+		return
+	}
+	features = make(map[string]Feature)
+	for id, body := range objects {
+		if features[id], err = parseFeature(body); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not parse lookup of %s", id))
+			return
+		}
+	}
+	return
+}
+
+func lookupIds(ctx context.Context, build string, ids []string, expand bool) (objects map[string][]byte, err error) {
+	objects = make(map[string][]byte)
+	missing, err := getCachedObjects(ctx, build, ids, objects, func(id string) string {
+		return getLookUpUrl(id, build, expand)
+	})
+	if err != nil || len(missing) == 0 {
+		return
+	}
+	var expandValue int
+	if expand {
+		expandValue = 1
+	}
+	url := fmt.Sprintf("%s/lookup/id?content-type=application/json", getBuildUrl(build))
+	err = postBatches(ctx, url, missing, func(batch []string) interface{} {
+		payload := map[string]interface{}{"ids": batch, "expand": expandValue}
+		if expand && build == "38" {
+			payload["mane"] = 1
+		}
+		return payload
+	}, func(id string, body []byte) {
+		objects[id] = body
+		cacheResponse(ctx, build, getLookUpUrl(id, build, expand), body)
+	})
+	return
+}
+
+func (e ensemblSource) lookupSymbols(ctx context.Context, build string, symbols []string) (ids map[string]string, err error) {
+	objects := make(map[string][]byte)
+	missing, err := getCachedObjects(ctx, build, symbols, objects, func(symbol string) string {
+		return getSymbolUrl(symbol, build)
+	})
+	if err != nil {
+		return
+	}
+	if len(missing) > 0 {
+		url := fmt.Sprintf("%s/lookup/symbol/homo_sapiens?content-type=application/json", getBuildUrl(build))
+		err = postBatches(ctx, url, missing, func(batch []string) interface{} {
+			return map[string]interface{}{"symbols": batch}
+		}, func(symbol string, body []byte) {
+			objects[symbol] = body
+			cacheResponse(ctx, build, getSymbolUrl(symbol, build), body)
+		})
+		if err != nil {
+			return
+		}
+	}
+	geneRegex := regexp.MustCompile("ENSG")
+	chromosomes := generateChromosomeMap()
+	ids = make(map[string]string)
+	for symbol, body := range objects {
+		var gene EnsemblGeneObj
+		if err = json.Unmarshal(body, &gene); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not parse lookup of %s", symbol))
+			return
+		}
+		if geneRegex.MatchString(gene.EnsemblId) && chromosomes[gene.Chromosome] {
+			ids[symbol] = gene.EnsemblId
+		}
+	}
+	return
+}
+
+func getCachedObjects(ctx context.Context, build string, keys []string, objects map[string][]byte, getUrl func(key string) string) (missing []string, err error) {
+	for _, key := range uniqueStrings(keys) {
+		var body []byte
+		var found bool
+		if body, found, err = getCachedResponse(ctx, build, getUrl(key)); err != nil {
+			return
+		}
+		if found {
+			objects[key] = body
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 && session.Web.Offline {
+		err = errors.New(fmt.Sprintf("The following lookups are not cached for GRCh%s and --offline is set: %s. Run the same command online first", build, strings.Join(missing, ", ")))
+	}
+	return
+}
+
+func postBatches(ctx context.Context, url string, keys []string, getPayload func(batch []string) interface{}, handle func(key string, body []byte)) (err error) {
+	for start := 0; start < len(keys); start += ensemblBatchSize {
+		end := start + ensemblBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		var body []byte
+		if body, err = sendJsonRequest(ctx, url, getPayload(keys[start:end])); err != nil {
+			return
+		}
+		var results map[string]json.RawMessage
+		if err = json.Unmarshal(body, &results); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not parse response of %s", url))
+			return
+		}
+		for key, result := range results {
+			// Unknown ids are returned as null
+			if string(result) == "null" {
+				continue
+			}
+			handle(key, result)
+		}
+	}
+	return
+}
+
+func getSymbolUrl(symbol string, build string) string {
+	return fmt.Sprintf("%s/lookup/symbol/homo_sapiens/%s?content-type=application/json", getBuildUrl(build), symbol)
+}
+
+func (d *DbTableRow) setBuildEnsemblId(build string, id string) {
+	if build == "37" {
+		d.EnsemblId37 = id
+	} else {
+		d.EnsemblId38 = id
+	}
+}
+
+func uniqueStrings(values []string) (unique []string) {
+	seen := make(map[string]struct{})
+	for _, value := range values {
+		if _, present := seen[value]; !present {
+			seen[value] = struct{}{}
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestLookupIds(t *testing.T) {
+	var cases = map[string]struct {
+		ids     int
+		batches int
+		found   int
+	}{
+		"Single batch": {
+			3,
+			1,
+			2,
+		},
+		"Ids are split into batches": {
+			2500,
+			3,
+			2499,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{
+				Web: web{
+					CacheDir: t.TempDir(),
+					CacheTTL: time.Hour,
+					releases: map[string]string{"38": "110"},
+				},
+			}
+			var ids []string
+			for i := 0; i < c.ids; i++ {
+				ids = append(ids, fmt.Sprintf("ENSG%06d", i))
+			}
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+			httpmock.RegisterResponder("POST", "/lookup/id?content-type=application/json",
+				func(request *http.Request) (*http.Response, error) {
+					var payload struct {
+						Ids []string `json:"ids"`
+					}
+					if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+						return nil, err
+					}
+					if len(payload.Ids) > ensemblBatchSize {
+						t.Errorf("Batch of %d ids exceeds limit", len(payload.Ids))
+					}
+					results := make(map[string]interface{})
+					for _, id := range payload.Ids {
+						if id == "ENSG000000" {
+							results[id] = nil
+						} else {
+							results[id] = map[string]string{"id": id}
+						}
+					}
+					return httpmock.NewJsonResponse(200, results)
+				})
+			objects, err := lookupIds(context.Background(), "38", ids, true)
+			checkError(t, err, false)
+			if len(objects) != c.found {
+				t.Errorf("Expected %d objects, got %d", c.found, len(objects))
+			}
+			if calls := httpmock.GetTotalCallCount(); calls != c.batches {
+				t.Errorf("Expected %d batches, got %d", c.batches, calls)
+			}
+			httpmock.ZeroCallCounters()
+			if _, err = lookupIds(context.Background(), "38", ids[1:], true); err != nil {
+				t.Error(err)
+			}
+			if calls := httpmock.GetTotalCallCount(); calls != 0 {
+				t.Errorf("Expected cached objects to be reused, got %d requests", calls)
+			}
+		})
+	}
+}
+
+func TestLookupEnsemblIds(t *testing.T) {
+	var cases = map[string]struct {
+		rows    []DbTableRow
+		result  []DbTableRow
+		wantErr bool
+	}{
+		"Genes are resolved by symbol or cross reference": {
+			[]DbTableRow{
+				{Class: "gene", Id: "GENE1"},
+				{Class: "gene", Id: "ALIAS1"},
+				{Class: "exon", Id: "ENSE0001"},
+				{Class: "region", Id: "REGION1"},
+			},
+			[]DbTableRow{
+				{Class: "gene", EnsemblId37: "ENSG0001", EnsemblId38: "ENSG0001", Id: "GENE1"},
+				{Class: "gene", EnsemblId37: "ENSG0002", EnsemblId38: "ENSG0002", Id: "ALIAS1"},
+				{Class: "exon", EnsemblId37: "ENSE0001", EnsemblId38: "ENSE0001", Id: "ENSE0001"},
+				{Class: "region", Id: "REGION1"},
+			},
+			false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{}
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+			httpmock.RegisterResponder("POST", "/lookup/symbol/homo_sapiens?content-type=application/json",
+				httpmock.NewStringResponder(200, `{"GENE1": {"id": "ENSG0001", "seq_region_name": "1"}}`))
+			httpmock.RegisterResponder("GET", "/xrefs/symbol/homo_sapiens/ALIAS1?content-type=application/json",
+				httpmock.NewStringResponder(200, `[{"id": "ENSG0002"}]`))
+			httpmock.RegisterResponder("GET", "/lookup/id/ENSG0002?content-type=application/json",
+				httpmock.NewStringResponder(200, `{"seq_region_name": "2"}`))
+			err := lookupEnsemblIds(context.Background(), c.rows)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(c.rows, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
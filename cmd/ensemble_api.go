@@ -1,43 +1,58 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 )
 
-func (d *DbTableRow) getEnsemblIds() (err error) {
+var ensemblMutex sync.Mutex
+
+func (d *DbTableRow) getEnsemblIds(ctx context.Context) (err error) {
 	if d.Class == "region" {
 		return
 	} else if d.Class == "exon" {
 		d.EnsemblId38 = d.Id
 		d.EnsemblId37 = d.Id
 	} else {
-		if d.EnsemblId38, err = d.getEnsemblId("38"); err != nil {
+		if d.EnsemblId38, err = d.getEnsemblId(ctx, "38"); err != nil {
 			return
 		}
-		if d.EnsemblId37, err = d.getEnsemblId("37"); err != nil {
+		if d.EnsemblId37, err = d.getEnsemblId(ctx, "37"); err != nil {
 			return
 		}
 	}
 	return
 }
 
-func (d *DbTableRow) getEnsemblId(build string) (id string, err error) {
+func (d *DbTableRow) getEnsemblId(ctx context.Context, build string) (id string, err error) {
+	source, err := getAnnotationSource()
+	if err != nil {
+		return
+	}
+	id, err = source.getId(ctx, build, d.Class, d.Id)
+	return
+}
+
+func (e ensemblSource) getId(ctx context.Context, build string, class string, name string) (id string, err error) {
 	geneRegex := regexp.MustCompile("ENSG")
 	transRegex := regexp.MustCompile("ENST")
-	body, err := sendHttpRequest(d.getCrossRefUrl(build))
+	body, err := sendEnsemblRequest(ctx, build, DbTableRow{Id: name}.getCrossRefUrl(build))
 	if err != nil {
 		return
 	}
 	var jsonObj []EnsemblGeneObj
 	json.Unmarshal(body, &jsonObj)
 	for _, element := range jsonObj {
-		if d.Class == "gene" && geneRegex.MatchString(element.EnsemblId) {
+		if class == "gene" && geneRegex.MatchString(element.EnsemblId) {
 			var valid bool
-			valid, err = checkEnsemblIdChromosome(element.EnsemblId, build)
+			valid, err = checkEnsemblIdChromosome(ctx, element.EnsemblId, build)
 			if err != nil {
 				return
 			}
@@ -45,7 +60,7 @@ func (d *DbTableRow) getEnsemblId(build string) (id string, err error) {
 				id = element.EnsemblId
 				return
 			}
-		} else if d.Class == "transcript" && transRegex.MatchString(element.EnsemblId) {
+		} else if class == "transcript" && transRegex.MatchString(element.EnsemblId) {
 			id = element.EnsemblId
 			return
 		}
@@ -53,6 +68,58 @@ func (d *DbTableRow) getEnsemblId(build string) (id string, err error) {
 	return
 }
 
+// getRelease asks Ensembl once per run and build so that stored releases and
+// cache directories agree
+func (e ensemblSource) getRelease(ctx context.Context, build string) (release string, err error) {
+	ensemblMutex.Lock()
+	release, found := session.Web.releases[build]
+	ensemblMutex.Unlock()
+	if found {
+		return
+	}
+	url := fmt.Sprintf("%s/info/data?content-type=application/json", getBuildUrl(build))
+	var body []byte
+	if session.Web.Offline {
+		body, err = sendEnsemblRequest(ctx, build, url)
+	} else if body, err = sendHttpRequest(ctx, url); err == nil {
+		// Keep the live answer for later offline runs
+		cacheResponse(ctx, build, url, body)
+	}
+	if err != nil {
+		return
+	}
+	var info struct {
+		Releases []int `json:"releases"`
+	}
+	if err = json.Unmarshal(body, &info); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not parse response of %s", url))
+		return
+	}
+	if len(info.Releases) == 0 {
+		err = errors.New(fmt.Sprintf("%s did not report a release", url))
+		return
+	}
+	release = strconv.Itoa(info.Releases[0])
+	ensemblMutex.Lock()
+	if session.Web.releases == nil {
+		session.Web.releases = make(map[string]string)
+	}
+	session.Web.releases[build] = release
+	ensemblMutex.Unlock()
+	return
+}
+
+func (e ensemblSource) getFeature(ctx context.Context, build string, id string, expand bool) (feature Feature, err error) {
+	body, err := sendEnsemblRequest(ctx, build, getLookUpUrl(id, build, expand))
+	if err != nil {
+		return
+	}
+	if feature, err = parseFeature(body); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not parse coordinates of %s", id))
+	}
+	return
+}
+
 func (d DbTableRow) getCrossRefUrl(build string) string {
 	return fmt.Sprintf("%s/xrefs/symbol/homo_sapiens/%s?content-type=application/json", getBuildUrl(build), d.Id)
 }
@@ -64,8 +131,8 @@ func getBuildUrl(build string) string {
 	return session.Web.Ensembl38
 }
 
-func checkEnsemblIdChromosome(id string, build string) (valid bool, err error) {
-	body, err := sendHttpRequest(getLookUpUrl(id, build, false))
+func checkEnsemblIdChromosome(ctx context.Context, id string, build string) (valid bool, err error) {
+	body, err := sendEnsemblRequest(ctx, build, getLookUpUrl(id, build, false))
 	if err != nil {
 		return
 	}
@@ -80,17 +147,114 @@ func getLookUpUrl(id string, build string, expand bool) string {
 	var expandString string
 	if expand {
 		expandString = ";expand=1"
+		// MANE transcripts only exist for GRCh38
+		if build == "38" {
+			expandString = ";expand=1;mane=1"
+		}
 	}
 	return fmt.Sprintf("%s/lookup/id/%s?content-type=application/json%s", getBuildUrl(build), id, expandString)
 }
 
-func (d DbTableRow) getCoordinates(expand bool) (body []byte, err error) {
+func (d DbTableRow) getBuildEnsemblId(build string) string {
+	if build == "37" {
+		return d.EnsemblId37
+	}
+	return d.EnsemblId38
+}
+
+func (d *DbTableRow) resolveCoordinates(ctx context.Context) (err error) {
+	if d.Class == "region" {
+		err = d.liftCoordinates()
+		return
+	}
+	source, err := getAnnotationSource()
+	if err != nil {
+		return
+	}
+	d.Coordinates = make(map[string]EnsemblBaseObj)
+	d.Exons = make(map[string][]EnsemblBaseObj)
+	for _, build := range builds {
+		id := d.getBuildEnsemblId(build)
+		if id == "" {
+			continue
+		}
+		var release string
+		if release, err = getLiveRelease(ctx, build); err != nil {
+			return
+		}
+		var feature Feature
+		if feature, err = source.getFeature(ctx, build, id, d.Class != "exon"); err != nil {
+			return
+		}
+		feature.setOnRow(d, build, release)
+	}
+	return
+}
+
+func parseExons(class string, body []byte) (exons []EnsemblBaseObj, err error) {
+	var transcripts []EnsemblTransObj
+	switch class {
+	case "gene":
+		var obj EnsemblGeneObj
+		err = json.Unmarshal(body, &obj)
+		transcripts = obj.Transcripts
+	case "transcript":
+		var obj EnsemblTransObj
+		err = json.Unmarshal(body, &obj)
+		transcripts = []EnsemblTransObj{obj}
+	}
+	if err != nil {
+		err = errors.Wrap(err, "Could not parse exons")
+		return
+	}
+	for _, transcript := range transcripts {
+		tags := transcript.getTags()
+		for _, exon := range transcript.Exons {
+			exon.Biotype = transcript.Biotype
+			if transcript.Translation != nil {
+				exon.CodingStart = transcript.Translation.Start
+				exon.CodingEnd = transcript.Translation.End
+			}
+			exon.Tags = tags
+			exon.Transcript = transcript.EnsemblId
+			exons = append(exons, exon)
+		}
+	}
+	return
+}
+
+func splitTags(value string) (tags []string) {
+	for _, tag := range strings.Split(value, ",") {
+		if _, known := transcriptTags[tag]; known {
+			tags = append(tags, tag)
+		}
+	}
+	return
+}
+
+func (t EnsemblTransObj) getTags() (tags []string) {
+	if t.Canonical == 1 {
+		tags = append(tags, "Ensembl_canonical")
+	}
+	for _, mane := range t.Mane {
+		if _, known := transcriptTags[mane.Type]; known {
+			tags = append(tags, mane.Type)
+		}
+	}
+	return
+}
+
+func (d DbTableRow) getFeature(ctx context.Context, expand bool) (feature Feature, err error) {
+	source, err := getAnnotationSource()
+	if err != nil {
+		return
+	}
 	if session.Build == "38" && d.EnsemblId38 != "" {
-		body, err = sendHttpRequest(getLookUpUrl(d.EnsemblId38, session.Build, expand))
+		feature, err = source.getFeature(ctx, session.Build, d.EnsemblId38, expand)
 	} else if session.Build == "38" && d.EnsemblId37 != "" {
 		err = errors.New(fmt.Sprintf("Did not find %s for GRCh38 but GRCh37", d.Id))
 	} else if session.Build == "37" && d.EnsemblId37 != "" {
-		body, err = sendHttpRequest(getLookUpUrl(d.EnsemblId37, session.Build, expand))
+		feature, err = source.getFeature(ctx, session.Build, d.EnsemblId37, expand)
 	} else if session.Build == "37" && d.EnsemblId38 != "" {
 		err = errors.New(fmt.Sprintf("Did not find %s for GRCh37 but GRCh38", d.Id))
 	}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"testing"
 
 	"github.com/go-test/deep"
@@ -72,7 +73,7 @@ func TestGetEnsemblIds(t *testing.T) {
 				httpmock.NewStringResponder(200, `{"seq_region_name": "1"}`))
 			httpmock.RegisterResponder("GET", "/lookup/id/GENE2?content-type=application/json",
 				httpmock.NewStringResponder(500, ""))
-			err := c.d.getEnsemblIds()
+			err := c.d.getEnsemblIds(context.Background())
 			checkError(t, err, c.wantErr)
 			if diff := deep.Equal(c.d, c.result); diff != nil {
 				t.Error(diff)
@@ -141,7 +142,7 @@ func TestGetEnsemblId(t *testing.T) {
 				httpmock.NewStringResponder(500, ""))
 			httpmock.RegisterResponder("GET", "/lookup/id/GENE3?content-type=application/json",
 				httpmock.NewStringResponder(200, `{"seq_region_name": "100"}`))
-			result, err := c.d.getEnsemblId(c.build)
+			result, err := c.d.getEnsemblId(context.Background(), c.build)
 			checkError(t, err, c.wantErr)
 			if diff := deep.Equal(result, c.result); diff != nil {
 				t.Error(diff)
@@ -241,7 +242,7 @@ func TestCheckEnsemblIdChromosome(t *testing.T) {
 				httpmock.NewStringResponder(500, ""))
 			httpmock.RegisterResponder("GET", "/lookup/id/GENE3?content-type=application/json",
 				httpmock.NewStringResponder(200, `{"seq_region_name": "100"}`))
-			result, err := checkEnsemblIdChromosome(c.id, c.build)
+			result, err := checkEnsemblIdChromosome(context.Background(), c.id, c.build)
 			checkError(t, err, c.wantErr)
 			if diff := deep.Equal(result, c.result); diff != nil {
 				t.Error(diff)
@@ -257,10 +258,16 @@ func TestGetLookUpUrl(t *testing.T) {
 		expand bool
 		result string
 	}{
-		"Url contains expand": {
+		"Url contains expand and MANE": {
 			"GENE1",
 			"38",
 			true,
+			"/lookup/id/GENE1?content-type=application/json;expand=1;mane=1",
+		},
+		"No MANE for GRCh37": {
+			"GENE1",
+			"37",
+			true,
 			"/lookup/id/GENE1?content-type=application/json;expand=1",
 		},
 		"Url without expand": {
@@ -279,3 +286,164 @@ func TestGetLookUpUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveCoordinates(t *testing.T) {
+	var cases = map[string]struct {
+		d       DbTableRow
+		result  DbTableRow
+		wantErr bool
+	}{
+		"Nothing to be done for region": {
+			DbTableRow{
+				Class: "region",
+				Id:    "my_region",
+			},
+			DbTableRow{
+				Class: "region",
+				Id:    "my_region",
+			},
+			false,
+		},
+		"Resolve gene for GRCh38 only": {
+			DbTableRow{
+				Class:       "gene",
+				EnsemblId38: "ENSG0001",
+				Id:          "GENE1",
+			},
+			DbTableRow{
+				Class: "gene",
+				Coordinates: map[string]EnsemblBaseObj{
+					"38": {Chromosome: "1", End: 500, EnsemblId: "ENSG0001", Release: "110", Start: 100},
+				},
+				EnsemblId38: "ENSG0001",
+				Exons: map[string][]EnsemblBaseObj{
+					"38": {
+						{Chromosome: "1", End: 200, EnsemblId: "ENSE0001", Start: 100, Tags: []string{"Ensembl_canonical", "MANE_Select"}, Transcript: "ENST0001"},
+					},
+				},
+				Id: "GENE1",
+			},
+			false,
+		},
+		"Internal server error": {
+			DbTableRow{
+				Class:       "gene",
+				EnsemblId37: "GENE2",
+				Id:          "GENE2",
+			},
+			DbTableRow{
+				Class:       "gene",
+				Coordinates: map[string]EnsemblBaseObj{},
+				EnsemblId37: "GENE2",
+				Exons:       map[string][]EnsemblBaseObj{},
+				Id:          "GENE2",
+			},
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{}
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+			httpmock.RegisterResponder("GET", "/info/data?content-type=application/json",
+				httpmock.NewStringResponder(200, `{"releases": [110]}`))
+			httpmock.RegisterResponder("GET", "/lookup/id/ENSG0001?content-type=application/json;expand=1;mane=1",
+				httpmock.NewStringResponder(200, `{"id": "ENSG0001", "seq_region_name": "1", "start": 100, "end": 500, "Transcript": [{"id": "ENST0001", "is_canonical": 1, "MANE": [{"type": "MANE_Select"}], "Exon": [{"id": "ENSE0001", "seq_region_name": "1", "start": 100, "end": 200}]}]}`))
+			httpmock.RegisterResponder("GET", "/lookup/id/GENE2?content-type=application/json;expand=1",
+				httpmock.NewStringResponder(500, ""))
+			err := c.d.resolveCoordinates(context.Background())
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(c.d, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestEnsemblGetRelease(t *testing.T) {
+	var cases = map[string]struct {
+		status  int
+		body    string
+		result  string
+		wantErr bool
+	}{
+		"Release is reported": {
+			200,
+			`{"releases": [110]}`,
+			"110",
+			false,
+		},
+		"No release is reported": {
+			200,
+			`{"releases": []}`,
+			"",
+			true,
+		},
+		"Internal server error": {
+			500,
+			"",
+			"",
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{}
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+			httpmock.RegisterResponder("GET", "/info/data?content-type=application/json",
+				httpmock.NewStringResponder(c.status, c.body))
+			result, err := ensemblSource{}.getRelease(context.Background(), "38")
+			checkError(t, err, c.wantErr)
+			if result != c.result {
+				t.Errorf("Expected release %s, got %s", c.result, result)
+			}
+		})
+	}
+}
+
+func TestParseExons(t *testing.T) {
+	var cases = map[string]struct {
+		class  string
+		body   string
+		result []EnsemblBaseObj
+	}{
+		"Exons of all gene transcripts": {
+			"gene",
+			`{"id": "ENSG0001", "Transcript": [{"id": "ENST0001", "Exon": [{"id": "ENSE0001", "start": 1, "end": 10}]}, {"id": "ENST0002", "Exon": [{"id": "ENSE0001", "start": 1, "end": 10}]}]}`,
+			[]EnsemblBaseObj{
+				{End: 10, EnsemblId: "ENSE0001", Start: 1, Transcript: "ENST0001"},
+				{End: 10, EnsemblId: "ENSE0001", Start: 1, Transcript: "ENST0002"},
+			},
+		},
+		"Exons of transcript": {
+			"transcript",
+			`{"id": "ENST0001", "Exon": [{"id": "ENSE0001", "start": 1, "end": 10}]}`,
+			[]EnsemblBaseObj{
+				{End: 10, EnsemblId: "ENSE0001", Start: 1, Transcript: "ENST0001"},
+			},
+		},
+		"Coding region of transcript": {
+			"transcript",
+			`{"id": "ENST0001", "biotype": "protein_coding", "Translation": {"id": "ENSP0001", "start": 5, "end": 30}, "Exon": [{"id": "ENSE0001", "start": 1, "end": 10}]}`,
+			[]EnsemblBaseObj{
+				{Biotype: "protein_coding", CodingEnd: 30, CodingStart: 5, End: 10, EnsemblId: "ENSE0001", Start: 1, Transcript: "ENST0001"},
+			},
+		},
+		"No exons for exon": {
+			"exon",
+			`{"id": "ENSE0001", "start": 1, "end": 10}`,
+			nil,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result, err := parseExons(c.class, []byte(c.body))
+			checkError(t, err, false)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -12,13 +12,17 @@ var extractCmd = &cobra.Command{
 	Short: "Extract genetic regions from database",
 	Long:  `Extract genetic regions from corresponding lists in database and generate bed file`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := session.initDbConnection(); err != nil {
+		ctx := cmd.Context()
+		if err := session.initDbConnection(ctx); err != nil {
 			log.Fatalf("%v", err)
 		}
-		if err := getExtractFlags(*cmd); err != nil {
+		if err := checkSchemaVersion(ctx); err != nil {
 			log.Fatalf("%v", err)
 		}
-		if err := dbToTsv(); err != nil {
+		if err := getExtractFlags(ctx, *cmd); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := extractTargets(ctx); err != nil {
 			log.Fatalf("%v", err)
 		}
 	},
@@ -29,9 +33,19 @@ func init() {
 	rootCmd.AddCommand(extractCmd)
 
 	// Add flags to extract command
-	extractCmd.PersistentFlags().String("analysis", "", "choose analysis (cnv, pindel, snv, sv)")
-	extractCmd.PersistentFlags().String("bed", "", `set individual bed file name (default "tables_analysis_build_timestamp.bed")`)
-	extractCmd.PersistentFlags().String("build", "38", "choose genome build")
+	extractCmd.PersistentFlags().String("analysis", "", "choose analysis, comma-separated for several (cnv, pindel, snv, sv)")
+	extractCmd.PersistentFlags().String("bed", "", `set individual bed file name, "-" writes to stdout (default "tables_analysis_build_timestamp.bed")`)
+	extractCmd.PersistentFlags().Bool("bgzip", false, "compress output with bgzip and index BED files with tabix, implied by a .gz file name")
+	extractCmd.PersistentFlags().String("build", "38", "choose genome build, comma-separated for several (37, 38)")
 	extractCmd.PersistentFlags().Bool("chr", true, "use chr-prefix for chromosome ids")
+	extractCmd.PersistentFlags().String("exon-mode", "full", "choose exon intervals of genes and transcripts (full, cds, cds_utr)")
+	extractCmd.PersistentFlags().StringVar(&session.PaddingRules, "padding", session.PaddingRules, "override padding in bp per class, optionally per analysis (e.g. exon=20,sv:gene=100)")
+	extractCmd.PersistentFlags().String("format", "bed", "choose output format (bed, bed6, bed12, interval_list, intervals)")
+	extractCmd.PersistentFlags().String("pinned", "", "tsv with columns id and transcript pinning one transcript per gene")
+	extractCmd.PersistentFlags().Bool("provenance-header", false, "add the provenance recorded in the manifest as header lines")
+	extractCmd.PersistentFlags().BoolVar(&session.ResolveMissing, "resolve-missing", false, "query the annotation source for regions without stored coordinates or exons instead of failing")
+	extractCmd.PersistentFlags().String("release", "", "comma-separated list of releases to be included instead of tables (e.g. aml@2.1)")
+	extractCmd.PersistentFlags().String("sequence-dictionary", "", "Picard .dict file used as header of interval_list output (default primary assembly)")
 	extractCmd.PersistentFlags().String("tables", "", "comma-separated list of tables to be included")
+	extractCmd.PersistentFlags().String("transcripts", "all", "choose transcripts of genes (all, canonical, mane_select, mane_plus_clinical, pinned)")
 }
@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IntervalFormat turns sorted regions with 1-based, closed coordinates into
+// the lines of an interval file
+type IntervalFormat interface {
+	extension() string
+	header(comments []string) (lines []string, err error)
+	indexable() bool
+	toSlices(regions []EnsemblBaseObj) (lines [][]string)
+}
+
+type bedFormat struct {
+	columns int
+}
+
+type bed12Format struct{}
+
+type intervalListFormat struct {
+	build      string
+	dictionary string
+}
+
+type gatkIntervalsFormat struct{}
+
+func getIntervalFormat(name string) (format IntervalFormat, err error) {
+	switch name {
+	case "", "bed":
+		format = bedFormat{columns: 4}
+	case "bed6":
+		format = bedFormat{columns: 6}
+	case "bed12":
+		format = bed12Format{}
+	case "interval_list":
+		format = intervalListFormat{build: session.Build, dictionary: session.SequenceDictionary}
+	case "intervals":
+		format = gatkIntervalsFormat{}
+	default:
+		err = errors.New(fmt.Sprintf("%s is not a valid format (bed, bed6, bed12, interval_list, intervals)", name))
+	}
+	return
+}
+
+func (f bedFormat) extension() string {
+	return "bed"
+}
+
+func (f bedFormat) header(comments []string) (lines []string, err error) {
+	lines = commentLines(comments)
+	return
+}
+
+func (f bedFormat) indexable() bool {
+	return true
+}
+
+// toSlices merges overlapping regions and writes 0-based, half-open starts
+func (f bedFormat) toSlices(regions []EnsemblBaseObj) (lines [][]string) {
+	for _, region := range mergeRegions(regions) {
+		line := []string{getChromosomeName(region.Chromosome), strconv.Itoa(region.Start - 1), strconv.Itoa(region.End), region.Annotation}
+		if f.columns == 6 {
+			line = append(line, "0", formatStrand(region.Strand, "."))
+		}
+		lines = append(lines, line)
+	}
+	return
+}
+
+func (f bed12Format) extension() string {
+	return "bed"
+}
+
+func (f bed12Format) header(comments []string) (lines []string, err error) {
+	lines = commentLines(comments)
+	return
+}
+
+func (f bed12Format) indexable() bool {
+	return true
+}
+
+// toSlices writes one gene model per list entry with its exons as blocks and
+// the coding region as thick part
+func (f bed12Format) toSlices(regions []EnsemblBaseObj) (lines [][]string) {
+	groups := make(map[string][]EnsemblBaseObj)
+	var order []string
+	for _, region := range regions {
+		key := fmt.Sprintf("%s\t%s", region.Chromosome, strings.Split(region.Annotation, "|")[0])
+		if _, present := groups[key]; !present {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], region)
+	}
+	for _, key := range order {
+		blocks := mergeRegions(groups[key])
+		first, last := blocks[0], blocks[len(blocks)-1]
+		start, end := first.Start-1, last.End
+		thickStart, thickEnd := start, start
+		coding := false
+		var sizes, starts []string
+		strand := first.Strand
+		for _, block := range blocks {
+			sizes = append(sizes, strconv.Itoa(block.End-block.Start+1))
+			starts = append(starts, strconv.Itoa(block.Start-1-start))
+			if block.Strand != strand {
+				strand = 0
+			}
+		}
+		for _, region := range groups[key] {
+			if region.CodingStart == 0 {
+				continue
+			}
+			codingStart, codingEnd := max(region.CodingStart-1, start), min(region.CodingEnd, end)
+			if !coding {
+				thickStart, thickEnd, coding = codingStart, codingEnd, true
+				continue
+			}
+			thickStart, thickEnd = min(thickStart, codingStart), max(thickEnd, codingEnd)
+		}
+		lines = append(lines, []string{
+			getChromosomeName(first.Chromosome),
+			strconv.Itoa(start),
+			strconv.Itoa(end),
+			strings.Split(key, "\t")[1],
+			"0",
+			formatStrand(strand, "."),
+			strconv.Itoa(thickStart),
+			strconv.Itoa(thickEnd),
+			"0",
+			strconv.Itoa(len(blocks)),
+			strings.Join(sizes, ",") + ",",
+			strings.Join(starts, ",") + ",",
+		})
+	}
+	return
+}
+
+func (f intervalListFormat) extension() string {
+	return "interval_list"
+}
+
+// header writes the sequence dictionary in front of the comments, which
+// Picard only accepts as @CO lines
+func (f intervalListFormat) header(comments []string) (lines []string, err error) {
+	if f.dictionary != "" {
+		if lines, err = readSequenceDictionary(f.dictionary); err != nil {
+			return
+		}
+	} else {
+		lengths, present := chromosomeLengths[f.build]
+		if !present {
+			err = errors.New(fmt.Sprintf("No sequence dictionary is known for GRCh%s", f.build))
+			return
+		}
+		lines = append(lines, "@HD\tVN:1.6\tSO:coordinate")
+		for _, chromosome := range generateChromosomeSlice() {
+			lines = append(lines, fmt.Sprintf("@SQ\tSN:%s\tLN:%d", getChromosomeName(chromosome), lengths[chromosome]))
+		}
+	}
+	for _, comment := range comments {
+		lines = append(lines, fmt.Sprintf("@CO\t%s", comment))
+	}
+	return
+}
+
+func (f intervalListFormat) indexable() bool {
+	return false
+}
+
+func (f intervalListFormat) toSlices(regions []EnsemblBaseObj) (lines [][]string) {
+	for _, region := range mergeRegions(regions) {
+		lines = append(lines, []string{getChromosomeName(region.Chromosome), strconv.Itoa(region.Start), strconv.Itoa(region.End), formatStrand(region.Strand, "+"), region.Annotation})
+	}
+	return
+}
+
+func (f gatkIntervalsFormat) extension() string {
+	return "intervals"
+}
+
+// header leaves out comments as GATK reads every line as an interval
+func (f gatkIntervalsFormat) header(comments []string) (lines []string, err error) {
+	return
+}
+
+func (f gatkIntervalsFormat) indexable() bool {
+	return false
+}
+
+func (f gatkIntervalsFormat) toSlices(regions []EnsemblBaseObj) (lines [][]string) {
+	for _, region := range mergeRegions(regions) {
+		lines = append(lines, []string{fmt.Sprintf("%s:%d-%d", getChromosomeName(region.Chromosome), region.Start, region.End)})
+	}
+	return
+}
+
+// readSequenceDictionary keeps the header lines of a Picard .dict file
+func readSequenceDictionary(path string) (lines []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not read sequence dictionary %s", path))
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "@HD") || strings.HasPrefix(line, "@SQ") {
+			lines = append(lines, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not read sequence dictionary %s", path))
+		return
+	}
+	if len(lines) == 0 {
+		err = errors.New(fmt.Sprintf("Sequence dictionary %s has no @SQ lines", path))
+	}
+	return
+}
+
+func commentLines(comments []string) (lines []string) {
+	for _, comment := range comments {
+		lines = append(lines, fmt.Sprintf("# %s", comment))
+	}
+	return
+}
+
+func getChromosomeName(chromosome string) string {
+	if session.Chr {
+		return fmt.Sprintf("chr%s", chromosome)
+	}
+	return chromosome
+}
+
+func formatStrand(strand int, unknown string) string {
+	switch strand {
+	case 1:
+		return "+"
+	case -1:
+		return "-"
+	}
+	return unknown
+}
+
+func parseStrand(value string) int {
+	switch value {
+	case "+":
+		return 1
+	case "-":
+		return -1
+	}
+	return 0
+}
+
+// mergeRegions joins overlapping regions of sorted input. Merged regions keep
+// a strand only if all parts share it.
+func mergeRegions(regions []EnsemblBaseObj) (merged []EnsemblBaseObj) {
+	for i, region := range regions {
+		// Padding must not reach beyond the start of a chromosome
+		if region.Start < 1 {
+			region.Start = 1
+		}
+		if i == 0 || !identifyOverlap(merged[len(merged)-1], region) {
+			merged = append(merged, region)
+			continue
+		}
+		last := &merged[len(merged)-1]
+		last.Annotation = fmt.Sprintf("%s;%s", last.Annotation, region.Annotation)
+		if region.Start < last.Start {
+			last.Start = region.Start
+		}
+		if region.End > last.End {
+			last.End = region.End
+		}
+		if region.Strand != last.Strand {
+			last.Strand = 0
+		}
+	}
+	return
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+var formatRegions = []EnsemblBaseObj{
+	{Annotation: "GENE1|ENSG001|ENST001|ENSE001", Chromosome: "1", CodingEnd: 180, CodingStart: 120, End: 150, Start: 100, Strand: -1},
+	{Annotation: "GENE1|ENSG001|ENST001|ENSE002", Chromosome: "1", CodingEnd: 180, CodingStart: 120, End: 200, Start: 140, Strand: -1},
+	{Annotation: "GENE1|ENSG001|ENST001|ENSE003", Chromosome: "1", CodingEnd: 180, CodingStart: 120, End: 400, Start: 301, Strand: -1},
+	{Annotation: "REGION1", Chromosome: "2", End: 20, Start: 1},
+}
+
+func TestFormatToSlices(t *testing.T) {
+	var cases = map[string]struct {
+		format string
+		result [][]string
+	}{
+		"BED with 0-based starts": {
+			"bed",
+			[][]string{
+				{"chr1", "99", "200", "GENE1|ENSG001|ENST001|ENSE001;GENE1|ENSG001|ENST001|ENSE002"},
+				{"chr1", "300", "400", "GENE1|ENSG001|ENST001|ENSE003"},
+				{"chr2", "0", "20", "REGION1"},
+			},
+		},
+		"BED6 with strand": {
+			"bed6",
+			[][]string{
+				{"chr1", "99", "200", "GENE1|ENSG001|ENST001|ENSE001;GENE1|ENSG001|ENST001|ENSE002", "0", "-"},
+				{"chr1", "300", "400", "GENE1|ENSG001|ENST001|ENSE003", "0", "-"},
+				{"chr2", "0", "20", "REGION1", "0", "."},
+			},
+		},
+		"BED12 gene models": {
+			"bed12",
+			[][]string{
+				{"chr1", "99", "400", "GENE1", "0", "-", "119", "180", "0", "2", "101,100,", "0,201,"},
+				{"chr2", "0", "20", "REGION1", "0", ".", "0", "0", "0", "1", "20,", "0,"},
+			},
+		},
+		"Picard interval list with 1-based starts": {
+			"interval_list",
+			[][]string{
+				{"chr1", "100", "200", "-", "GENE1|ENSG001|ENST001|ENSE001;GENE1|ENSG001|ENST001|ENSE002"},
+				{"chr1", "301", "400", "-", "GENE1|ENSG001|ENST001|ENSE003"},
+				{"chr2", "1", "20", "+", "REGION1"},
+			},
+		},
+		"GATK intervals": {
+			"intervals",
+			[][]string{
+				{"chr1:100-200"},
+				{"chr1:301-400"},
+				{"chr2:1-20"},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{Build: "38", Chr: true}
+			format, err := getIntervalFormat(c.format)
+			checkError(t, err, false)
+			result := format.toSlices(formatRegions)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestFormatHeader(t *testing.T) {
+	var cases = map[string]struct {
+		format     string
+		dictionary string
+		result     []string
+		wantErr    bool
+	}{
+		"BED comments": {
+			"bed6",
+			"",
+			[]string{"# build: GRCh37"},
+			false,
+		},
+		"Interval list with sequence dictionary": {
+			"interval_list",
+			"@HD\tVN:1.6\n@SQ\tSN:1\tLN:249250621\tM5:1b22b98cdeb4a9304cb5d48026a85128\n",
+			[]string{"@HD\tVN:1.6", "@SQ\tSN:1\tLN:249250621\tM5:1b22b98cdeb4a9304cb5d48026a85128", "@CO\tbuild: GRCh37"},
+			false,
+		},
+		"Sequence dictionary is empty": {
+			"interval_list",
+			"\n",
+			nil,
+			true,
+		},
+		"GATK intervals have no comments": {
+			"intervals",
+			"",
+			nil,
+			false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{Build: "37"}
+			if c.dictionary != "" {
+				session.SequenceDictionary = writeAnnotation(t, "reference.dict", c.dictionary)
+			}
+			format, err := getIntervalFormat(c.format)
+			checkError(t, err, false)
+			result, err := format.header([]string{"build: GRCh37"})
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestIntervalListDefaultDictionary(t *testing.T) {
+	session = Session{Build: "38", Chr: true}
+	format, err := getIntervalFormat("interval_list")
+	checkError(t, err, false)
+	result, err := format.header(nil)
+	checkError(t, err, false)
+	if len(result) != 26 || result[0] != "@HD\tVN:1.6\tSO:coordinate" || result[1] != "@SQ\tSN:chr1\tLN:248956422" || result[25] != "@SQ\tSN:chrM\tLN:16569" {
+		t.Errorf("Unexpected sequence dictionary %v", result)
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -9,14 +10,23 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func getExtractFlags(cmd cobra.Command) (err error) {
-	if err = validateAnalysis(cmd); err != nil {
+func getExtractFlags(ctx context.Context, cmd cobra.Command) (err error) {
+	if err = validateTargets(cmd); err != nil {
 		return
 	}
-	if err = validateBuild(cmd); err != nil {
+	if err = validateSelection(ctx, cmd); err != nil {
 		return
 	}
-	if err = validateTables(cmd); err != nil {
+	if err = validateTranscripts(cmd); err != nil {
+		return
+	}
+	if err = validateExonMode(cmd); err != nil {
+		return
+	}
+	if _, err = parsePaddingRules(session.PaddingRules); err != nil {
+		return
+	}
+	if err = validateFormat(cmd); err != nil {
 		return
 	}
 	if err = getBedName(cmd); err != nil {
@@ -25,48 +35,198 @@ func getExtractFlags(cmd cobra.Command) (err error) {
 	if session.Chr, err = cmd.Flags().GetBool("chr"); err != nil {
 		return
 	}
+	if session.ProvenanceHeader, err = cmd.Flags().GetBool("provenance-header"); err != nil {
+		return
+	}
 	return
 }
 
-func validateAnalysis(cmd cobra.Command) (err error) {
-	analysis, err := cmd.Flags().GetString("analysis")
+// validateTargets combines every requested build with every requested analysis
+func validateTargets(cmd cobra.Command) (err error) {
+	analyses, err := validateAnalysis(cmd)
 	if err != nil {
 		return
 	}
-	if _, valid := analyses[analysis]; !valid {
-		err = errors.New(fmt.Sprintf("%s is not a valid analysis", analysis))
+	builds, err := validateBuild(cmd)
+	if err != nil {
 		return
-	} else {
-		session.Analysis = analysis
 	}
+	session.Targets = nil
+	for _, build := range builds {
+		for _, analysis := range analyses {
+			session.Targets = append(session.Targets, Target{Analysis: analysis, Build: build})
+		}
+	}
+	session.Analysis = analyses[0]
+	session.Build = builds[0]
 	return
 }
 
-func validateBuild(cmd cobra.Command) (err error) {
+// splitTargets lists the distinct analyses and builds of targets in order
+func splitTargets(targets []Target) (analyses []string, targetBuilds []string) {
+	seenAnalyses := make(map[string]struct{})
+	seenBuilds := make(map[string]struct{})
+	for _, target := range targets {
+		if _, present := seenAnalyses[target.Analysis]; !present {
+			seenAnalyses[target.Analysis] = struct{}{}
+			analyses = append(analyses, target.Analysis)
+		}
+		if _, present := seenBuilds[target.Build]; !present {
+			seenBuilds[target.Build] = struct{}{}
+			targetBuilds = append(targetBuilds, target.Build)
+		}
+	}
+	return
+}
+
+func validateAnalysis(cmd cobra.Command) (selected []string, err error) {
+	analysis, err := cmd.Flags().GetString("analysis")
+	if err != nil {
+		return
+	}
+	seen := make(map[string]struct{})
+	for _, value := range strings.Split(analysis, ",") {
+		if _, valid := analyses[value]; !valid {
+			err = errors.New(fmt.Sprintf("%s is not a valid analysis", value))
+			return
+		}
+		if _, present := seen[value]; !present {
+			seen[value] = struct{}{}
+			selected = append(selected, value)
+		}
+	}
+	return
+}
+
+func validateBuild(cmd cobra.Command) (builds []string, err error) {
 	build, err := cmd.Flags().GetString("build")
 	if err != nil {
 		return
 	}
-	if build == "38" || build == "37" {
-		session.Build = build
-	} else {
-		err = errors.New(fmt.Sprintf("%s is not a valid genome build", build))
+	seen := make(map[string]struct{})
+	for _, value := range strings.Split(build, ",") {
+		if value != "38" && value != "37" {
+			err = errors.New(fmt.Sprintf("%s is not a valid genome build", value))
+			return
+		}
+		if _, present := seen[value]; !present {
+			seen[value] = struct{}{}
+			builds = append(builds, value)
+		}
+	}
+	return
+}
+
+func validateTranscripts(cmd cobra.Command) (err error) {
+	policy, err := cmd.Flags().GetString("transcripts")
+	if err != nil {
+		return
+	}
+	if _, valid := transcriptPolicies[policy]; !valid {
+		err = errors.New(fmt.Sprintf("%s is not a valid transcript policy (all, canonical, mane_select, mane_plus_clinical, pinned)", policy))
+		return
+	}
+	session.Transcripts = policy
+	pinned, err := cmd.Flags().GetString("pinned")
+	if err != nil {
+		return
+	}
+	switch {
+	case policy == "pinned" && pinned == "":
+		err = errors.New("--transcripts pinned requires a file of pinned transcripts (--pinned)")
+	case policy != "pinned" && pinned != "":
+		err = errors.New("--pinned can only be used with --transcripts pinned")
+	case pinned != "":
+		session.PinnedTranscripts, err = loadPinnedTranscripts(pinned)
+	}
+	return
+}
+
+func validateExonMode(cmd cobra.Command) (err error) {
+	mode, err := cmd.Flags().GetString("exon-mode")
+	if err != nil {
+		return
 	}
+	if _, valid := exonModes[mode]; !valid {
+		err = errors.New(fmt.Sprintf("%s is not a valid exon mode (full, cds, cds_utr)", mode))
+		return
+	}
+	session.ExonMode = mode
 	return
 }
 
-func validateTables(cmd cobra.Command) (err error) {
-	dbTables, err := session.Db.Connection.getTables()
+func validateFormat(cmd cobra.Command) (err error) {
+	format, err := cmd.Flags().GetString("format")
 	if err != nil {
 		return
 	}
+	if _, err = getIntervalFormat(format); err != nil {
+		return
+	}
+	session.Format = format
+	if session.SequenceDictionary, err = cmd.Flags().GetString("sequence-dictionary"); err != nil {
+		return
+	}
+	if session.SequenceDictionary == "" {
+		return
+	}
+	_, targetBuilds := splitTargets(session.Targets)
+	switch {
+	case format != "interval_list":
+		err = errors.New("--sequence-dictionary can only be used with --format interval_list")
+	case len(targetBuilds) > 1:
+		err = errors.New("--sequence-dictionary cannot be used with several builds, a dictionary describes a single build")
+	}
+	return
+}
+
+func validateSelection(ctx context.Context, cmd cobra.Command) (err error) {
 	tables, err := cmd.Flags().GetString("tables")
-	for _, table := range strings.Split(tables, ",") {
-		if _, valid := dbTables[table]; !valid {
-			err = errors.New(fmt.Sprintf("table %s is not present in database", table))
+	if err != nil {
+		return
+	}
+	releases, err := cmd.Flags().GetString("release")
+	if err != nil {
+		return
+	}
+	switch {
+	case tables != "" && releases != "":
+		err = errors.New("--tables and --release cannot be combined")
+	case releases != "":
+		err = validateReleases(releases)
+	default:
+		err = validateTables(ctx, tables)
+	}
+	return
+}
+
+func validateReleases(releases string) (err error) {
+	for _, value := range strings.Split(releases, ",") {
+		var release Release
+		if release, err = parseRelease(value); err != nil {
+			return
+		}
+		session.Releases = append(session.Releases, release)
+	}
+	return
+}
+
+func validateTables(ctx context.Context, tables string) (err error) {
+	for _, list := range strings.Split(tables, ",") {
+		if err = validateListName(list); err != nil {
+			return
+		}
+	}
+	dbLists, err := session.Db.Connection.getLists(ctx)
+	if err != nil {
+		return
+	}
+	for _, list := range strings.Split(tables, ",") {
+		if _, valid := dbLists[list]; !valid {
+			err = errors.New(fmt.Sprintf("list %s is not present in database", list))
 			return
 		} else {
-			session.Tables = append(session.Tables, table)
+			session.Tables = append(session.Tables, list)
 		}
 	}
 	return
@@ -77,10 +237,41 @@ func getBedName(cmd cobra.Command) (err error) {
 	if err != nil {
 		return
 	}
-	if bed != "" {
+	if session.Bgzip, err = cmd.Flags().GetBool("bgzip"); err != nil {
+		return
+	}
+	if strings.HasSuffix(bed, ".gz") {
+		session.Bgzip = true
+	}
+	switch {
+	case bed != "" && len(session.Targets) > 1:
+		err = errors.New("--bed cannot be used with several analyses or builds, files are named after each analysis and build")
+	case bed != "":
 		session.Bed = bed
+	default:
+		session.Bed, err = getDefaultBedName()
+	}
+	return
+}
+
+// getDefaultBedName names files after their selection, analysis and build
+func getDefaultBedName() (name string, err error) {
+	format, err := getIntervalFormat(session.Format)
+	if err != nil {
+		return
+	}
+	extension := format.extension()
+	if session.Bgzip {
+		extension = fmt.Sprintf("%s.gz", extension)
+	}
+	if len(session.Releases) > 0 {
+		var names []string
+		for _, release := range session.Releases {
+			names = append(names, fmt.Sprintf("%s_%s", release.List, release.Version))
+		}
+		name = fmt.Sprintf("%s_%s_%s.%s", strings.Join(names, "_"), session.Analysis, session.Build, extension)
 	} else {
-		session.Bed = fmt.Sprintf("%s_%s_%s_%s.bed", strings.Join(session.Tables, "_"), session.Analysis, session.Build, time.Now().Format("2006-01-02"))
+		name = fmt.Sprintf("%s_%s_%s_%s.%s", strings.Join(session.Tables, "_"), session.Analysis, session.Build, time.Now().Format("2006-01-02"), extension)
 	}
 	return
 }
@@ -1,7 +1,223 @@
 package cmd
 
 import (
-//"testing"
+	"fmt"
+	"testing"
+	"time"
 
-//"github.com/go-test/deep"
+	"github.com/go-test/deep"
+	"github.com/spf13/cobra"
 )
+
+func getExtractTestCmd(t *testing.T, values map[string]string) cobra.Command {
+	cmd := cobra.Command{}
+	cmd.Flags().String("analysis", "", "")
+	cmd.Flags().String("bed", "", "")
+	cmd.Flags().Bool("bgzip", false, "")
+	cmd.Flags().String("build", "38", "")
+	cmd.Flags().String("format", "bed", "")
+	cmd.Flags().String("sequence-dictionary", "", "")
+	for name, value := range values {
+		if err := cmd.Flags().Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cmd
+}
+
+func TestValidateTargets(t *testing.T) {
+	var cases = map[string]struct {
+		analysis string
+		build    string
+		result   []Target
+		wantErr  bool
+	}{
+		"Single target": {
+			"snv",
+			"38",
+			[]Target{{Analysis: "snv", Build: "38"}},
+			false,
+		},
+		"Every build is combined with every analysis": {
+			"snv,cnv",
+			"38,37",
+			[]Target{
+				{Analysis: "snv", Build: "38"},
+				{Analysis: "cnv", Build: "38"},
+				{Analysis: "snv", Build: "37"},
+				{Analysis: "cnv", Build: "37"},
+			},
+			false,
+		},
+		"Repeated analyses and builds are dropped": {
+			"snv,cnv,snv",
+			"37,37",
+			[]Target{
+				{Analysis: "snv", Build: "37"},
+				{Analysis: "cnv", Build: "37"},
+			},
+			false,
+		},
+		"Invalid analysis": {
+			"snv,wgs",
+			"38",
+			nil,
+			true,
+		},
+		"Invalid build": {
+			"snv",
+			"38,19",
+			nil,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{}
+			cmd := getExtractTestCmd(t, map[string]string{"analysis": c.analysis, "build": c.build})
+			err := validateTargets(cmd)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(session.Targets, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestGetDefaultBedName(t *testing.T) {
+	var cases = map[string]struct {
+		session Session
+		result  string
+	}{
+		"Tables are named with date": {
+			Session{Analysis: "snv", Build: "38", Format: "bed", Tables: []string{"aml", "all"}},
+			fmt.Sprintf("aml_all_snv_38_%s.bed", time.Now().Format("2006-01-02")),
+		},
+		"Releases are named with version": {
+			Session{Analysis: "cnv", Build: "37", Format: "bed", Releases: []Release{{List: "aml", Version: "2.1"}}},
+			"aml_2.1_cnv_37.bed",
+		},
+		"Compressed interval list": {
+			Session{Analysis: "sv", Bgzip: true, Build: "38", Format: "interval_list", Releases: []Release{{List: "aml", Version: "1.0"}}},
+			"aml_1.0_sv_38.interval_list.gz",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = c.session
+			result, err := getDefaultBedName()
+			checkError(t, err, false)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestGetBedName(t *testing.T) {
+	var cases = map[string]struct {
+		bed     string
+		targets []Target
+		result  string
+		bgzip   bool
+		wantErr bool
+	}{
+		"File name of single target": {
+			"panel.bed",
+			[]Target{{Analysis: "snv", Build: "38"}},
+			"panel.bed",
+			false,
+			false,
+		},
+		"File name ending in .gz implies bgzip": {
+			"panel.bed.gz",
+			[]Target{{Analysis: "snv", Build: "38"}},
+			"panel.bed.gz",
+			true,
+			false,
+		},
+		"Default file name": {
+			"",
+			[]Target{{Analysis: "snv", Build: "38"}},
+			"aml_2.1_snv_38.bed",
+			false,
+			false,
+		},
+		"File name with several analyses": {
+			"panel.bed",
+			[]Target{{Analysis: "snv", Build: "38"}, {Analysis: "cnv", Build: "38"}},
+			"",
+			false,
+			true,
+		},
+		"File name with several builds": {
+			"panel.bed",
+			[]Target{{Analysis: "snv", Build: "38"}, {Analysis: "snv", Build: "37"}},
+			"",
+			false,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{Analysis: "snv", Build: "38", Format: "bed", Releases: []Release{{List: "aml", Version: "2.1"}}, Targets: c.targets}
+			cmd := getExtractTestCmd(t, map[string]string{"bed": c.bed})
+			err := getBedName(cmd)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(session.Bed, c.result); diff != nil {
+				t.Error(diff)
+			}
+			if session.Bgzip != c.bgzip {
+				t.Errorf("Expected bgzip %t, got %t", c.bgzip, session.Bgzip)
+			}
+		})
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	var cases = map[string]struct {
+		format     string
+		dictionary string
+		targets    []Target
+		wantErr    bool
+	}{
+		"Interval list with sequence dictionary": {
+			"interval_list",
+			"reference.dict",
+			[]Target{{Analysis: "snv", Build: "38"}, {Analysis: "cnv", Build: "38"}},
+			false,
+		},
+		"Sequence dictionary with several builds": {
+			"interval_list",
+			"reference.dict",
+			[]Target{{Analysis: "snv", Build: "38"}, {Analysis: "snv", Build: "37"}},
+			true,
+		},
+		"Sequence dictionary with bed": {
+			"bed",
+			"reference.dict",
+			[]Target{{Analysis: "snv", Build: "38"}},
+			true,
+		},
+		"Several builds without sequence dictionary": {
+			"interval_list",
+			"",
+			[]Target{{Analysis: "snv", Build: "38"}, {Analysis: "snv", Build: "37"}},
+			false,
+		},
+		"Invalid format": {
+			"vcf",
+			"",
+			[]Target{{Analysis: "snv", Build: "38"}},
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{Targets: c.targets}
+			cmd := getExtractTestCmd(t, map[string]string{"format": c.format, "sequence-dictionary": c.dictionary})
+			err := validateFormat(cmd)
+			checkError(t, err, c.wantErr)
+		})
+	}
+}
@@ -1,9 +1,8 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"regexp"
 	"sort"
 	"strings"
@@ -11,12 +10,12 @@ import (
 	"github.com/pkg/errors"
 )
 
-func (d DbTableRow) getPartners() (rows []DbTableRow, err error) {
+func (d DbTableRow) getPartners(ctx context.Context) (rows []DbTableRow, err error) {
 	url, err := getIdUrl(d.Id)
 	if err != nil {
 		return
 	}
-	lines, err := getHtmlPage(url)
+	lines, err := getHtmlPage(ctx, url)
 	if err != nil {
 		return
 	}
@@ -44,30 +43,16 @@ func getIdUrl(id string) (url string, err error) {
 	return
 }
 
-func getHtmlPage(url string) (lines []string, err error) {
-	body, err := sendHttpRequest(url)
-	if err != nil {
+func getHtmlPage(ctx context.Context, url string) (lines []string, err error) {
+	if session.Web.Offline {
+		err = errors.New(fmt.Sprintf("Cannot retrieve %s as --offline is set", url))
 		return
 	}
-	lines = strings.Split(string(body), "\n")
-	return
-}
-
-func sendHttpRequest(url string) (body []byte, err error) {
-	response, err := http.Get(url)
+	body, err := sendHttpRequest(ctx, url)
 	if err != nil {
-		err = errors.Wrap(err, fmt.Sprintf("Could not reach url %s", url))
 		return
 	}
-	if response.StatusCode != 200 {
-		err = errors.New(fmt.Sprintf("Request to %s returned %s", url, response.Status))
-		return
-	}
-	defer response.Body.Close()
-	body, err = ioutil.ReadAll(response.Body)
-	if err != nil {
-		err = errors.Wrap(err, fmt.Sprintf("Could not read response to request to %s", url))
-	}
+	lines = strings.Split(string(body), "\n")
 	return
 }
 
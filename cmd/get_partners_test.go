@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"testing"
 
 	"github.com/go-test/deep"
@@ -65,7 +66,7 @@ func TestGetPartners(t *testing.T) {
 				httpmock.NewStringResponder(200, `ABL1 (1p1.1) GENE2 (1q1.1)</li><li class="border list-group-item">GENE3 (10p14) ABL1</ul>`))
 			httpmock.RegisterResponder("GET", "/gene-fusions/?id=4",
 				httpmock.NewStringResponder(500, ""))
-			result, err := c.dbTableRow.getPartners()
+			result, err := c.dbTableRow.getPartners(context.Background())
 			checkError(t, err, c.wantErr)
 			if diff := deep.Equal(result, c.result); diff != nil {
 				t.Error(diff)
@@ -127,41 +128,7 @@ func TestGetHtmlPage(t *testing.T) {
 				httpmock.NewStringResponder(200, "ABL1\nBCR"))
 			httpmock.RegisterResponder("GET", "http://atlasgeneticsoncology.org/gene-fusions/?id=2",
 				httpmock.NewStringResponder(500, ""))
-			result, err := getHtmlPage(c.url)
-			checkError(t, err, c.wantErr)
-			if diff := deep.Equal(result, c.result); diff != nil {
-				t.Error(diff)
-			}
-		})
-	}
-}
-
-func TestSendHttpRequest(t *testing.T) {
-	var cases = map[string]struct {
-		url     string
-		result  []byte
-		wantErr bool
-	}{
-		"Successful request": {
-			"http://atlasgeneticsoncology.org/gene-fusions/?id=1",
-			[]byte("<ul>"),
-			false,
-		},
-		"Internal server error": {
-			"http://atlasgeneticsoncology.org/gene-fusions/?id=2",
-			nil,
-			true,
-		},
-	}
-	for name, c := range cases {
-		t.Run(name, func(t *testing.T) {
-			httpmock.Activate()
-			defer httpmock.DeactivateAndReset()
-			httpmock.RegisterResponder("GET", "http://atlasgeneticsoncology.org/gene-fusions/?id=1",
-				httpmock.NewStringResponder(200, `<ul>`))
-			httpmock.RegisterResponder("GET", "http://atlasgeneticsoncology.org/gene-fusions/?id=2",
-				httpmock.NewStringResponder(500, ""))
-			result, err := sendHttpRequest(c.url)
+			result, err := getHtmlPage(context.Background(), c.url)
 			checkError(t, err, c.wantErr)
 			if diff := deep.Equal(result, c.result); diff != nil {
 				t.Error(diff)
@@ -0,0 +1,362 @@
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var versionRegex = regexp.MustCompile(`^(ENS[A-Z]*\d+)\.\d+`)
+
+var gtfReleaseRegex = regexp.MustCompile(`\.(\d+)(\.chr)?\.(gtf|gff3)(\.gz)?$`)
+
+type gtfSource struct {
+	indexes map[string]*gtfIndex
+	mutex   sync.Mutex
+	paths   map[string]string
+}
+
+type gtfIndex struct {
+	biotypes        map[string]string
+	codingRegions   map[string]EnsemblBaseObj
+	exons           map[string]EnsemblBaseObj
+	geneNames       map[string][]string
+	geneTranscripts map[string][]string
+	genes           map[string]EnsemblBaseObj
+	tags            map[string][]string
+	transcriptExons map[string][]EnsemblBaseObj
+	transcriptNames map[string]string
+	transcripts     map[string]EnsemblBaseObj
+}
+
+func newGtfSource(paths map[string]string) *gtfSource {
+	return &gtfSource{
+		indexes: make(map[string]*gtfIndex),
+		paths:   paths,
+	}
+}
+
+func (g *gtfSource) getId(ctx context.Context, build string, class string, name string) (id string, err error) {
+	index, err := g.getIndex(build)
+	if err != nil {
+		return
+	}
+	id = index.getId(class, name)
+	return
+}
+
+func (g *gtfSource) lookupSymbols(ctx context.Context, build string, symbols []string) (ids map[string]string, err error) {
+	index, err := g.getIndex(build)
+	if err != nil {
+		return
+	}
+	ids = make(map[string]string)
+	for _, symbol := range symbols {
+		if id := index.getId("gene", symbol); id != "" {
+			ids[symbol] = id
+		}
+	}
+	return
+}
+
+func (g *gtfSource) getFeature(ctx context.Context, build string, id string, expand bool) (feature Feature, err error) {
+	index, err := g.getIndex(build)
+	if err != nil {
+		return
+	}
+	feature, found := index.getFeature(id, expand)
+	if !found {
+		err = errors.New(fmt.Sprintf("%s was not found in the GRCh%s annotation %s", id, build, g.paths[build]))
+	}
+	return
+}
+
+func (g *gtfSource) lookupFeatures(ctx context.Context, build string, ids []string, expand bool) (features map[string]Feature, err error) {
+	index, err := g.getIndex(build)
+	if err != nil {
+		return
+	}
+	features = make(map[string]Feature)
+	for _, id := range ids {
+		if feature, found := index.getFeature(id, expand); found {
+			features[id] = feature
+		}
+	}
+	return
+}
+
+// getRelease reads the Ensembl release from file names such as
+// Homo_sapiens.GRCh38.110.gtf.gz and falls back to the file name otherwise
+func (g *gtfSource) getRelease(ctx context.Context, build string) (release string, err error) {
+	path := g.paths[build]
+	if path == "" {
+		err = errors.New(fmt.Sprintf("No GRCh%s annotation file configured", build))
+		return
+	}
+	if match := gtfReleaseRegex.FindStringSubmatch(filepath.Base(path)); match != nil {
+		release = match[1]
+	} else {
+		release = strings.TrimSuffix(filepath.Base(path), ".gz")
+	}
+	return
+}
+
+func (g *gtfSource) getIndex(build string) (index *gtfIndex, err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if index = g.indexes[build]; index != nil {
+		return
+	}
+	path := g.paths[build]
+	if path == "" {
+		log.Printf("No GRCh%s annotation file configured (GTF_%s_PATH), regions are not resolved for GRCh%s", build, build, build)
+		index = newGtfIndex()
+	} else if index, err = loadGtf(path); err != nil {
+		return
+	}
+	g.indexes[build] = index
+	return
+}
+
+func newGtfIndex() *gtfIndex {
+	return &gtfIndex{
+		biotypes:        make(map[string]string),
+		codingRegions:   make(map[string]EnsemblBaseObj),
+		exons:           make(map[string]EnsemblBaseObj),
+		geneNames:       make(map[string][]string),
+		geneTranscripts: make(map[string][]string),
+		genes:           make(map[string]EnsemblBaseObj),
+		tags:            make(map[string][]string),
+		transcriptExons: make(map[string][]EnsemblBaseObj),
+		transcriptNames: make(map[string]string),
+		transcripts:     make(map[string]EnsemblBaseObj),
+	}
+}
+
+func loadGtf(path string) (index *gtfIndex, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not open annotation file %s", path))
+		return
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(file); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not decompress annotation file %s", path))
+			return
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	name := strings.TrimSuffix(path, ".gz")
+	gff := strings.HasSuffix(name, ".gff3") || strings.HasSuffix(name, ".gff")
+	index = newGtfIndex()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err = index.addLine(text, gff); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not parse line %d of %s", line, path))
+			return
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not read annotation file %s", path))
+		return
+	}
+	log.Printf("Indexed %d genes, %d transcripts and %d exons from %s", len(index.genes), len(index.transcripts), len(index.exons), path)
+	return
+}
+
+func (i *gtfIndex) addLine(line string, gff bool) (err error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 9 {
+		err = errors.New(fmt.Sprintf("Expected 9 columns but found %d", len(fields)))
+		return
+	}
+	var attributes map[string]string
+	if gff {
+		attributes = parseGffAttributes(fields[8])
+	} else {
+		attributes = parseGtfAttributes(fields[8])
+	}
+	region := EnsemblBaseObj{
+		Chromosome: strings.TrimPrefix(fields[0], "chr"),
+		Strand:     parseStrand(fields[6]),
+	}
+	if region.Start, err = strconv.Atoi(fields[3]); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("%s is not a valid start", fields[3]))
+		return
+	}
+	if region.End, err = strconv.Atoi(fields[4]); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("%s is not a valid end", fields[4]))
+		return
+	}
+	id := attributes["ID"]
+	switch {
+	case fields[2] == "CDS" || fields[2] == "stop_codon":
+		// Coding regions span all CDS parts of a transcript including the stop codon
+		transcript := getAttributeId(attributes, "transcript_id", "Parent", "transcript:")
+		if coding, present := i.codingRegions[transcript]; present {
+			if coding.Start < region.Start {
+				region.Start = coding.Start
+			}
+			if coding.End > region.End {
+				region.End = coding.End
+			}
+		}
+		i.codingRegions[transcript] = region
+	case fields[2] == "exon":
+		region.EnsemblId = getAttributeId(attributes, "exon_id", "Name", "exon:")
+		transcript := getAttributeId(attributes, "transcript_id", "Parent", "transcript:")
+		i.exons[region.EnsemblId] = region
+		region.Transcript = transcript
+		i.transcriptExons[transcript] = append(i.transcriptExons[transcript], region)
+	case fields[2] == "gene" || strings.HasPrefix(id, "gene:"):
+		region.EnsemblId = getAttributeId(attributes, "gene_id", "ID", "gene:")
+		i.genes[region.EnsemblId] = region
+		if name := getAttribute(attributes, "gene_name", "Name"); name != "" {
+			i.geneNames[name] = append(i.geneNames[name], region.EnsemblId)
+		}
+	case fields[2] == "transcript" || strings.HasPrefix(id, "transcript:"):
+		region.EnsemblId = getAttributeId(attributes, "transcript_id", "ID", "transcript:")
+		gene := getAttributeId(attributes, "gene_id", "Parent", "gene:")
+		i.transcripts[region.EnsemblId] = region
+		i.tags[region.EnsemblId] = splitTags(attributes["tag"])
+		biotype := getAttribute(attributes, "transcript_type", "transcript_biotype", "biotype")
+		if biotype == "" {
+			biotype = fields[2]
+		}
+		i.biotypes[region.EnsemblId] = biotype
+		i.geneTranscripts[gene] = append(i.geneTranscripts[gene], region.EnsemblId)
+		if name := getAttribute(attributes, "transcript_name", "Name"); name != "" {
+			i.transcriptNames[name] = region.EnsemblId
+		}
+	}
+	return
+}
+
+func (i *gtfIndex) getId(class string, name string) (id string) {
+	switch class {
+	case "gene":
+		// Prefer the copy on a primary chromosome as the Ensembl lookup does
+		chromosomes := generateChromosomeMap()
+		for _, candidate := range i.geneNames[name] {
+			if chromosomes[i.genes[candidate].Chromosome] {
+				id = candidate
+				return
+			}
+		}
+	case "transcript":
+		id = i.transcriptNames[name]
+	case "exon":
+		if _, present := i.exons[name]; present {
+			id = name
+		}
+	}
+	return
+}
+
+func (i *gtfIndex) getFeature(id string, expand bool) (feature Feature, found bool) {
+	var transcripts []string
+	if feature.Region, found = i.genes[id]; found {
+		transcripts = i.geneTranscripts[id]
+	} else if feature.Region, found = i.transcripts[id]; found {
+		transcripts = []string{id}
+	} else if feature.Region, found = i.exons[id]; found {
+		return
+	} else {
+		return
+	}
+	if !expand {
+		return
+	}
+	for _, transcript := range transcripts {
+		coding, isCoding := i.codingRegions[transcript]
+		for _, exon := range i.transcriptExons[transcript] {
+			exon.Biotype = i.biotypes[transcript]
+			if isCoding {
+				exon.CodingStart = coding.Start
+				exon.CodingEnd = coding.End
+			}
+			exon.Tags = i.tags[transcript]
+			feature.Exons = append(feature.Exons, exon)
+		}
+	}
+	return
+}
+
+func parseGtfAttributes(column string) (attributes map[string]string) {
+	attributes = make(map[string]string)
+	for _, attribute := range strings.Split(column, ";") {
+		attribute = strings.TrimSpace(attribute)
+		if attribute == "" {
+			continue
+		}
+		pair := strings.SplitN(attribute, " ", 2)
+		if len(pair) != 2 {
+			continue
+		}
+		addAttribute(attributes, pair[0], strings.Trim(pair[1], `"`))
+	}
+	return
+}
+
+func parseGffAttributes(column string) (attributes map[string]string) {
+	attributes = make(map[string]string)
+	for _, attribute := range strings.Split(column, ";") {
+		pair := strings.SplitN(strings.TrimSpace(attribute), "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+		value, err := neturl.PathUnescape(pair[1])
+		if err != nil {
+			value = pair[1]
+		}
+		addAttribute(attributes, pair[0], value)
+	}
+	return
+}
+
+// addAttribute joins repeated GTF keys the way GFF3 lists multiple values
+func addAttribute(attributes map[string]string, key string, value string) {
+	if previous, present := attributes[key]; present {
+		value = fmt.Sprintf("%s,%s", previous, value)
+	}
+	attributes[key] = value
+}
+
+func getAttribute(attributes map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := attributes[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// getAttributeId returns an unversioned Ensembl id from GENCODE or Ensembl style attributes
+func getAttributeId(attributes map[string]string, key string, fallback string, prefix string) string {
+	id := attributes[key]
+	if id == "" {
+		id = strings.TrimPrefix(attributes[fallback], prefix)
+	}
+	return versionRegex.ReplaceAllString(id, "$1")
+}
@@ -0,0 +1,387 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+var gencodeGtf = strings.Join([]string{
+	"##description: evidence-based annotation of the human genome (GRCh38)",
+	"chr17\tHAVANA\tgene\t7661779\t7687538\t.\t-\t.\tgene_id \"ENSG00000141510.17\"; gene_type \"protein_coding\"; gene_name \"TP53\";",
+	"chr17\tHAVANA\ttranscript\t7661779\t7687538\t.\t-\t.\tgene_id \"ENSG00000141510.17\"; transcript_id \"ENST00000269305.9\"; gene_name \"TP53\"; transcript_type \"protein_coding\"; transcript_name \"TP53-201\"; tag \"basic\"; tag \"Ensembl_canonical\";",
+	"chr17\tHAVANA\texon\t7687377\t7687538\t.\t-\t.\tgene_id \"ENSG00000141510.17\"; transcript_id \"ENST00000269305.9\"; exon_number 1; exon_id \"ENSE00001146308.1\";",
+	"chr17\tHAVANA\tCDS\t7676521\t7676594\t.\t-\t0\tgene_id \"ENSG00000141510.17\"; transcript_id \"ENST00000269305.9\"; exon_number 2; exon_id \"ENSE00001596491.1\";",
+	"chr17\tHAVANA\texon\t7676521\t7676622\t.\t-\t.\tgene_id \"ENSG00000141510.17\"; transcript_id \"ENST00000269305.9\"; exon_number 2; exon_id \"ENSE00001596491.1\";",
+	"KI270728.1\tENSEMBL\tgene\t1000\t2000\t.\t+\t.\tgene_id \"ENSG00000280000.1\"; gene_name \"GENE1\";",
+	"chr1\tENSEMBL\tgene\t3000\t4000\t.\t+\t.\tgene_id \"ENSG00000280001.1\"; gene_name \"GENE1\";",
+}, "\n")
+
+var ensemblGff = strings.Join([]string{
+	"##gff-version 3",
+	"17\tensembl_havana\tgene\t7661779\t7687538\t.\t-\t.\tID=gene:ENSG00000141510;Name=TP53;biotype=protein_coding;gene_id=ENSG00000141510;version=17",
+	"17\tensembl_havana\tmRNA\t7661779\t7687538\t.\t-\t.\tID=transcript:ENST00000269305;Parent=gene:ENSG00000141510;Name=TP53-201;biotype=protein_coding;tag=basic,Ensembl_canonical;transcript_id=ENST00000269305;version=9",
+	"17\tensembl_havana\texon\t7687377\t7687538\t.\t-\t.\tParent=transcript:ENST00000269305;Name=ENSE00001146308;exon_id=ENSE00001146308;rank=1;version=1",
+	"17\tensembl_havana\texon\t7676521\t7676622\t.\t-\t.\tParent=transcript:ENST00000269305;Name=ENSE00001596491;exon_id=ENSE00001596491;rank=2;version=1",
+	"17\tensembl_havana\tCDS\t7676521\t7676594\t.\t-\t0\tID=CDS:ENSP00000269305;Parent=transcript:ENST00000269305;protein_id=ENSP00000269305",
+	"###",
+}, "\n")
+
+func writeAnnotation(t *testing.T, name string, content string) (path string) {
+	path = filepath.Join(t.TempDir(), name)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if strings.HasSuffix(name, ".gz") {
+		gz := gzip.NewWriter(file)
+		defer gz.Close()
+		_, err = gz.Write([]byte(content))
+	} else {
+		_, err = file.Write([]byte(content))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestGtfSource(t *testing.T) {
+	tp53 := Feature{
+		Exons: []EnsemblBaseObj{
+			{Biotype: "protein_coding", Chromosome: "17", CodingEnd: 7676594, CodingStart: 7676521, End: 7687538, EnsemblId: "ENSE00001146308", Start: 7687377, Strand: -1, Tags: []string{"Ensembl_canonical"}, Transcript: "ENST00000269305"},
+			{Biotype: "protein_coding", Chromosome: "17", CodingEnd: 7676594, CodingStart: 7676521, End: 7676622, EnsemblId: "ENSE00001596491", Start: 7676521, Strand: -1, Tags: []string{"Ensembl_canonical"}, Transcript: "ENST00000269305"},
+		},
+		Region: EnsemblBaseObj{Chromosome: "17", End: 7687538, EnsemblId: "ENSG00000141510", Start: 7661779, Strand: -1},
+	}
+	var cases = map[string]struct {
+		name    string
+		content string
+	}{
+		"Compressed GENCODE GTF": {
+			"gencode.v44.annotation.gtf.gz",
+			gencodeGtf,
+		},
+		"Ensembl GFF3": {
+			"Homo_sapiens.GRCh38.110.gff3",
+			ensemblGff,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			source := newGtfSource(map[string]string{"38": writeAnnotation(t, c.name, c.content)})
+			ctx := context.Background()
+			id, err := source.getId(ctx, "38", "gene", "TP53")
+			checkError(t, err, false)
+			if diff := deep.Equal(id, "ENSG00000141510"); diff != nil {
+				t.Error(diff)
+			}
+			id, err = source.getId(ctx, "38", "transcript", "TP53-201")
+			checkError(t, err, false)
+			if diff := deep.Equal(id, "ENST00000269305"); diff != nil {
+				t.Error(diff)
+			}
+			ids, err := source.lookupSymbols(ctx, "38", []string{"TP53", "GENE9"})
+			checkError(t, err, false)
+			if diff := deep.Equal(ids, map[string]string{"TP53": "ENSG00000141510"}); diff != nil {
+				t.Error(diff)
+			}
+			feature, err := source.getFeature(ctx, "38", "ENSG00000141510", true)
+			checkError(t, err, false)
+			if diff := deep.Equal(feature, tp53); diff != nil {
+				t.Error(diff)
+			}
+			features, err := source.lookupFeatures(ctx, "38", []string{"ENSE00001146308", "ENSE0009"}, false)
+			checkError(t, err, false)
+			if diff := deep.Equal(features, map[string]Feature{"ENSE00001146308": {Region: EnsemblBaseObj{Chromosome: "17", End: 7687538, EnsemblId: "ENSE00001146308", Start: 7687377, Strand: -1}}}); diff != nil {
+				t.Error(diff)
+			}
+			_, err = source.getFeature(ctx, "38", "ENSG0009", true)
+			checkError(t, err, true)
+		})
+	}
+}
+
+func TestGtfIndexGetId(t *testing.T) {
+	var cases = map[string]struct {
+		class  string
+		name   string
+		result string
+	}{
+		"Gene on primary chromosome is preferred": {
+			"gene",
+			"GENE1",
+			"ENSG00000280001",
+		},
+		"Exon id is returned as is": {
+			"exon",
+			"ENSE00001146308",
+			"ENSE00001146308",
+		},
+		"Unknown transcript": {
+			"transcript",
+			"TP53-299",
+			"",
+		},
+	}
+	index := newGtfIndex()
+	for _, line := range strings.Split(gencodeGtf, "\n")[1:] {
+		if err := index.addLine(line, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result := index.getId(c.class, c.name)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestLoadGtf(t *testing.T) {
+	var cases = map[string]struct {
+		content string
+		wantErr bool
+	}{
+		"Valid file": {
+			gencodeGtf,
+			false,
+		},
+		"Missing columns": {
+			"chr1\tHAVANA\tgene\t1\t10",
+			true,
+		},
+		"Invalid start": {
+			"chr1\tHAVANA\tgene\tone\t10\t.\t+\t.\tgene_id \"ENSG0001\";",
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadGtf(writeAnnotation(t, "annotation.gtf", c.content))
+			checkError(t, err, c.wantErr)
+		})
+	}
+}
+
+func TestParseGtfAttributes(t *testing.T) {
+	var cases = map[string]struct {
+		column string
+		gff    bool
+		result map[string]string
+	}{
+		"GTF with repeated tags": {
+			`gene_id "ENSG0001.1"; exon_number 2; tag "basic"; tag "Ensembl_canonical";`,
+			false,
+			map[string]string{"exon_number": "2", "gene_id": "ENSG0001.1", "tag": "basic,Ensembl_canonical"},
+		},
+		"GFF3 with escaped values": {
+			"ID=gene:ENSG0001;Name=GENE1;description=tumor protein p53 %3B TP53",
+			true,
+			map[string]string{"ID": "gene:ENSG0001", "Name": "GENE1", "description": "tumor protein p53 ; TP53"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var result map[string]string
+			if c.gff {
+				result = parseGffAttributes(c.column)
+			} else {
+				result = parseGtfAttributes(c.column)
+			}
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestLookupCoordinatesFromGtf(t *testing.T) {
+	session = Session{
+		Annotation: annotation{
+			Gtf38:  writeAnnotation(t, "annotation.gtf", gencodeGtf),
+			Source: "gtf",
+		},
+	}
+	rows := []DbTableRow{
+		{Class: "gene", Id: "TP53"},
+		{Class: "gene", Id: "GENE9"},
+		{Class: "region", Id: "REGION1"},
+	}
+	if err := lookupEnsemblIds(context.Background(), rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := lookupCoordinates(context.Background(), rows, builds); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(rows[0].EnsemblId38, "ENSG00000141510"); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(rows[0].EnsemblId37, ""); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(rows[0].Coordinates["38"].Start, 7661779); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(len(rows[0].Exons["38"]), 2); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(rows[1].EnsemblId38, ""); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestGetAnnotationSource(t *testing.T) {
+	var cases = map[string]struct {
+		source  string
+		wantErr bool
+	}{
+		"Default to Ensembl": {
+			"",
+			false,
+		},
+		"Local annotation": {
+			"gtf",
+			false,
+		},
+		"Unknown source": {
+			"ucsc",
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{
+				Annotation: annotation{
+					Source: c.source,
+				},
+			}
+			_, err := getAnnotationSource()
+			checkError(t, err, c.wantErr)
+		})
+	}
+}
+
+func TestGtfGetRelease(t *testing.T) {
+	var cases = map[string]struct {
+		path    string
+		result  string
+		wantErr bool
+	}{
+		"Ensembl GTF": {
+			"/data/Homo_sapiens.GRCh38.110.gtf.gz",
+			"110",
+			false,
+		},
+		"Ensembl GFF3 with chromosomes only": {
+			"/data/Homo_sapiens.GRCh37.87.chr.gff3",
+			"87",
+			false,
+		},
+		"File name is used otherwise": {
+			"/data/gencode.v44.annotation.gtf.gz",
+			"gencode.v44.annotation.gtf",
+			false,
+		},
+		"No file configured": {
+			"",
+			"",
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			source := newGtfSource(map[string]string{"38": c.path})
+			result, err := source.getRelease(context.Background(), "38")
+			checkError(t, err, c.wantErr)
+			if result != c.result {
+				t.Errorf("Expected release %s, got %s", c.result, result)
+			}
+		})
+	}
+}
+
+func TestGetLiveRelease(t *testing.T) {
+	var cases = map[string]struct {
+		build   string
+		pinned  string
+		check   string
+		result  string
+		wantErr bool
+	}{
+		"Nothing pinned": {
+			"38",
+			"",
+			"",
+			"110",
+			false,
+		},
+		"Pinned release is used": {
+			"38",
+			"110",
+			"strict",
+			"110",
+			false,
+		},
+		"Different release is reported": {
+			"38",
+			"109",
+			"warn",
+			"110",
+			false,
+		},
+		"Different release is refused": {
+			"38",
+			"109",
+			"strict",
+			"",
+			true,
+		},
+		"Unknown release is reported": {
+			"37",
+			"109",
+			"warn",
+			"",
+			false,
+		},
+		"Unknown release is refused": {
+			"37",
+			"109",
+			"strict",
+			"",
+			true,
+		},
+		"Invalid release check": {
+			"38",
+			"110",
+			"never",
+			"",
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{
+				Annotation: annotation{
+					Gtf38:        "/data/Homo_sapiens.GRCh38.110.gtf.gz",
+					Release:      c.pinned,
+					ReleaseCheck: c.check,
+					Source:       "gtf",
+				},
+			}
+			result, err := getLiveRelease(context.Background(), c.build)
+			checkError(t, err, c.wantErr)
+			if result != c.result {
+				t.Errorf("Expected release %s, got %s", c.result, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type hgncIndex struct {
+	aliases  map[string][]string
+	approved map[string]string
+	previous map[string][]string
+}
+
+// loadHgnc indexes approved, previous and alias symbols of an HGNC complete set file
+func loadHgnc(path string) (index *hgncIndex, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not read HGNC file %s", path))
+		return
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	tsv, err := reader.ReadAll()
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not read HGNC file %s", path))
+		return
+	}
+	if len(tsv) == 0 {
+		err = errors.New(fmt.Sprintf("File %s is empty", path))
+		return
+	}
+	columns := make(map[string]int)
+	for i, column := range tsv[0] {
+		columns[column] = i
+	}
+	for _, column := range []string{"symbol", "alias_symbol", "prev_symbol"} {
+		if _, present := columns[column]; !present {
+			err = errors.New(fmt.Sprintf("File %s needs the columns symbol, alias_symbol and prev_symbol", path))
+			return
+		}
+	}
+	parsed := &hgncIndex{
+		aliases:  make(map[string][]string),
+		approved: make(map[string]string),
+		previous: make(map[string][]string),
+	}
+	for i, row := range tsv[1:] {
+		if len(row) != len(tsv[0]) {
+			err = errors.New(fmt.Sprintf("Header and row length are differing for line %d of %s", i+2, path))
+			return
+		}
+		if status, present := columns["status"]; present && row[status] != "Approved" {
+			continue
+		}
+		symbol := strings.TrimSpace(row[columns["symbol"]])
+		parsed.approved[strings.ToUpper(symbol)] = symbol
+		addHgncSymbols(parsed.aliases, row[columns["alias_symbol"]], symbol)
+		addHgncSymbols(parsed.previous, row[columns["prev_symbol"]], symbol)
+	}
+	index = parsed
+	return
+}
+
+func addHgncSymbols(symbols map[string][]string, value string, approved string) {
+	for _, symbol := range strings.Split(strings.Trim(value, `"`), "|") {
+		if symbol = strings.ToUpper(strings.TrimSpace(symbol)); symbol != "" {
+			symbols[symbol] = append(symbols[symbol], approved)
+		}
+	}
+}
+
+// normalize returns the approved symbol of a previous symbol or an alias.
+// Approved symbols take precedence and unknown symbols are returned unchanged.
+func (h *hgncIndex) normalize(symbol string) (approved string, kind string, err error) {
+	key := strings.ToUpper(symbol)
+	approved = symbol
+	if _, present := h.approved[key]; present {
+		return
+	}
+	for _, lookup := range []struct {
+		kind    string
+		symbols map[string][]string
+	}{
+		{"previous symbol", h.previous},
+		{"alias", h.aliases},
+	} {
+		candidates := uniqueStrings(lookup.symbols[key])
+		if len(candidates) == 0 {
+			continue
+		}
+		if len(candidates) > 1 {
+			err = errors.New(fmt.Sprintf("%s is an ambiguous %s of %s", symbol, lookup.kind, strings.Join(candidates, ", ")))
+			return
+		}
+		approved = candidates[0]
+		kind = lookup.kind
+		return
+	}
+	return
+}
+
+// normalizeSymbol replaces an outdated gene symbol by the approved HGNC symbol.
+// Removals are left alone so that they match what is stored in the database.
+func (d *DbTableRow) normalizeSymbol() (err error) {
+	if session.Annotation.symbols == nil || d.Class != "gene" || d.Action == "remove" {
+		return
+	}
+	approved, kind, err := session.Annotation.symbols.normalize(d.Id)
+	if err != nil || approved == d.Id {
+		return
+	}
+	log.Printf("Replaced %s %s by approved symbol %s", kind, d.Id, approved)
+	d.Id = approved
+	return
+}
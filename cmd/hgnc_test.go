@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+var hgncCompleteSet = strings.Join([]string{
+	"hgnc_id\tsymbol\tname\tstatus\talias_symbol\tprev_symbol",
+	"HGNC:7132\tKMT2A\tlysine methyltransferase 2A\tApproved\t\"HRX|ALL-1|CXXC7\"\tMLL",
+	"HGNC:1014\tBCR\tBCR activator of RhoGEF and GTPase\tApproved\tD22S11\t",
+	"HGNC:11998\tTP53\ttumor protein p53\tApproved\tLFS1\t",
+	"HGNC:4610\tGTF2I\tgeneral transcription factor IIi\tApproved\tBAP135|SPIN\t",
+	"HGNC:11244\tSPIN1\tspindlin 1\tApproved\tSPIN\t",
+	"HGNC:99999\tOLD1\twithdrawn gene\tEntry Withdrawn\tHRX\t",
+}, "\n")
+
+func TestLoadHgnc(t *testing.T) {
+	var cases = map[string]struct {
+		content string
+		result  *hgncIndex
+		wantErr bool
+	}{
+		"Approved entries are indexed": {
+			strings.Join([]string{
+				"symbol\tstatus\talias_symbol\tprev_symbol",
+				"KMT2A\tApproved\t\"HRX|ALL-1\"\tMLL",
+				"OLD1\tEntry Withdrawn\tHRX\t",
+			}, "\n"),
+			&hgncIndex{
+				aliases:  map[string][]string{"HRX": {"KMT2A"}, "ALL-1": {"KMT2A"}},
+				approved: map[string]string{"KMT2A": "KMT2A"},
+				previous: map[string][]string{"MLL": {"KMT2A"}},
+			},
+			false,
+		},
+		"Columns are missing": {
+			"symbol\tstatus\n",
+			nil,
+			true,
+		},
+		"File is empty": {
+			"",
+			nil,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := writeAnnotation(t, "hgnc_complete_set.txt", c.content)
+			result, err := loadHgnc(path)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestNormalizeSymbol(t *testing.T) {
+	var cases = map[string]struct {
+		row     DbTableRow
+		result  string
+		wantErr bool
+	}{
+		"Approved symbol is kept": {
+			DbTableRow{Class: "gene", Id: "BCR"},
+			"BCR",
+			false,
+		},
+		"Previous symbol is replaced": {
+			DbTableRow{Class: "gene", Id: "MLL"},
+			"KMT2A",
+			false,
+		},
+		"Alias is replaced": {
+			DbTableRow{Class: "gene", Id: "lfs1"},
+			"TP53",
+			false,
+		},
+		"Alias of withdrawn entry is ignored": {
+			DbTableRow{Class: "gene", Id: "HRX"},
+			"KMT2A",
+			false,
+		},
+		"Unknown symbol is kept": {
+			DbTableRow{Class: "gene", Id: "GENE1"},
+			"GENE1",
+			false,
+		},
+		"Ambiguous alias": {
+			DbTableRow{Class: "gene", Id: "SPIN"},
+			"SPIN",
+			true,
+		},
+		"Removal is kept": {
+			DbTableRow{Action: "remove", Class: "gene", Id: "MLL"},
+			"MLL",
+			false,
+		},
+		"Region is kept": {
+			DbTableRow{Class: "region", Id: "MLL"},
+			"MLL",
+			false,
+		},
+	}
+	symbols, err := loadHgnc(writeAnnotation(t, "hgnc_complete_set.txt", hgncCompleteSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{}
+			session.Annotation.symbols = symbols
+			err := c.row.normalizeSymbol()
+			checkError(t, err, c.wantErr)
+			if c.row.Id != c.result {
+				t.Errorf("Expected %s, got %s", c.result, c.row.Id)
+			}
+		})
+	}
+}
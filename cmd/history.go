@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"log"
+
+	_ "github.com/lib/pq"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show change history",
+	Long:  `Show audit log of all changes to gene lists, optionally filtered by list, region id or date range`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		filter, err := getHistoryFlags(*cmd)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = session.initDbConnection(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = checkSchemaVersion(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		entries, err := session.Db.Connection.getHistory(ctx, filter)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = printTsv(historyToSlices(entries)); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+func getHistoryFlags(cmd cobra.Command) (filter HistoryFilter, err error) {
+	if filter.List, err = cmd.Flags().GetString("list"); err != nil {
+		return
+	}
+	if filter.RegionId, err = cmd.Flags().GetString("id"); err != nil {
+		return
+	}
+	var since, until string
+	if since, err = cmd.Flags().GetString("since"); err != nil {
+		return
+	}
+	if filter.Since, err = parseHistoryDate(since, false); err != nil {
+		return
+	}
+	if until, err = cmd.Flags().GetString("until"); err != nil {
+		return
+	}
+	filter.Until, err = parseHistoryDate(until, true)
+	return
+}
+
+func init() {
+	// Add history command
+	rootCmd.AddCommand(historyCmd)
+
+	// Add filter flags to history command
+	historyCmd.PersistentFlags().String("id", "", "only show changes of this gene or region id")
+	historyCmd.PersistentFlags().String("list", "", "only show changes of this list")
+	historyCmd.PersistentFlags().String("since", "", "only show changes from this date on (e.g. 2022-01-31)")
+	historyCmd.PersistentFlags().String("until", "", "only show changes up to and including this date or timestamp")
+}
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const maxRetryDelay = time.Minute
+
+var throttle = rateLimiter{hosts: make(map[string]*hostLimit)}
+
+type rateLimiter struct {
+	mutex sync.Mutex
+	hosts map[string]*hostLimit
+}
+
+type hostLimit struct {
+	blockedUntil time.Time
+	interval     time.Duration
+	next         time.Time
+}
+
+func sendHttpRequest(ctx context.Context, url string) (body []byte, err error) {
+	body, err = sendRequest(ctx, http.MethodGet, url, nil)
+	return
+}
+
+func sendJsonRequest(ctx context.Context, url string, payload interface{}) (body []byte, err error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not prepare request to %s", url))
+		return
+	}
+	body, err = sendRequest(ctx, http.MethodPost, url, data)
+	return
+}
+
+func sendRequest(ctx context.Context, method string, url string, payload []byte) (body []byte, err error) {
+	host := getHost(url)
+	for attempt := 0; ; attempt++ {
+		if err = throttle.wait(ctx, host); err != nil {
+			return
+		}
+		var response *http.Response
+		body, response, err = doRequest(ctx, method, url, payload)
+		if response != nil {
+			throttle.update(host, response)
+		}
+		retry, delay, reason := getRetry(ctx, response, err, attempt)
+		if !retry {
+			return
+		}
+		if attempt >= session.Web.Retries {
+			err = errors.New(fmt.Sprintf("Giving up on %s after %d attempts: %s", url, attempt+1, reason))
+			return
+		}
+		log.Printf("Request to %s failed (%s), retrying in %s", url, reason, delay.Round(time.Millisecond))
+		if err = sleep(ctx, delay); err != nil {
+			return
+		}
+	}
+}
+
+func doRequest(ctx context.Context, method string, url string, payload []byte) (body []byte, response *http.Response, err error) {
+	ctx, cancel := withTimeout(ctx, session.Web.Timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	if err != nil {
+		return
+	}
+	if payload != nil {
+		request.Header.Set("Accept", "application/json")
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not reach url %s", url))
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		err = errors.New(fmt.Sprintf("Request to %s returned %s", url, response.Status))
+		return
+	}
+	body, err = ioutil.ReadAll(response.Body)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not read response to request to %s", url))
+	}
+	return
+}
+
+func getRetry(ctx context.Context, response *http.Response, err error, attempt int) (retry bool, delay time.Duration, reason string) {
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+	if response == nil {
+		// Network errors and timeouts of a single request
+		retry = true
+		reason = err.Error()
+	} else {
+		switch response.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			retry = true
+			reason = response.Status
+		default:
+			return
+		}
+		if wait, valid := parseRetryAfter(response.Header.Get("Retry-After")); valid {
+			delay = wait
+			reason = fmt.Sprintf("%s, retry after %s", reason, wait)
+			return
+		}
+	}
+	delay = getBackoff(attempt)
+	return
+}
+
+func getBackoff(attempt int) (delay time.Duration) {
+	delay = session.Web.RetryDelay << uint(attempt)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	// Full jitter in the upper half avoids synchronized retries
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	return
+}
+
+func parseRetryAfter(value string) (delay time.Duration, valid bool) {
+	if value == "" {
+		return
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds * float64(time.Second))
+		valid = true
+		return
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay = time.Until(date); delay < 0 {
+			delay = 0
+		}
+		valid = true
+	}
+	return
+}
+
+func (r *rateLimiter) wait(ctx context.Context, host string) (err error) {
+	r.mutex.Lock()
+	limit := r.getHost(host)
+	now := time.Now()
+	start := limit.next
+	if limit.blockedUntil.After(start) {
+		start = limit.blockedUntil
+	}
+	if start.Before(now) {
+		start = now
+	}
+	limit.next = start.Add(limit.interval)
+	r.mutex.Unlock()
+	err = sleep(ctx, time.Until(start))
+	return
+}
+
+func (r *rateLimiter) update(host string, response *http.Response) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	limit := r.getHost(host)
+	header := response.Header
+	maxRequests, limitErr := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	period, periodErr := strconv.Atoi(header.Get("X-RateLimit-Period"))
+	if limitErr == nil && periodErr == nil && maxRequests > 0 && period > 0 {
+		limit.interval = time.Duration(period) * time.Second / time.Duration(maxRequests)
+	}
+	var blockedUntil time.Time
+	remaining, remainingErr := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	reset, resetErr := strconv.Atoi(header.Get("X-RateLimit-Reset"))
+	if remainingErr == nil && resetErr == nil && remaining <= 0 {
+		blockedUntil = time.Now().Add(time.Duration(reset) * time.Second)
+	}
+	if response.StatusCode == http.StatusTooManyRequests {
+		if wait, valid := parseRetryAfter(header.Get("Retry-After")); valid {
+			blockedUntil = time.Now().Add(wait)
+		}
+	}
+	if blockedUntil.After(limit.blockedUntil) {
+		limit.blockedUntil = blockedUntil
+		log.Printf("Rate limit of %s reached, pausing requests until %s", host, blockedUntil.Format(time.RFC3339))
+	}
+}
+
+func (r *rateLimiter) getHost(host string) (limit *hostLimit) {
+	limit, present := r.hosts[host]
+	if !present {
+		limit = &hostLimit{}
+		r.hosts[host] = limit
+	}
+	return
+}
+
+func getHost(url string) string {
+	if parsed, err := neturl.Parse(url); err == nil {
+		return parsed.Host
+	}
+	return url
+}
+
+func sleep(ctx context.Context, delay time.Duration) (err error) {
+	if delay <= 0 {
+		return
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+	}
+	return
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestSendHttpRequest(t *testing.T) {
+	var cases = map[string]struct {
+		url     string
+		result  []byte
+		wantErr bool
+	}{
+		"Successful request": {
+			"http://atlasgeneticsoncology.org/gene-fusions/?id=1",
+			[]byte("<ul>"),
+			false,
+		},
+		"Internal server error": {
+			"http://atlasgeneticsoncology.org/gene-fusions/?id=2",
+			nil,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+			httpmock.RegisterResponder("GET", "http://atlasgeneticsoncology.org/gene-fusions/?id=1",
+				httpmock.NewStringResponder(200, `<ul>`))
+			httpmock.RegisterResponder("GET", "http://atlasgeneticsoncology.org/gene-fusions/?id=2",
+				httpmock.NewStringResponder(500, ""))
+			result, err := sendHttpRequest(context.Background(), c.url)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSendRequestRetries(t *testing.T) {
+	var cases = map[string]struct {
+		statuses []int
+		retries  int
+		result   []byte
+		calls    int
+		reason   string
+	}{
+		"Rate limited once": {
+			[]int{429, 200},
+			3,
+			[]byte("{}"),
+			2,
+			"",
+		},
+		"Server unavailable until success": {
+			[]int{503, 502, 200},
+			3,
+			[]byte("{}"),
+			3,
+			"",
+		},
+		"Retries exhausted": {
+			[]int{503, 503, 503},
+			2,
+			nil,
+			3,
+			"Giving up on /info/ping after 3 attempts: 503",
+		},
+		"Client errors are not retried": {
+			[]int{400, 200},
+			3,
+			nil,
+			1,
+			"Request to /info/ping returned 400",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			defer func(original Session) { session = original }(session)
+			session = Session{
+				Web: web{
+					Retries:    c.retries,
+					RetryDelay: time.Millisecond,
+				},
+			}
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+			calls := 0
+			httpmock.RegisterResponder("GET", "/info/ping", func(request *http.Request) (*http.Response, error) {
+				status := c.statuses[calls]
+				calls++
+				response := httpmock.NewStringResponse(status, "{}")
+				response.Status = fmt.Sprintf("%d %s", status, http.StatusText(status))
+				if status == 429 {
+					response.Header.Set("Retry-After", "0")
+				}
+				return response, nil
+			})
+			result, err := sendHttpRequest(context.Background(), "/info/ping")
+			checkError(t, err, c.reason != "")
+			if err != nil && !strings.HasPrefix(err.Error(), c.reason) {
+				t.Errorf("Expected error starting with %q, got %q", c.reason, err.Error())
+			}
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+			if calls != c.calls {
+				t.Errorf("Expected %d calls, got %d", c.calls, calls)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	var cases = map[string]struct {
+		value  string
+		result time.Duration
+		valid  bool
+	}{
+		"Seconds": {
+			"2",
+			2 * time.Second,
+			true,
+		},
+		"Date in the past": {
+			"Wed, 21 Oct 2015 07:28:00 GMT",
+			0,
+			true,
+		},
+		"Header is missing": {
+			"",
+			0,
+			false,
+		},
+		"Header is malformed": {
+			"soon",
+			0,
+			false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result, valid := parseRetryAfter(c.value)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+			if valid != c.valid {
+				t.Errorf("Expected valid to be %v, got %v", c.valid, valid)
+			}
+		})
+	}
+}
+
+func TestRateLimiterUpdate(t *testing.T) {
+	var cases = map[string]struct {
+		headers  map[string]string
+		interval time.Duration
+		blocked  bool
+	}{
+		"Advertised limit sets interval": {
+			map[string]string{
+				"X-RateLimit-Limit":     "55000",
+				"X-RateLimit-Period":    "3600",
+				"X-RateLimit-Remaining": "54999",
+				"X-RateLimit-Reset":     "3599",
+			},
+			3600 * time.Second / 55000,
+			false,
+		},
+		"Exhausted limit blocks host": {
+			map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     "60",
+			},
+			0,
+			true,
+		},
+		"No rate limit headers": {
+			map[string]string{},
+			0,
+			false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			limiter := rateLimiter{hosts: make(map[string]*hostLimit)}
+			response := &http.Response{StatusCode: 200, Header: make(http.Header)}
+			for key, value := range c.headers {
+				response.Header.Set(key, value)
+			}
+			limiter.update("rest.ensembl.org", response)
+			limit := limiter.hosts["rest.ensembl.org"]
+			if diff := deep.Equal(limit.interval, c.interval); diff != nil {
+				t.Error(diff)
+			}
+			if blocked := limit.blockedUntil.After(time.Now()); blocked != c.blocked {
+				t.Errorf("Expected blocked to be %v, got %v", c.blocked, blocked)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const maxIdentifierLength = 63
+
+var identifierRegex = regexp.MustCompile("^[a-z][a-z0-9_]*$")
+
+func validateIdentifier(name string) (err error) {
+	if len(name) > maxIdentifierLength {
+		err = errors.New(fmt.Sprintf("%s is not a valid name as it is longer than %d characters", name, maxIdentifierLength))
+		return
+	}
+	if !identifierRegex.MatchString(name) {
+		err = errors.New(fmt.Sprintf("%s is not a valid name; only lower case letters, digits and underscores are allowed and it has to start with a letter", name))
+		return
+	}
+	if strings.HasPrefix(name, "pg_") {
+		err = errors.New(fmt.Sprintf("%s is not a valid name as the prefix pg_ is reserved", name))
+	}
+	return
+}
+
+func quoteIdentifier(name string) (quoted string, err error) {
+	if err = validateIdentifier(name); err != nil {
+		return
+	}
+	quoted = fmt.Sprintf(`"%s"`, name)
+	return
+}
+
+func quoteIdentifiers(names []string) (quoted []string, err error) {
+	for _, name := range names {
+		var q string
+		if q, err = quoteIdentifier(name); err != nil {
+			return
+		}
+		quoted = append(quoted, q)
+	}
+	return
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestValidateIdentifier(t *testing.T) {
+	var cases = map[string]struct {
+		name    string
+		wantErr bool
+	}{
+		"Name is valid": {
+			"aml_ext",
+			false,
+		},
+		"Name contains upper case letters": {
+			"AML",
+			true,
+		},
+		"Name contains quotes": {
+			`aml"; DROP TABLE "all`,
+			true,
+		},
+		"Name starts with digit": {
+			"1aml",
+			true,
+		},
+		"Name is empty": {
+			"",
+			true,
+		},
+		"Name is too long": {
+			"a123456789012345678901234567890123456789012345678901234567890123",
+			true,
+		},
+		"Name uses reserved prefix": {
+			"pg_aml",
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := validateIdentifier(c.name)
+			checkError(t, err, c.wantErr)
+		})
+	}
+}
+
+func TestQuoteIdentifiers(t *testing.T) {
+	var cases = map[string]struct {
+		names   []string
+		result  []string
+		wantErr bool
+	}{
+		"Quote valid names": {
+			[]string{"aml", "snv"},
+			[]string{`"aml"`, `"snv"`},
+			false,
+		},
+		"Reject invalid name": {
+			[]string{"aml", "snv = true"},
+			nil,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result, err := quoteIdentifiers(c.names)
+			checkError(t, err, c.wantErr)
+			if c.wantErr {
+				return
+			}
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Share of bases that has to map for a region to be lifted, as in UCSC liftOver
+const liftoverMinMatch = 0.95
+
+var liftoverMutex sync.Mutex
+
+type chainBlock struct {
+	chain   int
+	qName   string
+	qSize   int
+	qStart  int
+	qStrand string
+	tEnd    int
+	tStart  int
+}
+
+type chainIndex struct {
+	blocks    map[string][]chainBlock
+	maxLength map[string]int
+}
+
+type liftedPiece struct {
+	chromosome string
+	end        int
+	mapped     int
+	start      int
+}
+
+func getChain(from string, to string) (index *chainIndex, err error) {
+	liftoverMutex.Lock()
+	defer liftoverMutex.Unlock()
+	key := fmt.Sprintf("%s>%s", from, to)
+	if index, present := session.Liftover.chains[key]; present {
+		return index, nil
+	}
+	path := session.Liftover.getPath(from, to)
+	if path == "" {
+		err = errors.New(fmt.Sprintf("No chain file configured to lift GRCh%s to GRCh%s (CHAIN_%s_TO_%s_PATH)", from, to, from, to))
+		return
+	}
+	log.Printf("Loading chain file %s", path)
+	if index, err = loadChain(path); err != nil {
+		return
+	}
+	if session.Liftover.chains == nil {
+		session.Liftover.chains = make(map[string]*chainIndex)
+	}
+	session.Liftover.chains[key] = index
+	return
+}
+
+// loadChain reads a UCSC chain file, optionally gzipped, into blocks per source chromosome
+func loadChain(path string) (index *chainIndex, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not open chain file %s", path))
+		return
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(file); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not decompress chain file %s", path))
+			return
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	parsed := &chainIndex{
+		blocks:    make(map[string][]chainBlock),
+		maxLength: make(map[string]int),
+	}
+	var header *chainBlock
+	var tName string
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "chain" {
+			if header, tName, err = parseChainHeader(fields); err != nil {
+				err = errors.Wrap(err, fmt.Sprintf("Could not parse line %d of %s", line, path))
+				return
+			}
+			continue
+		}
+		if header == nil || (len(fields) != 1 && len(fields) != 3) {
+			err = errors.New(fmt.Sprintf("Unexpected line %d of %s", line, path))
+			return
+		}
+		var values []int
+		for _, field := range fields {
+			var value int
+			if value, err = strconv.Atoi(field); err != nil {
+				err = errors.Wrap(err, fmt.Sprintf("Could not parse line %d of %s", line, path))
+				return
+			}
+			values = append(values, value)
+		}
+		block := *header
+		block.tEnd = block.tStart + values[0]
+		parsed.blocks[tName] = append(parsed.blocks[tName], block)
+		if values[0] > parsed.maxLength[tName] {
+			parsed.maxLength[tName] = values[0]
+		}
+		if len(values) == 1 {
+			// Last block of the chain
+			header = nil
+			continue
+		}
+		header.tStart = block.tEnd + values[1]
+		header.qStart = block.qStart + values[0] + values[2]
+	}
+	if err = scanner.Err(); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not read chain file %s", path))
+		return
+	}
+	for _, blocks := range parsed.blocks {
+		sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].tStart < blocks[j].tStart })
+	}
+	index = parsed
+	return
+}
+
+// parseChainHeader reads "chain score tName tSize tStrand tStart tEnd qName qSize qStrand qStart qEnd id"
+func parseChainHeader(fields []string) (block *chainBlock, tName string, err error) {
+	if len(fields) < 13 {
+		err = errors.New(fmt.Sprintf("Chain header has %d instead of 13 fields", len(fields)))
+		return
+	}
+	var values [4]int
+	for i, field := range []string{fields[5], fields[8], fields[10], fields[12]} {
+		if values[i], err = strconv.Atoi(field); err != nil {
+			return
+		}
+	}
+	tName = strings.TrimPrefix(fields[2], "chr")
+	block = &chainBlock{
+		chain:   values[3],
+		qName:   strings.TrimPrefix(fields[7], "chr"),
+		qSize:   values[1],
+		qStart:  values[2],
+		qStrand: fields[9],
+		tStart:  values[0],
+	}
+	return
+}
+
+// lift converts a 1-based, closed interval and fails for regions that split
+// across chains or whose bases are largely missing in the other build
+func (c *chainIndex) lift(chromosome string, start int, end int) (lifted EnsemblBaseObj, err error) {
+	name := fmt.Sprintf("%s:%d-%d", chromosome, start, end)
+	pieces := make(map[int]*liftedPiece)
+	var chains []int
+	from, to := start-1, end
+	blocks := c.blocks[chromosome]
+	last := sort.Search(len(blocks), func(i int) bool { return blocks[i].tStart >= to })
+	for i := last - 1; i >= 0 && blocks[i].tStart+c.maxLength[chromosome] > from; i-- {
+		block := blocks[i]
+		overlapStart, overlapEnd := block.tStart, block.tEnd
+		if from > overlapStart {
+			overlapStart = from
+		}
+		if to < overlapEnd {
+			overlapEnd = to
+		}
+		if overlapStart >= overlapEnd {
+			continue
+		}
+		qStart := block.qStart + overlapStart - block.tStart
+		qEnd := qStart + overlapEnd - overlapStart
+		if block.qStrand == "-" {
+			qStart, qEnd = block.qSize-qEnd, block.qSize-qStart
+		}
+		piece, present := pieces[block.chain]
+		if !present {
+			piece = &liftedPiece{chromosome: block.qName, end: qEnd, start: qStart}
+			pieces[block.chain] = piece
+			chains = append(chains, block.chain)
+		}
+		if qStart < piece.start {
+			piece.start = qStart
+		}
+		if qEnd > piece.end {
+			piece.end = qEnd
+		}
+		piece.mapped += overlapEnd - overlapStart
+	}
+	if len(chains) == 0 {
+		err = errors.New(fmt.Sprintf("%s does not map", name))
+		return
+	}
+	if len(chains) > 1 {
+		sort.Ints(chains)
+		var parts []string
+		for _, chain := range chains {
+			piece := pieces[chain]
+			parts = append(parts, fmt.Sprintf("%s:%d-%d", piece.chromosome, piece.start+1, piece.end))
+		}
+		err = errors.New(fmt.Sprintf("%s is split into %s", name, strings.Join(parts, ", ")))
+		return
+	}
+	piece := pieces[chains[0]]
+	if float64(piece.mapped) < liftoverMinMatch*float64(to-from) {
+		err = errors.New(fmt.Sprintf("%s maps partially, only %d of %d bases are found", name, piece.mapped, to-from))
+		return
+	}
+	lifted = EnsemblBaseObj{
+		Chromosome: piece.chromosome,
+		End:        piece.end,
+		Start:      piece.start + 1,
+	}
+	return
+}
+
+// liftRegion returns the coordinates of a region row in the requested build.
+// Regions of unknown build are returned unchanged.
+func (d DbTableRow) liftRegion(build string) (region EnsemblBaseObj, err error) {
+	start, err := strconv.Atoi(d.Start)
+	if err != nil {
+		return
+	}
+	end, err := strconv.Atoi(d.End)
+	if err != nil {
+		return
+	}
+	if d.Build == "" || d.Build == build {
+		if d.Build == "" {
+			log.Printf("Build of region %s is unknown, using its coordinates for GRCh%s unchanged", d.Id, build)
+		}
+		region = EnsemblBaseObj{Chromosome: d.Chromosome, End: end, Start: start}
+		return
+	}
+	chain, err := getChain(d.Build, build)
+	if err != nil {
+		return
+	}
+	if region, err = chain.lift(d.Chromosome, start, end); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not lift %s from GRCh%s to GRCh%s", d.Id, d.Build, build))
+	}
+	return
+}
+
+// liftCoordinates stores the coordinates of a region row for every build it
+// can be lifted to. Failures are reported and left to extract.
+func (d *DbTableRow) liftCoordinates() (err error) {
+	if d.Build == "" {
+		return
+	}
+	d.Coordinates = make(map[string]EnsemblBaseObj)
+	for _, build := range builds {
+		if build != d.Build {
+			if session.Liftover.getPath(d.Build, build) == "" {
+				continue
+			}
+			if _, err = getChain(d.Build, build); err != nil {
+				return
+			}
+		}
+		region, liftErr := d.liftRegion(build)
+		if liftErr != nil {
+			log.Printf("Warning: %v", liftErr)
+			continue
+		}
+		d.Coordinates[build] = region
+	}
+	return
+}
+
+func (l liftover) getPath(from string, to string) string {
+	if from == "37" && to == "38" {
+		return l.Chain37To38
+	}
+	if from == "38" && to == "37" {
+		return l.Chain38To37
+	}
+	return ""
+}
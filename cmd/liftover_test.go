@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+var testChain = strings.Join([]string{
+	"chain 1000 chr1 10000 + 100 450 chr1 10000 + 1100 1450 1",
+	"100 50 50",
+	"200",
+	"",
+	"chain 900 chr1 10000 + 1000 1100 chr2 5000 - 0 100 2",
+	"100",
+	"",
+	"chain 800 chr1 10000 + 450 550 chr3 5000 + 0 100 3",
+	"100",
+	"",
+}, "\n")
+
+func TestLoadChain(t *testing.T) {
+	var cases = map[string]struct {
+		content string
+		blocks  int
+		wantErr bool
+	}{
+		"Chain file is valid": {
+			testChain,
+			4,
+			false,
+		},
+		"Block without chain": {
+			"100 50 50\n",
+			0,
+			true,
+		},
+		"Header is incomplete": {
+			"chain 1000 chr1 10000 +\n",
+			0,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			index, err := loadChain(writeAnnotation(t, "hg19ToHg38.over.chain.gz", c.content))
+			checkError(t, err, c.wantErr)
+			if err == nil && len(index.blocks["1"]) != c.blocks {
+				t.Errorf("Expected %d blocks, got %d", c.blocks, len(index.blocks["1"]))
+			}
+		})
+	}
+}
+
+func TestChainLift(t *testing.T) {
+	var cases = map[string]struct {
+		chromosome string
+		start      int
+		end        int
+		result     EnsemblBaseObj
+		wantErr    bool
+	}{
+		"Region within block": {
+			"1",
+			121,
+			180,
+			EnsemblBaseObj{Chromosome: "1", Start: 1121, End: 1180},
+			false,
+		},
+		"Region on reverse strand": {
+			"1",
+			1011,
+			1050,
+			EnsemblBaseObj{Chromosome: "2", Start: 4951, End: 4990},
+			false,
+		},
+		"Region spans a large gap": {
+			"1",
+			181,
+			300,
+			EnsemblBaseObj{},
+			true,
+		},
+		"Region is split": {
+			"1",
+			401,
+			500,
+			EnsemblBaseObj{},
+			true,
+		},
+		"Region does not map": {
+			"X",
+			1,
+			10,
+			EnsemblBaseObj{},
+			true,
+		},
+	}
+	index, err := loadChain(writeAnnotation(t, "hg19ToHg38.over.chain", testChain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result, err := index.lift(c.chromosome, c.start, c.end)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestLiftRegion(t *testing.T) {
+	var cases = map[string]struct {
+		row     DbTableRow
+		build   string
+		chain   bool
+		result  EnsemblBaseObj
+		wantErr bool
+	}{
+		"Region of requested build": {
+			DbTableRow{Build: "37", Chromosome: "1", End: "180", Id: "REGION1", Start: "121"},
+			"37",
+			false,
+			EnsemblBaseObj{Chromosome: "1", Start: 121, End: 180},
+			false,
+		},
+		"Region of unknown build": {
+			DbTableRow{Chromosome: "1", End: "180", Id: "REGION1", Start: "121"},
+			"38",
+			false,
+			EnsemblBaseObj{Chromosome: "1", Start: 121, End: 180},
+			false,
+		},
+		"Region is lifted": {
+			DbTableRow{Build: "37", Chromosome: "1", End: "180", Id: "REGION1", Start: "121"},
+			"38",
+			true,
+			EnsemblBaseObj{Chromosome: "1", Start: 1121, End: 1180},
+			false,
+		},
+		"No chain file": {
+			DbTableRow{Build: "37", Chromosome: "1", End: "180", Id: "REGION1", Start: "121"},
+			"38",
+			false,
+			EnsemblBaseObj{},
+			true,
+		},
+	}
+	path := writeAnnotation(t, "hg19ToHg38.over.chain", testChain)
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{}
+			if c.chain {
+				session.Liftover.Chain37To38 = path
+			}
+			result, err := c.row.liftRegion(c.build)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestLiftCoordinates(t *testing.T) {
+	var cases = map[string]struct {
+		row    DbTableRow
+		result map[string]EnsemblBaseObj
+	}{
+		"Coordinates of both builds": {
+			DbTableRow{Build: "37", Chromosome: "1", End: "180", Id: "REGION1", Start: "121"},
+			map[string]EnsemblBaseObj{
+				"37": {Chromosome: "1", Start: 121, End: 180},
+				"38": {Chromosome: "1", Start: 1121, End: 1180},
+			},
+		},
+		"Failed liftover is skipped": {
+			DbTableRow{Build: "37", Chromosome: "1", End: "500", Id: "REGION1", Start: "401"},
+			map[string]EnsemblBaseObj{
+				"37": {Chromosome: "1", Start: 401, End: 500},
+			},
+		},
+		"Region of unknown build": {
+			DbTableRow{Chromosome: "1", End: "180", Id: "REGION1", Start: "121"},
+			nil,
+		},
+	}
+	path := writeAnnotation(t, "hg19ToHg38.over.chain", testChain)
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{}
+			session.Liftover.Chain37To38 = path
+			err := c.row.liftCoordinates()
+			checkError(t, err, false)
+			if diff := deep.Equal(c.row.Coordinates, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
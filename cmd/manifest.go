@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Manifest struct {
+	Analysis        string         `json:"analysis"`
+	Annotation      string         `json:"annotation_source"`
+	Build           string         `json:"build"`
+	Checksum        string         `json:"checksum"`
+	CreatedAt       time.Time      `json:"created_at"`
+	CreatedBy       string         `json:"created_by"`
+	Database        DatabaseState  `json:"database"`
+	EnsemblReleases []string       `json:"ensembl_releases,omitempty"`
+	ExonMode        string         `json:"exon_mode"`
+	File            string         `json:"file"`
+	Format          string         `json:"format"`
+	Intervals       int            `json:"intervals"`
+	Padding         map[string]int `json:"padding"`
+	Releases        []string       `json:"releases,omitempty"`
+	Tables          []string       `json:"tables,omitempty"`
+	Transcripts     string         `json:"transcripts"`
+	Version         string         `json:"tool_version"`
+}
+
+type DatabaseState struct {
+	Driver        string    `json:"driver"`
+	LastChange    time.Time `json:"last_change"`
+	LastChangeId  int64     `json:"last_change_id"`
+	Name          string    `json:"name"`
+	SchemaVersion int       `json:"schema_version"`
+}
+
+func newManifest(ctx context.Context, releases []string) (manifest Manifest, err error) {
+	manifest = Manifest{
+		Analysis:        session.Analysis,
+		Annotation:      session.Annotation.Source,
+		Build:           session.Build,
+		CreatedAt:       time.Now().UTC().Truncate(time.Second),
+		CreatedBy:       getCurrentUser(),
+		EnsemblReleases: releases,
+		ExonMode:        orDefault(session.ExonMode, "full"),
+		File:            filepath.Base(session.Bed),
+		Format:          orDefault(session.Format, "bed"),
+		Padding:         session.Padding,
+		Tables:          session.Tables,
+		Transcripts:     orDefault(session.Transcripts, "all"),
+		Version:         version,
+	}
+	for _, release := range session.Releases {
+		manifest.Releases = append(manifest.Releases, release.String())
+	}
+	if manifest.Database, err = session.Db.Connection.getDatabaseState(ctx); err != nil {
+		err = errors.Wrap(err, "Could not determine database state")
+	}
+	return
+}
+
+// headerLines describes the provenance of a file in its comments
+func (m Manifest) headerLines() (lines []string) {
+	if len(m.Releases) > 0 {
+		lines = append(lines, fmt.Sprintf("releases: %s", strings.Join(m.Releases, ",")))
+	} else {
+		lines = append(lines, fmt.Sprintf("tables: %s", strings.Join(m.Tables, ",")))
+	}
+	lines = append(lines,
+		fmt.Sprintf("analysis: %s", m.Analysis),
+		fmt.Sprintf("format: %s", m.Format),
+		fmt.Sprintf("exon_mode: %s", m.ExonMode),
+		fmt.Sprintf("transcripts: %s", m.Transcripts),
+		fmt.Sprintf("annotation_source: %s", m.Annotation),
+		fmt.Sprintf("database: %s", m.Database),
+		fmt.Sprintf("tool_version: %s", m.Version),
+		fmt.Sprintf("created_at: %s", m.CreatedAt.Format(time.RFC3339)),
+		fmt.Sprintf("checksum: %s", m.Checksum),
+	)
+	return
+}
+
+func (s DatabaseState) String() string {
+	return fmt.Sprintf("%s %s schema %d change %d (%s)", s.Driver, s.Name, s.SchemaVersion, s.LastChangeId, s.LastChange.UTC().Format(time.RFC3339))
+}
+
+func getManifestPath(path string) string {
+	return fmt.Sprintf("%s.manifest.json", path)
+}
+
+func writeManifest(path string, manifest Manifest) (err error) {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		err = errors.Wrap(err, "Could not serialize manifest")
+		return
+	}
+	if err = os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not write manifest %s", path))
+	}
+	return
+}
+
+func readManifest(path string) (manifest Manifest, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not read manifest %s", path))
+		return
+	}
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not parse manifest %s", path))
+	}
+	return
+}
+
+// getIntervalChecksum hashes the header and interval lines exactly as they are
+// written, leaving out the checksum line so that the checksum can be part of
+// the header
+func getIntervalChecksum(header []string, data [][]string) (checksum string, err error) {
+	hash := sha256.New()
+	for _, line := range header {
+		if !isChecksumLine(line) {
+			hash.Write([]byte(line + "\n"))
+		}
+	}
+	tsv := csv.NewWriter(hash)
+	tsv.Comma = '\t'
+	if err = tsv.WriteAll(data); err != nil {
+		return
+	}
+	checksum = fmt.Sprintf("sha256:%s", hex.EncodeToString(hash.Sum(nil)))
+	return
+}
+
+// setChecksumLine fills in the checksum line of a formatted header
+func setChecksumLine(header []string, checksum string) {
+	for i, line := range header {
+		if isChecksumLine(line) {
+			header[i] = line + checksum
+		}
+	}
+}
+
+func isChecksumLine(line string) bool {
+	return strings.HasPrefix(getCommentText(line), "checksum: ")
+}
+
+func getCommentText(line string) string {
+	if !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "@CO\t") {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(line, "@CO\t"), "#"), " ")
+}
+
+// readIntervalChecksum hashes every line but the checksum line of a plain or
+// gzipped file, counts its intervals and returns the checksum recorded in its header, if any
+func readIntervalChecksum(path string) (checksum string, intervals int, recorded string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	buffered := bufio.NewReader(file)
+	var reader io.Reader = buffered
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(buffered); err != nil {
+			return
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	hash := sha256.New()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if isChecksumLine(line) {
+			recorded = strings.TrimPrefix(getCommentText(line), "checksum: ")
+			continue
+		}
+		hash.Write([]byte(line + "\n"))
+		if !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "@") {
+			intervals++
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	checksum = fmt.Sprintf("sha256:%s", hex.EncodeToString(hash.Sum(nil)))
+	return
+}
+
+// verifyIntervals checks that the intervals of a file are unchanged since its
+// manifest was written
+func verifyIntervals(path string, manifestPath string) (manifest Manifest, err error) {
+	if manifest, err = readManifest(manifestPath); err != nil {
+		return
+	}
+	checksum, intervals, recorded, err := readIntervalChecksum(path)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not read %s", path))
+		return
+	}
+	if recorded != "" && recorded != manifest.Checksum {
+		err = errors.New(fmt.Sprintf("Header of %s records checksum %s but manifest %s records %s", path, recorded, manifestPath, manifest.Checksum))
+		return
+	}
+	if checksum != manifest.Checksum || intervals != manifest.Intervals {
+		err = errors.New(fmt.Sprintf("%s does not match manifest %s: found %d intervals with checksum %s, expected %d intervals with checksum %s", path, manifestPath, intervals, checksum, manifest.Intervals, manifest.Checksum))
+	}
+	return
+}
+
+func orDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func (d dbConnection) getDatabaseState(ctx context.Context) (state DatabaseState, err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	state.Driver = session.Db.Driver
+	state.Name = session.Db.Name
+	if state.Driver == "sqlite" {
+		state.Name = session.Db.Path
+	}
+	if err = d.conn().QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`).Scan(&state.SchemaVersion); err != nil {
+		return
+	}
+	err = d.conn().QueryRowContext(ctx, `SELECT id, changed_at FROM audit_log ORDER BY id DESC LIMIT 1;`).Scan(&state.LastChangeId, &state.LastChange)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
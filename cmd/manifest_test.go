@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyIntervals(t *testing.T) {
+	var cases = map[string]struct {
+		name     string
+		compress bool
+		header   bool
+		tamper   func(path string) error
+		wantErr  bool
+	}{
+		"Plain file matches": {
+			"test.bed",
+			false,
+			false,
+			nil,
+			false,
+		},
+		"Compressed file with provenance header matches": {
+			"test.bed.gz",
+			true,
+			true,
+			nil,
+			false,
+		},
+		"Interval was changed": {
+			"test.bed",
+			false,
+			true,
+			func(path string) error {
+				return os.WriteFile(path, []byte("# checksum: sha256:abc\nchr1\t99\t300\tGENE1\n"), 0644)
+			},
+			true,
+		},
+		"Header checksum differs": {
+			"test.bed",
+			false,
+			true,
+			func(path string) error {
+				return writeIntervals(path, []string{"# checksum: sha256:abc"}, [][]string{{"chr1", "99", "200", "GENE1"}, {"chr2", "0", "20", "REGION1"}}, false, false)
+			},
+			true,
+		},
+		"Header line was changed": {
+			"test.bed",
+			false,
+			true,
+			func(path string) error {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				return os.WriteFile(path, bytes.Replace(data, []byte("# build: GRCh38"), []byte("# build: GRCh37"), 1), 0644)
+			},
+			true,
+		},
+		"Manifest is missing": {
+			"test.bed",
+			false,
+			false,
+			func(path string) error {
+				return os.Remove(getManifestPath(path))
+			},
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			data := [][]string{{"chr1", "99", "200", "GENE1"}, {"chr2", "0", "20", "REGION1"}}
+			path := filepath.Join(t.TempDir(), c.name)
+			manifest := Manifest{Analysis: "snv", Build: "38", Intervals: len(data)}
+			var err error
+			header := []string{"# build: GRCh38"}
+			if c.header {
+				header = append(header, commentLines(manifest.headerLines())...)
+			}
+			if manifest.Checksum, err = getIntervalChecksum(header, data); err != nil {
+				t.Fatal(err)
+			}
+			setChecksumLine(header, manifest.Checksum)
+			if err = writeIntervals(path, header, data, c.compress, false); err != nil {
+				t.Fatal(err)
+			}
+			if err = writeManifest(getManifestPath(path), manifest); err != nil {
+				t.Fatal(err)
+			}
+			if c.tamper != nil {
+				if err = c.tamper(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err = verifyIntervals(path, getManifestPath(path))
+			checkError(t, err, c.wantErr)
+		})
+	}
+}
+
+func TestSqliteGetDatabaseState(t *testing.T) {
+	getSqliteDb(t, true)
+	ctx := context.Background()
+	state, err := session.Db.Connection.getDatabaseState(ctx)
+	checkError(t, err, false)
+	if state.SchemaVersion != len(sqliteMigrations) || state.LastChangeId != 0 {
+		t.Errorf("Unexpected state of empty database %v", state)
+	}
+	if err = ensureListExists(ctx, "aml"); err != nil {
+		t.Fatal(err)
+	}
+	state, err = session.Db.Connection.getDatabaseState(ctx)
+	checkError(t, err, false)
+	if state.LastChangeId != 1 || state.LastChange.IsZero() || state.Driver != "sqlite" {
+		t.Errorf("Unexpected state after change %v", state)
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"log"
+
+	_ "github.com/lib/pq"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage database schema",
+	Long:  `Apply versioned schema migrations to database or show their status`,
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply pending migrations",
+	Long:  `Apply all pending schema migrations in order, each inside its own transaction`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = session.initDbConnection(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = migrateUp(ctx, dryRun); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show migration status",
+	Long:  `Show all known schema migrations and when they were applied to database`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		if err := session.initDbConnection(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		lines, err := migrationStatus(ctx)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = printTsv(lines); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+var migrateBackfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Store missing coordinates and exons",
+	Long:  `Resolve coordinates and exons of regions stored without them, e.g. by the store_coordinates migration, in the annotation source and store them so that extract works offline`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		if err := session.initDbConnection(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := checkSchemaVersion(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := backfillRegions(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+func init() {
+	// Add migrate command and its sub commands
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateStatusCmd)
+	migrateCmd.AddCommand(migrateBackfillCmd)
+
+	// Add dry-run and timeout flags to up command
+	migrateUpCmd.PersistentFlags().Bool("dry-run", false, "print pending migration statements without applying them")
+	migrateUpCmd.PersistentFlags().DurationVar(&session.Db.MigrationTimeout, "migration-timeout", session.Db.MigrationTimeout, "timeout of each migration, 0 disables it")
+}
@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Statements and Check receive the legacy list tables present in the database
+type migration struct {
+	Version    int
+	Name       string
+	Statements func(tables map[string]struct{}) (statements []string, err error)
+	Check      func(ctx context.Context, tables map[string]struct{}) (err error)
+}
+
+var postgresMigrations = []migration{
+	{
+		Version:    1,
+		Name:       "widen_list_columns",
+		Statements: widenListColumns,
+	},
+	{
+		Version:    2,
+		Name:       "normalize_lists",
+		Statements: normalizeLists,
+		Check:      checkLegacyRegions,
+	},
+	{
+		Version:    3,
+		Name:       "store_coordinates",
+		Statements: storeCoordinates,
+	},
+	{
+		Version:    4,
+		Name:       "add_audit_log",
+		Statements: addAuditLog,
+	},
+	{
+		Version:    5,
+		Name:       "add_releases",
+		Statements: addReleases,
+	},
+	{
+		Version:    6,
+		Name:       "soft_delete_list_regions",
+		Statements: softDeleteListRegions,
+	},
+	{
+		Version:    7,
+		Name:       "add_transcript_tags",
+		Statements: addTranscriptTags,
+	},
+	{
+		Version:    8,
+		Name:       "record_ensembl_release",
+		Statements: recordEnsemblRelease,
+	},
+	{
+		Version:    9,
+		Name:       "add_region_build",
+		Statements: addRegionBuild,
+	},
+	{
+		Version:    10,
+		Name:       "add_coding_regions",
+		Statements: addCodingRegions,
+	},
+	{
+		Version:    11,
+		Name:       "add_padding_rules",
+		Statements: addPaddingRules,
+	},
+	{
+		Version:    12,
+		Name:       "add_strand",
+		Statements: addStrand,
+	},
+	{
+		Version:    13,
+		Name:       "add_release_padding",
+		Statements: addReleasePadding,
+	},
+}
+
+func widenListColumns(tables map[string]struct{}) (statements []string, err error) {
+	for _, table := range getSortedTables(tables) {
+		var quotedTable string
+		if quotedTable, err = quoteIdentifier(table); err != nil {
+			return
+		}
+		statements = append(statements, fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN id TYPE varchar(64), ALTER COLUMN ensembl_id_38 TYPE varchar(32), ALTER COLUMN ensembl_id_37 TYPE varchar(32), ALTER COLUMN chromosome TYPE varchar(8);`, quotedTable))
+	}
+	return
+}
+
+func normalizeLists(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`CREATE TABLE IF NOT EXISTS regions (id varchar(64) NOT NULL, ensembl_id_38 varchar(32) NOT NULL, ensembl_id_37 varchar(32) NOT NULL, class varchar(10) NOT NULL, chromosome varchar(8) NOT NULL, start varchar(10) NOT NULL, "end" varchar(10) NOT NULL, PRIMARY KEY (id));`,
+		`CREATE TABLE IF NOT EXISTS lists (name varchar(63) NOT NULL, created_at timestamptz NOT NULL DEFAULT now(), PRIMARY KEY (name));`,
+		`CREATE TABLE IF NOT EXISTS list_regions (list varchar(63) NOT NULL REFERENCES lists (name), region_id varchar(64) NOT NULL REFERENCES regions (id), analysis varchar(10) NOT NULL, PRIMARY KEY (list, region_id, analysis));`,
+	}
+	for _, table := range getSortedTables(tables) {
+		var quotedTable string
+		if quotedTable, err = quoteIdentifier(table); err != nil {
+			return
+		}
+		// Table names are validated identifiers and can therefore be used as literals
+		statements = append(statements,
+			fmt.Sprintf(`INSERT INTO lists (name) VALUES ('%s') ON CONFLICT (name) DO NOTHING;`, table),
+			fmt.Sprintf(`INSERT INTO regions (id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end") SELECT id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end" FROM %s ON CONFLICT (id) DO NOTHING;`, quotedTable),
+		)
+		for _, analysis := range getAnalyses(analyses) {
+			statements = append(statements, fmt.Sprintf(`INSERT INTO list_regions (list, region_id, analysis) SELECT '%s', id, '%s' FROM %s WHERE "%s" = true ON CONFLICT DO NOTHING;`, table, analysis, quotedTable, analysis))
+		}
+		statements = append(statements, fmt.Sprintf(`DROP TABLE %s;`, quotedTable))
+	}
+	return
+}
+
+// checkLegacyRegions fails before any table is dropped if a region id is
+// stored with differing data, as only one copy could be kept
+func checkLegacyRegions(ctx context.Context, tables map[string]struct{}) (err error) {
+	ids, err := session.Db.Connection.getConflictingRegions(ctx, getSortedTables(tables))
+	if err != nil {
+		err = errors.Wrap(err, "Could not compare regions of list tables")
+		return
+	}
+	if len(ids) > 0 {
+		err = errors.New(fmt.Sprintf("Regions %s differ between list tables %s. Make their rows identical before migrating", strings.Join(ids, ", "), strings.Join(getSortedTables(tables), ", ")))
+	}
+	return
+}
+
+func storeCoordinates(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`CREATE TABLE IF NOT EXISTS region_coordinates (region_id varchar(64) NOT NULL REFERENCES regions (id), build varchar(2) NOT NULL, chromosome varchar(8) NOT NULL, start integer NOT NULL, "end" integer NOT NULL, PRIMARY KEY (region_id, build));`,
+		`CREATE TABLE IF NOT EXISTS region_exons (region_id varchar(64) NOT NULL REFERENCES regions (id), build varchar(2) NOT NULL, transcript_id varchar(32) NOT NULL, exon_id varchar(32) NOT NULL, chromosome varchar(8) NOT NULL, start integer NOT NULL, "end" integer NOT NULL, PRIMARY KEY (region_id, build, transcript_id, exon_id));`,
+	}
+	return
+}
+
+func addAuditLog(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`CREATE TABLE IF NOT EXISTS audit_log (id serial NOT NULL, changed_at timestamptz NOT NULL, changed_by varchar(64) NOT NULL, source_file text NOT NULL, source_checksum varchar(64) NOT NULL, action varchar(20) NOT NULL, list varchar(63) NOT NULL, region_id varchar(64) NOT NULL, old_value text NOT NULL, new_value text NOT NULL, PRIMARY KEY (id));`,
+		`CREATE INDEX IF NOT EXISTS audit_log_list_region ON audit_log (list, region_id);`,
+	}
+	return
+}
+
+func addReleases(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`CREATE TABLE IF NOT EXISTS releases (list varchar(63) NOT NULL REFERENCES lists (name), version varchar(32) NOT NULL, notes text NOT NULL, created_at timestamptz NOT NULL, created_by varchar(64) NOT NULL, PRIMARY KEY (list, version));`,
+		`CREATE TABLE IF NOT EXISTS release_regions (list varchar(63) NOT NULL, version varchar(32) NOT NULL, region_id varchar(64) NOT NULL, analysis varchar(10) NOT NULL, data text NOT NULL, PRIMARY KEY (list, version, region_id, analysis), FOREIGN KEY (list, version) REFERENCES releases (list, version));`,
+		`CREATE OR REPLACE FUNCTION reject_release_change() RETURNS trigger AS $$ BEGIN RAISE EXCEPTION 'releases are immutable'; END; $$ LANGUAGE plpgsql;`,
+		`CREATE TRIGGER releases_immutable BEFORE UPDATE OR DELETE ON releases FOR EACH ROW EXECUTE PROCEDURE reject_release_change();`,
+		`CREATE TRIGGER release_regions_immutable BEFORE UPDATE OR DELETE ON release_regions FOR EACH ROW EXECUTE PROCEDURE reject_release_change();`,
+	}
+	return
+}
+
+func softDeleteListRegions(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`ALTER TABLE list_regions ADD COLUMN removed_at timestamptz;`,
+	}
+	return
+}
+
+func getSortedTables(tables map[string]struct{}) (sortedTables []string) {
+	for table := range tables {
+		sortedTables = append(sortedTables, table)
+	}
+	sort.Strings(sortedTables)
+	return
+}
+
+func getLatestVersion(migrations []migration) (version int) {
+	for _, m := range migrations {
+		if m.Version > version {
+			version = m.Version
+		}
+	}
+	return
+}
+
+func getPendingMigrations(migrations []migration, applied map[int]string) (pending []migration) {
+	for _, m := range migrations {
+		if _, done := applied[m.Version]; !done {
+			pending = append(pending, m)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].Version < pending[j].Version })
+	return
+}
+
+func loadAppliedMigrations(ctx context.Context) (applied map[int]string, err error) {
+	applied = make(map[int]string)
+	if !session.Db.Connection.checkTableExists(ctx, "schema_migrations") {
+		return
+	}
+	if applied, err = session.Db.Connection.getAppliedMigrations(ctx); err != nil {
+		err = errors.Wrap(err, "Could not determine database schema version")
+	}
+	return
+}
+
+func checkSchemaVersion(ctx context.Context) (err error) {
+	applied, err := loadAppliedMigrations(ctx)
+	if err != nil {
+		return
+	}
+	if pending := getPendingMigrations(session.Db.Connection.getMigrations(), applied); len(pending) > 0 {
+		var names []string
+		for _, m := range pending {
+			names = append(names, fmt.Sprintf("%d_%s", m.Version, m.Name))
+		}
+		err = errors.New(fmt.Sprintf("Database schema of %s is outdated (pending migrations: %s). Run migrate up first", session.Db.Name, strings.Join(names, ", ")))
+	}
+	return
+}
+
+func migrateUp(ctx context.Context, dryRun bool) (err error) {
+	applied, err := loadAppliedMigrations(ctx)
+	if err != nil {
+		return
+	}
+	migrations := session.Db.Connection.getMigrations()
+	pending := getPendingMigrations(migrations, applied)
+	if len(pending) == 0 {
+		log.Printf("Database schema of %s is up to date (version %d).", session.Db.Name, getLatestVersion(migrations))
+		return
+	}
+	if !dryRun {
+		if err = session.Db.Connection.createMigrationTable(ctx); err != nil {
+			err = errors.Wrap(err, "Could not create migration table")
+			return
+		}
+	}
+	for _, m := range pending {
+		var tables map[string]struct{}
+		if tables, err = session.Db.Connection.getLegacyListTables(ctx); err != nil {
+			return
+		}
+		if m.Check != nil {
+			if err = m.Check(ctx, tables); err != nil {
+				err = errors.Wrap(err, fmt.Sprintf("Could not apply migration %d_%s", m.Version, m.Name))
+				return
+			}
+		}
+		var statements []string
+		if statements, err = m.Statements(tables); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not prepare migration %d_%s", m.Version, m.Name))
+			return
+		}
+		if dryRun {
+			fmt.Printf("-- %d_%s\n", m.Version, m.Name)
+			for _, statement := range statements {
+				fmt.Println(statement)
+			}
+			continue
+		}
+		if err = session.Db.Connection.applyMigration(ctx, m, statements); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not apply migration %d_%s", m.Version, m.Name))
+			return
+		}
+		log.Printf("Applied migration %d_%s to database %s.", m.Version, m.Name, session.Db.Name)
+	}
+	return
+}
+
+func migrationStatus(ctx context.Context) (lines [][]string, err error) {
+	applied, err := loadAppliedMigrations(ctx)
+	if err != nil {
+		return
+	}
+	lines = append(lines, []string{"version", "name", "applied_at"})
+	for _, m := range session.Db.Connection.getMigrations() {
+		appliedAt, done := applied[m.Version]
+		if !done {
+			appliedAt = "pending"
+		}
+		lines = append(lines, []string{fmt.Sprintf("%d", m.Version), m.Name, appliedAt})
+	}
+	return
+}
+
+func addTranscriptTags(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`ALTER TABLE region_exons ADD COLUMN transcript_tags varchar(255) NOT NULL DEFAULT '';`,
+	}
+	return
+}
+
+func recordEnsemblRelease(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`ALTER TABLE region_coordinates ADD COLUMN ensembl_release varchar(32) NOT NULL DEFAULT '';`,
+	}
+	return
+}
+
+func addRegionBuild(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`ALTER TABLE regions ADD COLUMN build varchar(8) NOT NULL DEFAULT '';`,
+	}
+	return
+}
+
+func addCodingRegions(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`ALTER TABLE region_exons ADD COLUMN transcript_biotype varchar(64) NOT NULL DEFAULT '';`,
+		`ALTER TABLE region_exons ADD COLUMN coding_start integer NOT NULL DEFAULT 0;`,
+		`ALTER TABLE region_exons ADD COLUMN coding_end integer NOT NULL DEFAULT 0;`,
+	}
+	return
+}
+
+func addPaddingRules(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`CREATE TABLE IF NOT EXISTS padding_rules (list varchar(63) NOT NULL DEFAULT '', analysis varchar(10) NOT NULL, class varchar(16) NOT NULL, size integer NOT NULL, PRIMARY KEY (list, analysis, class));`,
+	}
+	return
+}
+
+func addStrand(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`ALTER TABLE region_coordinates ADD COLUMN strand smallint NOT NULL DEFAULT 0;`,
+		`ALTER TABLE region_exons ADD COLUMN strand smallint NOT NULL DEFAULT 0;`,
+	}
+	return
+}
+
+func addReleasePadding(tables map[string]struct{}) (statements []string, err error) {
+	statements = []string{
+		`CREATE TABLE IF NOT EXISTS release_padding (list varchar(63) NOT NULL, version varchar(32) NOT NULL, analysis varchar(10) NOT NULL, class varchar(16) NOT NULL, size integer NOT NULL, PRIMARY KEY (list, version, analysis, class), FOREIGN KEY (list, version) REFERENCES releases (list, version));`,
+		`CREATE TRIGGER release_padding_immutable BEFORE UPDATE OR DELETE ON release_padding FOR EACH ROW EXECUTE PROCEDURE reject_release_change();`,
+	}
+	return
+}
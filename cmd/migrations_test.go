@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestWidenListColumns(t *testing.T) {
+	var cases = map[string]struct {
+		tables  map[string]struct{}
+		result  []string
+		wantErr bool
+	}{
+		"Alter list tables": {
+			map[string]struct{}{
+				"all": {},
+				"aml": {},
+			},
+			[]string{
+				`ALTER TABLE "all" ALTER COLUMN id TYPE varchar(64), ALTER COLUMN ensembl_id_38 TYPE varchar(32), ALTER COLUMN ensembl_id_37 TYPE varchar(32), ALTER COLUMN chromosome TYPE varchar(8);`,
+				`ALTER TABLE "aml" ALTER COLUMN id TYPE varchar(64), ALTER COLUMN ensembl_id_38 TYPE varchar(32), ALTER COLUMN ensembl_id_37 TYPE varchar(32), ALTER COLUMN chromosome TYPE varchar(8);`,
+			},
+			false,
+		},
+		"No list tables present": {
+			map[string]struct{}{},
+			nil,
+			false,
+		},
+		"Table name is invalid": {
+			map[string]struct{}{
+				"Aml List": {},
+			},
+			nil,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result, err := widenListColumns(c.tables)
+			checkError(t, err, c.wantErr)
+			if c.wantErr {
+				return
+			}
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestGetPendingMigrations(t *testing.T) {
+	var cases = map[string]struct {
+		applied map[int]string
+		result  int
+	}{
+		"Nothing applied": {
+			map[int]string{},
+			len(postgresMigrations),
+		},
+		"Everything applied": {
+			func() map[int]string {
+				applied := make(map[int]string)
+				for _, m := range postgresMigrations {
+					applied[m.Version] = "2022-01-01T00:00:00Z"
+				}
+				return applied
+			}(),
+			0,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result := getPendingMigrations(postgresMigrations, c.applied)
+			if diff := deep.Equal(len(result), c.result); diff != nil {
+				t.Error(diff)
+			}
+			for i := 1; i < len(result); i++ {
+				if result[i-1].Version >= result[i].Version {
+					t.Errorf("Migrations are not ordered: %d before %d", result[i-1].Version, result[i].Version)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	var cases = map[string]struct {
+		route   string
+		wantErr bool
+	}{
+		"Schema is up to date": {
+			"schemaUpToDate",
+			false,
+		},
+		"Schema is outdated": {
+			"schemaOutdated",
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getMockDb(c.route)
+			err := checkSchemaVersion(context.Background())
+			checkError(t, err, c.wantErr)
+		})
+	}
+}
+
+func TestMigrateUp(t *testing.T) {
+	var cases = map[string]struct {
+		route   string
+		wantErr bool
+	}{
+		"Apply pending migrations": {
+			"migrateUp",
+			false,
+		},
+		"Roll back failing migration": {
+			"migrateUpFails",
+			true,
+		},
+		"Nothing to apply": {
+			"schemaUpToDate",
+			false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getMockDb(c.route)
+			err := migrateUp(context.Background(), false)
+			checkError(t, err, c.wantErr)
+		})
+	}
+}
+
+func TestMigrationStatus(t *testing.T) {
+	var cases = map[string]struct {
+		route  string
+		result []string
+	}{
+		"Migration is pending": {
+			"schemaOutdated",
+			[]string{"1", "widen_list_columns", "pending"},
+		},
+		"Migration is applied": {
+			"schemaUpToDate",
+			[]string{"1", "widen_list_columns", "2022-01-01T00:00:00Z"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getMockDb(c.route)
+			result, err := migrationStatus(context.Background())
+			checkError(t, err, false)
+			if diff := deep.Equal(len(result), len(postgresMigrations)+1); diff != nil {
+				t.Error(diff)
+			}
+			if diff := deep.Equal(result[1], c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestNormalizeLists(t *testing.T) {
+	var cases = map[string]struct {
+		tables  map[string]struct{}
+		result  []string
+		wantErr bool
+	}{
+		"Move legacy list table": {
+			map[string]struct{}{
+				"aml": {},
+			},
+			[]string{
+				`INSERT INTO lists (name) VALUES ('aml') ON CONFLICT (name) DO NOTHING;`,
+				`INSERT INTO regions (id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end") SELECT id, ensembl_id_38, ensembl_id_37, class, chromosome, start, "end" FROM "aml" ON CONFLICT (id) DO NOTHING;`,
+				`INSERT INTO list_regions (list, region_id, analysis) SELECT 'aml', id, 'cnv' FROM "aml" WHERE "cnv" = true ON CONFLICT DO NOTHING;`,
+				`INSERT INTO list_regions (list, region_id, analysis) SELECT 'aml', id, 'pindel' FROM "aml" WHERE "pindel" = true ON CONFLICT DO NOTHING;`,
+				`INSERT INTO list_regions (list, region_id, analysis) SELECT 'aml', id, 'snv' FROM "aml" WHERE "snv" = true ON CONFLICT DO NOTHING;`,
+				`INSERT INTO list_regions (list, region_id, analysis) SELECT 'aml', id, 'sv' FROM "aml" WHERE "sv" = true ON CONFLICT DO NOTHING;`,
+				`DROP TABLE "aml";`,
+			},
+			false,
+		},
+		"No legacy tables present": {
+			map[string]struct{}{},
+			[]string{},
+			false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result, err := normalizeLists(c.tables)
+			checkError(t, err, c.wantErr)
+			// The first three statements create the normalized tables
+			if diff := deep.Equal(result[3:], c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCheckLegacyRegions(t *testing.T) {
+	var cases = map[string]struct {
+		route   string
+		wantErr bool
+	}{
+		"Regions are identical": {
+			"identicalRegions",
+			false,
+		},
+		"Region differs between lists": {
+			"conflictingRegions",
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getMockDb(c.route)
+			err := checkLegacyRegions(context.Background(), map[string]struct{}{"all": {}, "aml": {}})
+			checkError(t, err, c.wantErr)
+		})
+	}
+}
+
+func TestApplyMigrationTimeout(t *testing.T) {
+	var cases = map[string]struct {
+		timeout time.Duration
+		wantErr bool
+	}{
+		"Statements may take longer than a query": {
+			time.Second,
+			false,
+		},
+		"Migration timeout is exceeded": {
+			5 * time.Millisecond,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getMockDb("slowMigration")
+			session.Db.Timeout = time.Millisecond
+			session.Db.MigrationTimeout = c.timeout
+			err := session.Db.Connection.applyMigration(context.Background(), migration{Version: 2, Name: "normalize_lists"}, []string{`INSERT INTO regions SELECT * FROM "aml";`})
+			checkError(t, err, c.wantErr)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	_ "github.com/lib/pq"
+	"github.com/spf13/cobra"
+)
+
+var paddingCmd = &cobra.Command{
+	Use:   "padding",
+	Short: "Manage padding rules",
+	Long:  `Set, remove or show the padding added around regions per analysis, class and optionally list`,
+}
+
+var paddingSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set padding rule",
+	Long:  `Set the padding of a class for an analysis. Rules with tables only apply when extracting these lists`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		rules, err := getPaddingFlags(*cmd, true)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = session.initDbConnection(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = checkSchemaVersion(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		err = inTransaction(ctx, func() (err error) {
+			for _, rule := range rules {
+				if err = session.Db.Connection.setPaddingRule(ctx, rule); err != nil {
+					return
+				}
+			}
+			return
+		})
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+var paddingRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove padding rule",
+	Long:  `Remove the padding rule of a class for an analysis so that the default applies again`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		rules, err := getPaddingFlags(*cmd, false)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = session.initDbConnection(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = checkSchemaVersion(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		err = inTransaction(ctx, func() (err error) {
+			for _, rule := range rules {
+				if err = session.Db.Connection.removePaddingRule(ctx, rule); err != nil {
+					return
+				}
+			}
+			return
+		})
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+var paddingListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show padding rules",
+	Long:  `Show all stored padding rules. Classes without a rule use the defaults of the analysis`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		if err := session.initDbConnection(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := checkSchemaVersion(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		rules, err := session.Db.Connection.getPaddingRules(ctx)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = printTsv(paddingRulesToSlices(rules)); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+func getPaddingFlags(cmd cobra.Command, withSize bool) (rules []PaddingRule, err error) {
+	analysis, err := cmd.Flags().GetString("analysis")
+	if err != nil {
+		return
+	}
+	class, err := cmd.Flags().GetString("class")
+	if err != nil {
+		return
+	}
+	tables, err := cmd.Flags().GetString("tables")
+	if err != nil {
+		return
+	}
+	var size int
+	if withSize {
+		if size, err = cmd.Flags().GetInt("size"); err != nil {
+			return
+		}
+	}
+	lists := []string{""}
+	if tables != "" {
+		lists = strings.Split(tables, ",")
+	}
+	for _, list := range lists {
+		rule := PaddingRule{
+			Analysis: analysis,
+			Class:    class,
+			List:     strings.ToLower(strings.TrimSpace(list)),
+			Size:     size,
+		}
+		if err = rule.validate(false); err != nil {
+			return
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+func init() {
+	// Add padding command and its sub commands
+	rootCmd.AddCommand(paddingCmd)
+	paddingCmd.AddCommand(paddingSetCmd)
+	paddingCmd.AddCommand(paddingRemoveCmd)
+	paddingCmd.AddCommand(paddingListCmd)
+
+	// Add flags to set and remove command
+	for _, cmd := range []*cobra.Command{paddingSetCmd, paddingRemoveCmd} {
+		cmd.PersistentFlags().String("analysis", "", "choose analysis (cnv, pindel, snv, sv)")
+		cmd.PersistentFlags().String("class", "", "choose class (gene, transcript, exon, region)")
+		cmd.PersistentFlags().String("tables", "", "comma-separated list of tables the rule is limited to")
+	}
+	paddingSetCmd.PersistentFlags().Int("size", 0, "padding in bp added to both sides")
+}
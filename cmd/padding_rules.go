@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// validate checks the analysis, class, size and list of a rule. Configured
+// rules may leave out the analysis to apply to every analysis.
+func (r PaddingRule) validate(anyAnalysis bool) (err error) {
+	if _, valid := analyses[r.Analysis]; !valid && !(anyAnalysis && r.Analysis == "") {
+		err = errors.New(fmt.Sprintf("%s is not a valid analysis", r.Analysis))
+		return
+	}
+	if _, valid := classes[r.Class]; !valid {
+		err = errors.New(fmt.Sprintf("%s is not a valid class", r.Class))
+		return
+	}
+	if r.Size < 0 {
+		err = errors.New(fmt.Sprintf("Padding of %s must not be negative", r.Class))
+		return
+	}
+	if r.List != "" {
+		err = validateListName(r.List)
+	}
+	return
+}
+
+func (r PaddingRule) String() string {
+	name := fmt.Sprintf("%s:%s", r.Analysis, r.Class)
+	if r.List != "" {
+		name = fmt.Sprintf("%s@%s", name, r.List)
+	}
+	return name
+}
+
+// parsePaddingRules reads rules like "exon=20,sv:gene=100". Rules without an
+// analysis apply to every analysis.
+func parsePaddingRules(value string) (rules []PaddingRule, err error) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), "=")
+		if len(parts) != 2 {
+			err = errors.New(fmt.Sprintf("%s is not a valid padding rule (e.g. exon=20 or sv:gene=100)", entry))
+			return
+		}
+		var rule PaddingRule
+		if rule.Size, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("%s is not a valid padding rule", entry))
+			return
+		}
+		target := strings.Split(strings.ToLower(strings.TrimSpace(parts[0])), ":")
+		switch len(target) {
+		case 1:
+			rule.Class = target[0]
+		case 2:
+			rule.Analysis, rule.Class = target[0], target[1]
+		default:
+			err = errors.New(fmt.Sprintf("%s is not a valid padding rule (e.g. exon=20 or sv:gene=100)", entry))
+			return
+		}
+		if err = rule.validate(true); err != nil {
+			return
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+func getDefaultPadding(analysis string, class string) int {
+	if class == "region" {
+		return 0
+	}
+	return defaultPadding[analysis]
+}
+
+// resolvePadding combines the defaults of each analysis with the stored rules
+// and the configured ones. Lists with differing rules get the widest padding.
+func resolvePadding(ctx context.Context, analyses []string, lists []string) (padding map[string]map[string]int, err error) {
+	stored, err := session.Db.Connection.getPaddingRules(ctx)
+	if err != nil {
+		return
+	}
+	configured, err := parsePaddingRules(session.PaddingRules)
+	if err != nil {
+		return
+	}
+	if len(session.Releases) > 0 {
+		if stored, lists, err = getReleasePaddingRules(ctx, stored); err != nil {
+			return
+		}
+	}
+	padding = make(map[string]map[string]int)
+	for _, analysis := range analyses {
+		padding[analysis] = getAnalysisPadding(analysis, lists, stored, configured)
+	}
+	return
+}
+
+// getReleasePaddingRules replaces the list rules with the padding frozen by
+// each release, named after the release so that versions of a list differ.
+// Releases created before padding was frozen use the current rules.
+func getReleasePaddingRules(ctx context.Context, current []PaddingRule) (rules []PaddingRule, lists []string, err error) {
+	for _, rule := range current {
+		if rule.List == "" {
+			rules = append(rules, rule)
+		}
+	}
+	for _, release := range session.Releases {
+		var frozen []PaddingRule
+		if frozen, err = session.Db.Connection.getReleasePadding(ctx, release); err != nil {
+			return
+		}
+		if len(frozen) == 0 {
+			log.Printf("Warning: Release %s was created before padding was frozen, using the current padding rules", release)
+			for _, rule := range current {
+				if rule.List == release.List {
+					frozen = append(frozen, rule)
+				}
+			}
+		}
+		for _, rule := range frozen {
+			rule.List = release.String()
+			rules = append(rules, rule)
+		}
+		lists = append(lists, release.String())
+	}
+	return
+}
+
+func getAnalysisPadding(analysis string, lists []string, stored []PaddingRule, configured []PaddingRule) (padding map[string]int) {
+	padding = make(map[string]int)
+	for class := range classes {
+		size := getDefaultPadding(analysis, class)
+		listSizes := make(map[string]int)
+		for _, rule := range stored {
+			if rule.Analysis != analysis || rule.Class != class {
+				continue
+			}
+			if rule.List == "" {
+				size = rule.Size
+			} else {
+				listSizes[rule.List] = rule.Size
+			}
+		}
+		if len(listSizes) > 0 {
+			generic := size
+			for i, list := range lists {
+				listSize, present := listSizes[list]
+				if !present {
+					listSize = generic
+				}
+				if i == 0 || listSize > size {
+					size = listSize
+				}
+			}
+		}
+		for _, rule := range configured {
+			if (rule.Analysis == "" || rule.Analysis == analysis) && rule.Class == class {
+				size = rule.Size
+			}
+		}
+		padding[class] = size
+	}
+	return
+}
+
+// getPadding falls back to the defaults when padding was not resolved
+func getPadding(class string) int {
+	if size, present := session.Padding[class]; present {
+		return size
+	}
+	return getDefaultPadding(session.Analysis, class)
+}
+
+func formatPadding(padding map[string]int) string {
+	var sizes []string
+	for class, size := range padding {
+		sizes = append(sizes, fmt.Sprintf("%s=%d", class, size))
+	}
+	sort.Strings(sizes)
+	return strings.Join(sizes, ",")
+}
+
+func paddingRulesToSlices(rules []PaddingRule) (lines [][]string) {
+	lines = append(lines, []string{"analysis", "class", "list", "size"})
+	for _, rule := range rules {
+		list := rule.List
+		if list == "" {
+			list = "*"
+		}
+		lines = append(lines, []string{rule.Analysis, rule.Class, list, strconv.Itoa(rule.Size)})
+	}
+	return
+}
+
+func (d dbConnection) getPaddingRules(ctx context.Context) (rules []PaddingRule, err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	rows, err := d.conn().QueryContext(ctx, `SELECT analysis, class, list, size FROM padding_rules ORDER BY analysis, class, list;`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rule PaddingRule
+		if err = rows.Scan(&rule.Analysis, &rule.Class, &rule.List, &rule.Size); err != nil {
+			return
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+func (d dbConnection) getPaddingRule(ctx context.Context, rule PaddingRule) (stored *PaddingRule, err error) {
+	var size int
+	err = d.conn().QueryRowContext(ctx, `SELECT size FROM padding_rules WHERE list = $1 AND analysis = $2 AND class = $3;`, rule.List, rule.Analysis, rule.Class).Scan(&size)
+	if err == sql.ErrNoRows {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	rule.Size = size
+	stored = &rule
+	return
+}
+
+func (d dbConnection) setPaddingRule(ctx context.Context, rule PaddingRule) (err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	if rule.List != "" && !d.checkListExists(ctx, rule.List) {
+		err = errors.New(fmt.Sprintf("list %s is not present in database", rule.List))
+		return
+	}
+	old, err := d.getPaddingRule(ctx, rule)
+	if err != nil {
+		return
+	}
+	if _, err = d.conn().ExecContext(ctx, `INSERT INTO padding_rules (list, analysis, class, size) VALUES ($1, $2, $3, $4) ON CONFLICT (list, analysis, class) DO UPDATE SET size = excluded.size;`, rule.List, rule.Analysis, rule.Class, rule.Size); err != nil {
+		return
+	}
+	var oldValue interface{}
+	if old != nil {
+		oldValue = old
+	}
+	entry, err := newAuditEntry("set_padding", rule.List, "", oldValue, rule)
+	if err != nil {
+		return
+	}
+	if err = d.addAuditEntry(ctx, entry); err != nil {
+		return
+	}
+	log.Printf("Padding of %s was set to %d.", rule, rule.Size)
+	return
+}
+
+func (d dbConnection) removePaddingRule(ctx context.Context, rule PaddingRule) (err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	old, err := d.getPaddingRule(ctx, rule)
+	if err != nil {
+		return
+	}
+	if old == nil {
+		err = errors.New(fmt.Sprintf("No padding rule for %s is present in database", rule))
+		return
+	}
+	if _, err = d.conn().ExecContext(ctx, `DELETE FROM padding_rules WHERE list = $1 AND analysis = $2 AND class = $3;`, rule.List, rule.Analysis, rule.Class); err != nil {
+		return
+	}
+	entry, err := newAuditEntry("remove_padding", rule.List, "", old, nil)
+	if err != nil {
+		return
+	}
+	if err = d.addAuditEntry(ctx, entry); err != nil {
+		return
+	}
+	log.Printf("Padding rule of %s was removed.", rule)
+	return
+}
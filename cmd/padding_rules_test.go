@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestParsePaddingRules(t *testing.T) {
+	var cases = map[string]struct {
+		value   string
+		result  []PaddingRule
+		wantErr bool
+	}{
+		"Rules with and without analysis": {
+			"exon=20, SV:gene=100",
+			[]PaddingRule{
+				{Class: "exon", Size: 20},
+				{Analysis: "sv", Class: "gene", Size: 100},
+			},
+			false,
+		},
+		"Empty value": {
+			"",
+			nil,
+			false,
+		},
+		"Unknown class": {
+			"intron=20",
+			nil,
+			true,
+		},
+		"Unknown analysis": {
+			"wgs:exon=20",
+			nil,
+			true,
+		},
+		"Negative size": {
+			"exon=-1",
+			nil,
+			true,
+		},
+		"Size is missing": {
+			"exon",
+			nil,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result, err := parsePaddingRules(c.value)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestValidatePaddingRule(t *testing.T) {
+	var cases = map[string]struct {
+		rule        PaddingRule
+		anyAnalysis bool
+		wantErr     bool
+	}{
+		"Valid rule": {
+			PaddingRule{Analysis: "snv", Class: "exon", List: "aml", Size: 20},
+			false,
+			false,
+		},
+		"Stored rule needs analysis": {
+			PaddingRule{Class: "exon", Size: 20},
+			false,
+			true,
+		},
+		"Configured rule applies to every analysis": {
+			PaddingRule{Class: "exon", Size: 20},
+			true,
+			false,
+		},
+		"Invalid analysis": {
+			PaddingRule{Analysis: "wgs", Class: "exon", Size: 20},
+			true,
+			true,
+		},
+		"Invalid class": {
+			PaddingRule{Analysis: "snv", Class: "intron", Size: 20},
+			false,
+			true,
+		},
+		"Negative size": {
+			PaddingRule{Analysis: "snv", Class: "exon", Size: -1},
+			false,
+			true,
+		},
+		"Invalid list": {
+			PaddingRule{Analysis: "snv", Class: "exon", List: "aml; DROP", Size: 20},
+			false,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := c.rule.validate(c.anyAnalysis)
+			checkError(t, err, c.wantErr)
+		})
+	}
+}
+
+func TestResolvePadding(t *testing.T) {
+	var cases = map[string]struct {
+		analysis   string
+		configured string
+		lists      []string
+		result     map[string]int
+	}{
+		"Defaults of pindel": {
+			"pindel",
+			"",
+			[]string{"aml"},
+			map[string]int{"exon": 50, "gene": 50, "region": 0, "transcript": 50},
+		},
+		"Stored rule of analysis": {
+			"snv",
+			"",
+			[]string{"all"},
+			map[string]int{"exon": 10, "gene": 10, "region": 25, "transcript": 10},
+		},
+		"Widest list rule wins": {
+			"snv",
+			"",
+			[]string{"all", "aml"},
+			map[string]int{"exon": 30, "gene": 10, "region": 25, "transcript": 10},
+		},
+		"List rule is narrower than generic rule": {
+			"snv",
+			"",
+			[]string{"aml"},
+			map[string]int{"exon": 30, "gene": 10, "region": 5, "transcript": 10},
+		},
+		"Configured rule overrides stored rules": {
+			"snv",
+			"exon=0,cnv:gene=99",
+			[]string{"aml"},
+			map[string]int{"exon": 0, "gene": 10, "region": 5, "transcript": 10},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, true)
+			ctx := context.Background()
+			for _, list := range []string{"aml", "all"} {
+				if err := ensureListExists(ctx, list); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, rule := range []PaddingRule{
+				{Analysis: "snv", Class: "region", Size: 25},
+				{Analysis: "snv", Class: "region", List: "aml", Size: 5},
+				{Analysis: "snv", Class: "exon", List: "aml", Size: 30},
+				{Analysis: "cnv", Class: "exon", Size: 70},
+			} {
+				if err := session.Db.Connection.setPaddingRule(ctx, rule); err != nil {
+					t.Fatal(err)
+				}
+			}
+			session.PaddingRules = c.configured
+			result, err := resolvePadding(ctx, []string{c.analysis}, c.lists)
+			checkError(t, err, false)
+			if diff := deep.Equal(result[c.analysis], c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSqlitePaddingRules(t *testing.T) {
+	var cases = map[string]struct {
+		rules   []PaddingRule
+		removed PaddingRule
+		result  []PaddingRule
+		wantErr bool
+		actions []string
+	}{
+		"Rule is updated and removed": {
+			[]PaddingRule{
+				{Analysis: "sv", Class: "gene", Size: 100},
+				{Analysis: "sv", Class: "gene", Size: 200},
+				{Analysis: "sv", Class: "exon", List: "aml", Size: 20},
+			},
+			PaddingRule{Analysis: "sv", Class: "exon", List: "aml"},
+			[]PaddingRule{
+				{Analysis: "sv", Class: "gene", Size: 200},
+			},
+			false,
+			[]string{"create_list", "set_padding", "set_padding", "set_padding", "remove_padding"},
+		},
+		"Rule of unknown list": {
+			[]PaddingRule{
+				{Analysis: "sv", Class: "gene", List: "all", Size: 100},
+			},
+			PaddingRule{},
+			nil,
+			true,
+			[]string{"create_list"},
+		},
+		"Removed rule is missing": {
+			nil,
+			PaddingRule{Analysis: "sv", Class: "gene"},
+			nil,
+			true,
+			[]string{"create_list"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, true)
+			ctx := context.Background()
+			if err := ensureListExists(ctx, "aml"); err != nil {
+				t.Fatal(err)
+			}
+			err := inTransaction(ctx, func() (err error) {
+				for _, rule := range c.rules {
+					if err = session.Db.Connection.setPaddingRule(ctx, rule); err != nil {
+						return
+					}
+				}
+				err = session.Db.Connection.removePaddingRule(ctx, c.removed)
+				return
+			})
+			checkError(t, err, c.wantErr)
+			result, err := session.Db.Connection.getPaddingRules(ctx)
+			checkError(t, err, false)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+			entries, err := session.Db.Connection.getHistory(ctx, HistoryFilter{})
+			checkError(t, err, false)
+			var actions []string
+			for _, entry := range entries {
+				actions = append(actions, entry.Action)
+			}
+			if diff := deep.Equal(actions, c.actions); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSqliteReleasePadding(t *testing.T) {
+	var cases = map[string]struct {
+		releases []Release
+		result   map[string]int
+	}{
+		"Release keeps padding of its creation": {
+			[]Release{{List: "aml", Version: "1.0"}},
+			map[string]int{"exon": 30, "gene": 10, "region": 0, "transcript": 10},
+		},
+		"Widest padding of releases is used": {
+			[]Release{{List: "aml", Version: "1.0"}, {List: "aml", Version: "2.0"}},
+			map[string]int{"exon": 50, "gene": 10, "region": 0, "transcript": 10},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, true)
+			ctx := context.Background()
+			addTestRow(t, DbTableRow{Analyses: map[string]struct{}{"snv": {}}, Chromosome: "1", Class: "region", End: "200", Id: "REGION1", Start: "100"}, "aml")
+			for _, step := range []struct {
+				size    int
+				release Release
+			}{
+				{30, Release{List: "aml", Version: "1.0"}},
+				{50, Release{List: "aml", Version: "2.0"}},
+			} {
+				if err := session.Db.Connection.setPaddingRule(ctx, PaddingRule{Analysis: "snv", Class: "exon", List: "aml", Size: step.size}); err != nil {
+					t.Fatal(err)
+				}
+				if err := createReleases(ctx, []Release{step.release}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := session.Db.Connection.setPaddingRule(ctx, PaddingRule{Analysis: "snv", Class: "exon", Size: 99}); err != nil {
+				t.Fatal(err)
+			}
+			if err := session.Db.Connection.setPaddingRule(ctx, PaddingRule{Analysis: "snv", Class: "exon", List: "aml", Size: 70}); err != nil {
+				t.Fatal(err)
+			}
+			session.Releases = c.releases
+			result, err := resolvePadding(ctx, []string{"snv"}, []string{"aml"})
+			checkError(t, err, false)
+			if diff := deep.Equal(result["snv"], c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
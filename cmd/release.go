@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	_ "github.com/lib/pq"
+	"github.com/spf13/cobra"
+)
+
+var releaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Manage list releases",
+	Long:  `Freeze the current contents of gene lists under a version tag or show existing releases`,
+}
+
+var releaseCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create release",
+	Long:  `Freeze the current contents of one or more lists under a version tag. Releases cannot be changed afterwards`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		releases, err := getReleaseFlags(*cmd)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = session.initDbConnection(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = checkSchemaVersion(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = createReleases(ctx, releases); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+var releaseListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show releases",
+	Long:  `Show all releases with their notes and when they were created`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		if err := session.initDbConnection(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := checkSchemaVersion(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		releases, err := session.Db.Connection.getReleases(ctx)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = printTsv(releasesToSlices(releases)); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+func getReleaseFlags(cmd cobra.Command) (releases []Release, err error) {
+	tables, err := cmd.Flags().GetString("tables")
+	if err != nil {
+		return
+	}
+	version, err := cmd.Flags().GetString("version")
+	if err != nil {
+		return
+	}
+	notes, err := cmd.Flags().GetString("notes")
+	if err != nil {
+		return
+	}
+	for _, list := range strings.Split(tables, ",") {
+		release := Release{
+			List:    strings.ToLower(strings.TrimSpace(list)),
+			Notes:   notes,
+			Version: version,
+		}
+		if err = release.validate(); err != nil {
+			return
+		}
+		releases = append(releases, release)
+	}
+	return
+}
+
+func init() {
+	// Add release command and its sub commands
+	rootCmd.AddCommand(releaseCmd)
+	releaseCmd.AddCommand(releaseCreateCmd)
+	releaseCmd.AddCommand(releaseListCmd)
+
+	// Add flags to create command
+	releaseCreateCmd.PersistentFlags().String("notes", "", "describe what changed in this release")
+	releaseCreateCmd.PersistentFlags().String("tables", "", "comma-separated list of tables to be released")
+	releaseCreateCmd.PersistentFlags().String("version", "", "version tag of release (e.g. 2.1)")
+}
@@ -0,0 +1,447 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var releaseVersionRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,31}$`)
+
+type frozenRegion struct {
+	Build       string                    `json:"build,omitempty"`
+	Chromosome  string                    `json:"chromosome"`
+	Class       string                    `json:"class"`
+	Coordinates map[string]EnsemblBaseObj `json:"coordinates,omitempty"`
+	End         string                    `json:"end"`
+	EnsemblId37 string                    `json:"ensembl_id_37"`
+	EnsemblId38 string                    `json:"ensembl_id_38"`
+	Exons       map[string][]frozenExon   `json:"exons,omitempty"`
+	Id          string                    `json:"id"`
+	Start       string                    `json:"start"`
+}
+
+type frozenExon struct {
+	Biotype     string   `json:"biotype,omitempty"`
+	Chromosome  string   `json:"chromosome"`
+	CodingEnd   int      `json:"coding_end,omitempty"`
+	CodingStart int      `json:"coding_start,omitempty"`
+	End         int      `json:"end"`
+	EnsemblId   string   `json:"id"`
+	Start       int      `json:"start"`
+	Strand      int      `json:"strand,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Transcript  string   `json:"transcript"`
+}
+
+func parseRelease(value string) (release Release, err error) {
+	parts := strings.Split(value, "@")
+	if len(parts) != 2 {
+		err = errors.New(fmt.Sprintf("%s is not a valid release (e.g. aml@2.1)", value))
+		return
+	}
+	release.List = strings.ToLower(strings.TrimSpace(parts[0]))
+	release.Version = strings.TrimSpace(parts[1])
+	err = release.validate()
+	return
+}
+
+func (r Release) validate() (err error) {
+	if err = validateListName(r.List); err != nil {
+		return
+	}
+	if !releaseVersionRegex.MatchString(r.Version) {
+		err = errors.New(fmt.Sprintf("%s is not a valid release version; use letters, digits, dots, dashes and underscores", r.Version))
+	}
+	return
+}
+
+func (r Release) String() string {
+	return fmt.Sprintf("%s@%s", r.List, r.Version)
+}
+
+func (d DbTableRow) freeze() (data string, err error) {
+	region := frozenRegion{
+		Build:       d.Build,
+		Chromosome:  d.Chromosome,
+		Class:       d.Class,
+		Coordinates: d.Coordinates,
+		End:         d.End,
+		EnsemblId37: d.EnsemblId37,
+		EnsemblId38: d.EnsemblId38,
+		Id:          d.Id,
+		Start:       d.Start,
+	}
+	for build, exons := range d.Exons {
+		if region.Exons == nil {
+			region.Exons = make(map[string][]frozenExon)
+		}
+		for _, exon := range exons {
+			region.Exons[build] = append(region.Exons[build], frozenExon{
+				Biotype:     exon.Biotype,
+				Chromosome:  exon.Chromosome,
+				CodingEnd:   exon.CodingEnd,
+				CodingStart: exon.CodingStart,
+				End:         exon.End,
+				EnsemblId:   exon.EnsemblId,
+				Start:       exon.Start,
+				Strand:      exon.Strand,
+				Tags:        exon.Tags,
+				Transcript:  exon.Transcript,
+			})
+		}
+	}
+	var bytes []byte
+	if bytes, err = json.Marshal(region); err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not freeze region %s", d.Id))
+		return
+	}
+	data = string(bytes)
+	return
+}
+
+func thaw(data string, build string) (row DbTableRow, err error) {
+	var region frozenRegion
+	if err = json.Unmarshal([]byte(data), &region); err != nil {
+		err = errors.Wrap(err, "Could not read frozen region")
+		return
+	}
+	row = DbTableRow{
+		Build:       region.Build,
+		Chromosome:  region.Chromosome,
+		Class:       region.Class,
+		End:         region.End,
+		EnsemblId37: region.EnsemblId37,
+		EnsemblId38: region.EnsemblId38,
+		Id:          region.Id,
+		Start:       region.Start,
+	}
+	if coordinates, present := region.Coordinates[build]; present {
+		row.Coordinates = map[string]EnsemblBaseObj{build: coordinates}
+	}
+	if exons, present := region.Exons[build]; present {
+		row.Exons = make(map[string][]EnsemblBaseObj)
+		for _, exon := range exons {
+			row.Exons[build] = append(row.Exons[build], EnsemblBaseObj{
+				Biotype:     exon.Biotype,
+				Chromosome:  exon.Chromosome,
+				CodingEnd:   exon.CodingEnd,
+				CodingStart: exon.CodingStart,
+				End:         exon.End,
+				EnsemblId:   exon.EnsemblId,
+				Start:       exon.Start,
+				Strand:      exon.Strand,
+				Tags:        exon.Tags,
+				Transcript:  exon.Transcript,
+			})
+		}
+	}
+	return
+}
+
+func createReleases(ctx context.Context, releases []Release) (err error) {
+	regions := make([][]DbTableRow, len(releases))
+	members := make([]map[string][]string, len(releases))
+	for i, release := range releases {
+		if regions[i], members[i], err = getReleaseContent(ctx, release); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not create release %s", release))
+			return
+		}
+	}
+	err = inTransaction(ctx, func() (err error) {
+		for i, release := range releases {
+			if err = session.Db.Connection.createRelease(ctx, release, regions[i], members[i]); err != nil {
+				err = errors.Wrap(err, fmt.Sprintf("Could not create release %s", release))
+				return
+			}
+		}
+		return
+	})
+	return
+}
+
+// getReleaseContent reads the current content of a list and resolves missing
+// coordinates before any transaction is opened
+func getReleaseContent(ctx context.Context, release Release) (regions []DbTableRow, members map[string][]string, err error) {
+	queryCtx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	if !session.Db.Connection.checkListExists(queryCtx, release.List) {
+		err = errors.New(fmt.Sprintf("list %s is not present in database", release.List))
+		return
+	}
+	exists, err := session.Db.Connection.checkReleaseExists(queryCtx, release)
+	if err != nil {
+		return
+	}
+	if exists {
+		err = errors.New(fmt.Sprintf("Release %s already exists and cannot be changed", release))
+		return
+	}
+	if regions, members, err = session.Db.Connection.getListContent(queryCtx, release.List); err != nil {
+		return
+	}
+	if len(regions) == 0 {
+		err = errors.New(fmt.Sprintf("list %s is empty", release.List))
+		return
+	}
+	// Releases have to be reproducible without Ensembl, so coordinates of
+	// regions added before they were stored are resolved once and frozen
+	var index []int
+	var pending []DbTableRow
+	for i, region := range regions {
+		if region.Class != "region" && len(region.Coordinates) == 0 {
+			index = append(index, i)
+			pending = append(pending, region)
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("No stored coordinates for %d regions, querying Ensembl", len(pending))
+		if err = lookupCoordinates(ctx, pending, builds); err != nil {
+			err = errors.Wrap(err, "Could not resolve coordinates")
+			return
+		}
+		for i, region := range pending {
+			regions[index[i]] = region
+		}
+	}
+	return
+}
+
+func (d dbConnection) createRelease(ctx context.Context, release Release, regions []DbTableRow, members map[string][]string) (err error) {
+	writeCtx, cancelWrite := withTimeout(ctx, session.Db.Timeout)
+	defer cancelWrite()
+	// Another process may have created the release since its content was read
+	exists, err := d.checkReleaseExists(writeCtx, release)
+	if err != nil {
+		return
+	}
+	if exists {
+		err = errors.New(fmt.Sprintf("Release %s already exists and cannot be changed", release))
+		return
+	}
+	release.CreatedAt = time.Now().UTC()
+	release.CreatedBy = getCurrentUser()
+	if _, err = d.conn().ExecContext(writeCtx, `INSERT INTO releases (list, version, notes, created_at, created_by) VALUES ($1, $2, $3, $4, $5);`, release.List, release.Version, release.Notes, release.CreatedAt, release.CreatedBy); err != nil {
+		return
+	}
+	var stmt *sql.Stmt
+	stmt, err = d.conn().PrepareContext(writeCtx, `INSERT INTO release_regions (list, version, region_id, analysis, data) VALUES ($1, $2, $3, $4, $5);`)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+	for _, region := range regions {
+		var data string
+		if data, err = region.freeze(); err != nil {
+			return
+		}
+		for _, analysis := range members[region.Id] {
+			if _, err = stmt.ExecContext(writeCtx, release.List, release.Version, region.Id, analysis, data); err != nil {
+				return
+			}
+		}
+	}
+	if err = d.freezePadding(writeCtx, release); err != nil {
+		return
+	}
+	var entry AuditEntry
+	if entry, err = newAuditEntry("create_release", release.List, "", nil, map[string]string{"version": release.Version, "notes": release.Notes}); err != nil {
+		return
+	}
+	if err = d.addAuditEntry(writeCtx, entry); err != nil {
+		return
+	}
+	log.Printf("Release %s was created with %d regions.", release, len(regions))
+	return
+}
+
+// freezePadding stores the padding every analysis and class of the list gets
+// at creation, so that later padding rules do not change the release
+func (d dbConnection) freezePadding(ctx context.Context, release Release) (err error) {
+	stored, err := d.getPaddingRules(ctx)
+	if err != nil {
+		return
+	}
+	stmt, err := d.conn().PrepareContext(ctx, `INSERT INTO release_padding (list, version, analysis, class, size) VALUES ($1, $2, $3, $4, $5);`)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+	for _, analysis := range getAnalyses(analyses) {
+		padding := getAnalysisPadding(analysis, []string{release.List}, stored, nil)
+		for class, size := range padding {
+			if _, err = stmt.ExecContext(ctx, release.List, release.Version, analysis, class, size); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func (d dbConnection) getReleasePadding(ctx context.Context, release Release) (rules []PaddingRule, err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	rows, err := d.conn().QueryContext(ctx, `SELECT analysis, class, size FROM release_padding WHERE list = $1 AND version = $2 ORDER BY analysis, class;`, release.List, release.Version)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rule := PaddingRule{List: release.List}
+		if err = rows.Scan(&rule.Analysis, &rule.Class, &rule.Size); err != nil {
+			return
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+func (d dbConnection) checkReleaseExists(ctx context.Context, release Release) (exists bool, err error) {
+	err = d.conn().QueryRowContext(ctx, `SELECT EXISTS (SELECT version FROM releases WHERE list = $1 AND version = $2);`, release.List, release.Version).Scan(&exists)
+	return
+}
+
+func (d dbConnection) getListContent(ctx context.Context, list string) (regions []DbTableRow, members map[string][]string, err error) {
+	rows, err := d.conn().QueryContext(ctx, `SELECT r.id, r.ensembl_id_38, r.ensembl_id_37, r.class, r.chromosome, r.start, r."end", r.build, l.analysis FROM regions r JOIN list_regions l ON l.region_id = r.id WHERE l.list = $1 AND l.removed_at IS NULL ORDER BY r.id, l.analysis;`, list)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	members = make(map[string][]string)
+	index := make(map[string]int)
+	for rows.Next() {
+		var region DbTableRow
+		var analysis string
+		if err = rows.Scan(&region.Id, &region.EnsemblId38, &region.EnsemblId37, &region.Class, &region.Chromosome, &region.Start, &region.End, &region.Build, &analysis); err != nil {
+			return
+		}
+		if _, present := index[region.Id]; !present {
+			index[region.Id] = len(regions)
+			regions = append(regions, region)
+		}
+		members[region.Id] = append(members[region.Id], analysis)
+	}
+	if err = rows.Close(); err != nil {
+		return
+	}
+	err = d.getStoredCoordinates(ctx, regions, `WHERE region_id IN (SELECT region_id FROM list_regions WHERE list = $1 AND removed_at IS NULL)`, list)
+	return
+}
+
+func (d dbConnection) getReleases(ctx context.Context) (releases []Release, err error) {
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	rows, err := d.conn().QueryContext(ctx, `SELECT list, version, notes, created_at, created_by FROM releases ORDER BY list, created_at;`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var release Release
+		if err = rows.Scan(&release.List, &release.Version, &release.Notes, &release.CreatedAt, &release.CreatedBy); err != nil {
+			return
+		}
+		releases = append(releases, release)
+	}
+	return
+}
+
+// getReleaseRegions retrieves the frozen regions of all analyses at once,
+// recording which analyses each region belongs to
+func (d dbConnection) getReleaseRegions(ctx context.Context, analyses []string) (regions []DbTableRow, err error) {
+	var names []string
+	for _, release := range session.Releases {
+		names = append(names, release.String())
+	}
+	log.Printf("Retriewing %s gene list from release %s", strings.Join(analyses, ", "), strings.Join(names, ", "))
+	ctx, cancel := withTimeout(ctx, session.Db.Timeout)
+	defer cancel()
+	var args []interface{}
+	var placeholders, conditions []string
+	for _, analysis := range analyses {
+		args = append(args, analysis)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	for _, release := range session.Releases {
+		var exists bool
+		if exists, err = d.checkReleaseExists(ctx, release); err != nil {
+			return
+		}
+		if !exists {
+			err = errors.New(fmt.Sprintf("Release %s is not present in database", release))
+			return
+		}
+		args = append(args, release.List, release.Version)
+		conditions = append(conditions, fmt.Sprintf("(list = $%d AND version = $%d)", len(args)-1, len(args)))
+	}
+	query := fmt.Sprintf(`SELECT region_id, list, version, analysis, data FROM release_regions WHERE analysis IN (%s) AND (%s) ORDER BY region_id, list, version, analysis;`, strings.Join(placeholders, ", "), strings.Join(conditions, " OR "))
+	rows, err := d.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	// A region frozen differently by several releases cannot be extracted from
+	// all of them at once
+	var frozen DbTableRow
+	var frozenIn Release
+	var conflicts []string
+	for rows.Next() {
+		var id, analysis, data string
+		var release Release
+		if err = rows.Scan(&id, &release.List, &release.Version, &analysis, &data); err != nil {
+			return
+		}
+		var region DbTableRow
+		if region, err = thaw(data, session.Build); err != nil {
+			return
+		}
+		if last := len(regions) - 1; last >= 0 && regions[last].Id == id {
+			regions[last].Analyses[analysis] = struct{}{}
+			if !sameFrozenRegion(region, frozen) {
+				conflicts = append(conflicts, fmt.Sprintf("%s (%s, %s)", id, frozenIn, release))
+			}
+			continue
+		}
+		frozen, frozenIn = region, release
+		region.Analyses = map[string]struct{}{analysis: {}}
+		regions = append(regions, region)
+	}
+	if len(conflicts) > 0 {
+		err = errors.New(fmt.Sprintf("The following regions are frozen differently in the selected releases: %s. Extract the releases separately", strings.Join(uniqueStrings(conflicts), ", ")))
+		return
+	}
+	if len(regions) == 0 {
+		err = errors.New(fmt.Sprintf("Could not find any data for %s in release %s", strings.Join(analyses, ", "), strings.Join(names, ", ")))
+	}
+	return
+}
+
+// sameFrozenRegion compares frozen regions without the Ensembl release their
+// coordinates were resolved with, which does not change their intervals
+func sameFrozenRegion(a DbTableRow, b DbTableRow) bool {
+	for _, region := range []*DbTableRow{&a, &b} {
+		coordinates := make(map[string]EnsemblBaseObj)
+		for build, coordinate := range region.Coordinates {
+			coordinate.Release = ""
+			coordinates[build] = coordinate
+		}
+		region.Coordinates = coordinates
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func releasesToSlices(releases []Release) (lines [][]string) {
+	lines = append(lines, []string{"release", "created_at", "created_by", "notes"})
+	for _, release := range releases {
+		lines = append(lines, []string{release.String(), release.CreatedAt.UTC().Format(time.RFC3339), release.CreatedBy, release.Notes})
+	}
+	return
+}
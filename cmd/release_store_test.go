@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestParseRelease(t *testing.T) {
+	var cases = map[string]struct {
+		value   string
+		result  Release
+		wantErr bool
+	}{
+		"Release is valid": {
+			"AML@2.1",
+			Release{
+				List:    "aml",
+				Version: "2.1",
+			},
+			false,
+		},
+		"Version is missing": {
+			"aml",
+			Release{},
+			true,
+		},
+		"Version contains invalid characters": {
+			"aml@2.1;drop",
+			Release{
+				List:    "aml",
+				Version: "2.1;drop",
+			},
+			true,
+		},
+		"List name is invalid": {
+			"1aml@2.1",
+			Release{
+				List:    "1aml",
+				Version: "2.1",
+			},
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			result, err := parseRelease(c.value)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSqliteReleases(t *testing.T) {
+	var cases = map[string]struct {
+		added   DbTableRow
+		release Release
+		result  []DbTableRow
+	}{
+		"Release is not affected by later changes": {
+			DbTableRow{
+				Analyses:   map[string]struct{}{"snv": {}},
+				Chromosome: "2",
+				Class:      "region",
+				End:        "400",
+				Id:         "REGION2",
+				Start:      "300",
+			},
+			Release{
+				List:    "aml",
+				Notes:   "validated panel",
+				Version: "2.1",
+			},
+			[]DbTableRow{
+				{
+					Analyses:   map[string]struct{}{"snv": {}},
+					Chromosome: "1",
+					Class:      "gene",
+					Coordinates: map[string]EnsemblBaseObj{
+						"38": {Chromosome: "1", Start: 100, End: 200, EnsemblId: "ENSG001"},
+					},
+					EnsemblId37: "ENSG001",
+					EnsemblId38: "ENSG001",
+					Exons: map[string][]EnsemblBaseObj{
+						"38": {
+							{Chromosome: "1", Start: 100, End: 130, EnsemblId: "ENSE001", Transcript: "ENST001"},
+						},
+					},
+					Id: "GENE1",
+				},
+				{
+					Analyses:   map[string]struct{}{"snv": {}},
+					Chromosome: "1",
+					Class:      "region",
+					End:        "200",
+					Id:         "REGION1",
+					Start:      "100",
+				},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, true)
+			for _, row := range c.result {
+				row.Analyses = map[string]struct{}{"snv": {}}
+				if row.Class == "gene" {
+					row.Coordinates = map[string]EnsemblBaseObj{
+						"37": {Chromosome: "1", Start: 50, End: 150},
+						"38": row.Coordinates["38"],
+					}
+				}
+				if err := ensureListExists(context.Background(), c.release.List); err != nil {
+					t.Fatal(err)
+				}
+				if err := session.Db.Connection.addNewRow(context.Background(), row); err != nil {
+					t.Fatal(err)
+				}
+				if err := session.Db.Connection.updateRow(context.Background(), c.release.List, row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := createReleases(context.Background(), []Release{c.release})
+			checkError(t, err, false)
+			err = createReleases(context.Background(), []Release{c.release})
+			checkError(t, err, true)
+			addTestRow(t, c.added, c.release.List)
+			session.Build = "38"
+			session.Releases = []Release{c.release}
+			result, err := session.Db.Connection.getReleaseRegions(context.Background(), []string{"snv"})
+			checkError(t, err, false)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+			releases, err := session.Db.Connection.getReleases(context.Background())
+			checkError(t, err, false)
+			if len(releases) != 1 || releases[0].Notes != c.release.Notes {
+				t.Errorf("Release %s was not listed correctly: %v", c.release, releases)
+			}
+			connection := session.Db.Connection.(sqliteConnection)
+			for _, query := range []string{
+				`UPDATE releases SET notes = 'changed';`,
+				`DELETE FROM release_regions;`,
+			} {
+				_, err = connection.db.ExecContext(context.Background(), query)
+				checkError(t, err, true)
+			}
+		})
+	}
+}
+
+func TestSqliteReleaseConflicts(t *testing.T) {
+	var cases = map[string]struct {
+		start   int
+		wantErr bool
+	}{
+		"Gene frozen identically by both releases": {
+			100,
+			false,
+		},
+		"Gene frozen with different coordinates": {
+			120,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			getSqliteDb(t, true)
+			ctx := context.Background()
+			gene := DbTableRow{
+				Analyses:    map[string]struct{}{"snv": {}},
+				Class:       "gene",
+				Coordinates: map[string]EnsemblBaseObj{"37": {Chromosome: "1", Start: 50, End: 150}, "38": {Chromosome: "1", Start: 100, End: 200}},
+				EnsemblId37: "ENSG001",
+				EnsemblId38: "ENSG001",
+				Exons:       map[string][]EnsemblBaseObj{"37": {{Biotype: "protein_coding"}}, "38": {{Biotype: "protein_coding"}}},
+				Id:          "GENE1",
+			}
+			if err := session.Db.Connection.addNewRow(ctx, gene); err != nil {
+				t.Fatal(err)
+			}
+			for _, list := range []string{"aml", "all"} {
+				if err := ensureListExists(ctx, list); err != nil {
+					t.Fatal(err)
+				}
+				if err := session.Db.Connection.updateRow(ctx, list, gene); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := createReleases(ctx, []Release{{List: "aml", Version: "1.0"}}); err != nil {
+				t.Fatal(err)
+			}
+			gene.Coordinates["38"] = EnsemblBaseObj{Chromosome: "1", Start: c.start, End: 200}
+			if err := session.Db.Connection.replaceCoordinates(ctx, gene); err != nil {
+				t.Fatal(err)
+			}
+			if err := createReleases(ctx, []Release{{List: "all", Version: "1.0"}}); err != nil {
+				t.Fatal(err)
+			}
+			session.Build = "38"
+			session.Releases = []Release{{List: "aml", Version: "1.0"}, {List: "all", Version: "1.0"}}
+			result, err := session.Db.Connection.getReleaseRegions(ctx, []string{"snv"})
+			checkError(t, err, c.wantErr)
+			if !c.wantErr && (len(result) != 1 || result[0].Coordinates["38"].Start != 100) {
+				t.Errorf("Unexpected regions %v", result)
+			}
+		})
+	}
+}
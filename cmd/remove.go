@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var removeCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove genetic regions from lists",
+	Long:  `Remove genetic regions from lists, either completely or for selected analyses only. Regions are kept in the database and removals are recorded in the history`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		rows, err := getRemoveFlags(*cmd)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = session.initDbConnection(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = checkSchemaVersion(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = removeRows(ctx, rows); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+func getRemoveFlags(cmd cobra.Command) (rows []DbTableRow, err error) {
+	ids, err := cmd.Flags().GetString("id")
+	if err != nil {
+		return
+	}
+	tables, err := cmd.Flags().GetString("tables")
+	if err != nil {
+		return
+	}
+	analysis, err := cmd.Flags().GetString("analysis")
+	if err != nil {
+		return
+	}
+	var template DbTableRow
+	if analysis == "" {
+		template.Analyses = analyses
+	} else if err = template.validateAnalyses(strings.ToLower(analysis)); err != nil {
+		return
+	}
+	if err = template.validateTables(tables); err != nil {
+		return
+	}
+	for _, id := range strings.Split(ids, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			err = errors.New("No id was given")
+			return
+		}
+		rows = append(rows, DbTableRow{
+			Action:   "remove",
+			Analyses: template.Analyses,
+			Id:       id,
+			Tables:   template.Tables,
+		})
+	}
+	return
+}
+
+func removeRows(ctx context.Context, rows []DbTableRow) (err error) {
+	err = inTransaction(ctx, func() (err error) {
+		for _, row := range rows {
+			if err = row.removeFromDb(ctx, []DbTableRow{row}); err != nil {
+				err = errors.Wrap(err, fmt.Sprintf("Could not remove %s", row.Id))
+				return
+			}
+		}
+		return
+	})
+	return
+}
+
+func init() {
+	// Add remove command
+	rootCmd.AddCommand(removeCmd)
+
+	// Add flags to remove command
+	removeCmd.PersistentFlags().String("analysis", "", "comma-separated list of analyses to be removed (default all)")
+	removeCmd.PersistentFlags().String("id", "", "comma-separated list of gene or region ids")
+	removeCmd.PersistentFlags().String("tables", "", "comma-separated list of tables the regions are removed from")
+}
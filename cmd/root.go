@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/spf13/cobra"
@@ -9,20 +14,47 @@ import (
 
 var session Session
 
+// Set at build time with -ldflags "-X github.com/marrip/gene_list_svc/cmd.version=..."
+var version = "dev"
+
 func init() {
 	if err := env.Parse(&session); err != nil {
 		log.Fatalf("%v", err)
 	}
+
+	// Add annotation, liftover, concurrency, database, web and timeout flags to all commands
+	rootCmd.PersistentFlags().StringVar(&session.Annotation.Source, "annotation", session.Annotation.Source, "choose annotation source (ensembl, gtf)")
+	rootCmd.PersistentFlags().StringVar(&session.Liftover.Chain37To38, "chain-37-to-38", session.Liftover.Chain37To38, "UCSC chain file lifting GRCh37 regions to GRCh38")
+	rootCmd.PersistentFlags().StringVar(&session.Liftover.Chain38To37, "chain-38-to-37", session.Liftover.Chain38To37, "UCSC chain file lifting GRCh38 regions to GRCh37")
+	rootCmd.PersistentFlags().IntVar(&session.Concurrency, "concurrency", session.Concurrency, "number of regions resolved in parallel")
+	rootCmd.PersistentFlags().StringVar(&session.Db.Driver, "db", session.Db.Driver, "choose database backend (postgres, sqlite)")
+	rootCmd.PersistentFlags().DurationVar(&session.Db.Timeout, "db-timeout", session.Db.Timeout, "timeout of each database query, 0 disables it")
+	rootCmd.PersistentFlags().StringVar(&session.Annotation.Release, "ensembl-release", session.Annotation.Release, "pin the Ensembl release regions are expected to be resolved with")
+	rootCmd.PersistentFlags().BoolVar(&session.Web.Offline, "offline", session.Web.Offline, "serve Ensembl lookups from cache only and fail if they are missing")
+	rootCmd.PersistentFlags().DurationVar(&session.Web.Timeout, "http-timeout", session.Web.Timeout, "timeout of each web request, 0 disables it")
+	rootCmd.PersistentFlags().StringVar(&session.Annotation.ReleaseCheck, "release-check", session.Annotation.ReleaseCheck, "handle a release differing from the pinned one (warn, strict)")
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Cancel in-flight queries and requests on Ctrl-C so open transactions are rolled back
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		log.Fatalf("%v", err)
 	}
 }
 
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 var rootCmd = &cobra.Command{
-	Use:   "gene_list_svc",
-	Short: "Update gene lists and generate bed files",
-	Long:  `Update database with genetic regions in tsv files and generate bed files from specific tables`,
+	Use:     "gene_list_svc",
+	Version: version,
+	Short:   "Update gene lists and generate bed files",
+	Long:    `Update database with genetic regions in tsv files and generate bed files from specific tables`,
 }
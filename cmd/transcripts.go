@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// selectTranscripts keeps the exons of the transcripts chosen by the
+// transcript policy of the session and falls back to broader selections
+// when a gene lacks the requested transcript
+func (d DbTableRow) selectTranscripts(exons []EnsemblBaseObj) (selected []EnsemblBaseObj, err error) {
+	policy := session.Transcripts
+	if policy == "" || policy == "all" {
+		selected = exons
+		return
+	}
+	if policy == "pinned" {
+		pin, present := session.PinnedTranscripts[d.Id]
+		if !present {
+			pin, present = session.PinnedTranscripts[d.getBuildEnsemblId(session.Build)]
+		}
+		if present {
+			for _, exon := range exons {
+				if exon.Transcript == pin {
+					selected = append(selected, exon)
+				}
+			}
+			if len(selected) == 0 {
+				err = errors.New(fmt.Sprintf("Pinned transcript %s is not a transcript of %s in GRCh%s", pin, d.Id, session.Build))
+			}
+			return
+		}
+		log.Printf("No transcript pinned for %s, falling back to MANE Select", d.Id)
+		policy = "mane_select"
+	}
+	switch policy {
+	case "mane_select":
+		selected = filterExonsByTag(exons, "MANE_Select")
+	case "mane_plus_clinical":
+		selected = filterExonsByTag(exons, "MANE_Select", "MANE_Plus_Clinical")
+	}
+	if len(selected) > 0 {
+		return
+	} else if policy != "canonical" {
+		log.Printf("No MANE transcript of %s in GRCh%s, falling back to Ensembl canonical", d.Id, session.Build)
+	}
+	if selected = filterExonsByTag(exons, "Ensembl_canonical"); len(selected) > 0 {
+		return
+	}
+	log.Printf("No canonical transcript of %s stored for GRCh%s, using all transcripts", d.Id, session.Build)
+	selected = exons
+	return
+}
+
+func filterExonsByTag(exons []EnsemblBaseObj, tags ...string) (filtered []EnsemblBaseObj) {
+	for _, exon := range exons {
+		for _, tag := range tags {
+			if exon.hasTag(tag) {
+				filtered = append(filtered, exon)
+				break
+			}
+		}
+	}
+	return
+}
+
+func (o EnsemblBaseObj) hasTag(tag string) bool {
+	for _, t := range o.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func loadPinnedTranscripts(path string) (pins map[string]string, err error) {
+	tsv, err := readTsv(path)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not read pinned transcripts %s", path))
+		return
+	}
+	if len(tsv) == 0 {
+		err = errors.New(fmt.Sprintf("File %s is empty", path))
+		return
+	}
+	idColumn, transcriptColumn := -1, -1
+	for i, column := range tsv[0] {
+		switch column {
+		case "id":
+			idColumn = i
+		case "transcript":
+			transcriptColumn = i
+		}
+	}
+	if idColumn < 0 || transcriptColumn < 0 {
+		err = errors.New(fmt.Sprintf("File %s needs the columns id and transcript", path))
+		return
+	}
+	parsed := make(map[string]string)
+	for i, row := range tsv[1:] {
+		if len(row) != len(tsv[0]) {
+			err = errors.New(fmt.Sprintf("Header and row length are differing for line %d of %s", i+2, path))
+			return
+		}
+		id := strings.TrimSpace(row[idColumn])
+		if previous, present := parsed[id]; present {
+			err = errors.New(fmt.Sprintf("%s is pinned to %s and %s in %s", id, previous, row[transcriptColumn], path))
+			return
+		}
+		parsed[id] = versionRegex.ReplaceAllString(strings.TrimSpace(row[transcriptColumn]), "$1")
+	}
+	pins = parsed
+	return
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestSelectTranscripts(t *testing.T) {
+	mane := EnsemblBaseObj{EnsemblId: "ENSE0001", Tags: []string{"Ensembl_canonical", "MANE_Select"}, Transcript: "ENST0001"}
+	clinical := EnsemblBaseObj{EnsemblId: "ENSE0002", Tags: []string{"MANE_Plus_Clinical"}, Transcript: "ENST0002"}
+	rare := EnsemblBaseObj{EnsemblId: "ENSE0003", Transcript: "ENST0003"}
+	canonical := EnsemblBaseObj{EnsemblId: "ENSE0004", Tags: []string{"Ensembl_canonical"}, Transcript: "ENST0004"}
+	var cases = map[string]struct {
+		policy  string
+		pinned  map[string]string
+		exons   []EnsemblBaseObj
+		result  []EnsemblBaseObj
+		wantErr bool
+	}{
+		"All transcripts": {
+			"all",
+			nil,
+			[]EnsemblBaseObj{mane, clinical, rare},
+			[]EnsemblBaseObj{mane, clinical, rare},
+			false,
+		},
+		"Canonical transcript": {
+			"canonical",
+			nil,
+			[]EnsemblBaseObj{mane, clinical, rare},
+			[]EnsemblBaseObj{mane},
+			false,
+		},
+		"MANE Select": {
+			"mane_select",
+			nil,
+			[]EnsemblBaseObj{clinical, mane, rare},
+			[]EnsemblBaseObj{mane},
+			false,
+		},
+		"MANE Plus Clinical includes MANE Select": {
+			"mane_plus_clinical",
+			nil,
+			[]EnsemblBaseObj{mane, clinical, rare},
+			[]EnsemblBaseObj{mane, clinical},
+			false,
+		},
+		"MANE Select falls back to canonical": {
+			"mane_select",
+			nil,
+			[]EnsemblBaseObj{rare, canonical},
+			[]EnsemblBaseObj{canonical},
+			false,
+		},
+		"Untagged transcripts fall back to all": {
+			"canonical",
+			nil,
+			[]EnsemblBaseObj{rare},
+			[]EnsemblBaseObj{rare},
+			false,
+		},
+		"Pinned transcript": {
+			"pinned",
+			map[string]string{"GENE1": "ENST0003"},
+			[]EnsemblBaseObj{mane, clinical, rare},
+			[]EnsemblBaseObj{rare},
+			false,
+		},
+		"Pinned by Ensembl id": {
+			"pinned",
+			map[string]string{"ENSG0001": "ENST0002"},
+			[]EnsemblBaseObj{mane, clinical, rare},
+			[]EnsemblBaseObj{clinical},
+			false,
+		},
+		"Gene without pin falls back to MANE Select": {
+			"pinned",
+			map[string]string{"GENE2": "ENST0003"},
+			[]EnsemblBaseObj{mane, clinical, rare},
+			[]EnsemblBaseObj{mane},
+			false,
+		},
+		"Pinned transcript does not belong to gene": {
+			"pinned",
+			map[string]string{"GENE1": "ENST0009"},
+			[]EnsemblBaseObj{mane, clinical, rare},
+			nil,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{
+				Build:             "38",
+				PinnedTranscripts: c.pinned,
+				Transcripts:       c.policy,
+			}
+			row := DbTableRow{Class: "gene", EnsemblId38: "ENSG0001", Id: "GENE1"}
+			result, err := row.selectTranscripts(c.exons)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestLoadPinnedTranscripts(t *testing.T) {
+	var cases = map[string]struct {
+		content string
+		result  map[string]string
+		wantErr bool
+	}{
+		"Versions are removed": {
+			"id\ttranscript\nTP53\tENST00000269305.9\nKMT2A\tENST00000534358\n",
+			map[string]string{"KMT2A": "ENST00000534358", "TP53": "ENST00000269305"},
+			false,
+		},
+		"Missing transcript column": {
+			"id\tcomment\nTP53\tENST00000269305\n",
+			nil,
+			true,
+		},
+		"Gene pinned twice": {
+			"id\ttranscript\nTP53\tENST00000269305\nTP53\tENST00000445888\n",
+			nil,
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pinned.tsv")
+			if err := os.WriteFile(path, []byte(c.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			result, err := loadPinnedTranscripts(path)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/pkg/errors"
@@ -25,19 +26,91 @@ func readTsv(path string) (data [][]string, err error) {
 }
 
 func writeTsv(path string, data [][]string) (err error) {
-	tsvFile, err := os.Create(path)
-	if err != nil {
-		err = errors.Wrap(err, fmt.Sprintf("Could not create bed file %s", path))
-		return
+	err = writeBed(path, nil, data)
+	return
+}
+
+// writeBed writes header as comment lines in front of the tab separated data
+func writeBed(path string, header []string, data [][]string) (err error) {
+	err = writeIntervals(path, commentLines(header), data, false, false)
+	return
+}
+
+// writeIntervals writes header lines unchanged in front of the tab separated
+// data to path or to stdout for "-". Compressed output is written as BGZF and
+// indexed with tabix if index is set.
+func writeIntervals(path string, header []string, data [][]string, compress bool, index bool) (err error) {
+	var output io.Writer = os.Stdout
+	if path != "-" {
+		var file *os.File
+		if file, err = os.Create(path); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not create file %s", path))
+			return
+		}
+		defer file.Close()
+		output = file
+	}
+	var bgzf *bgzfWriter
+	if compress {
+		bgzf = newBgzfWriter(output)
+		output = bgzf
 	}
-	defer tsvFile.Close()
-	tsv := csv.NewWriter(tsvFile)
+	for _, line := range header {
+		if _, err = fmt.Fprintln(output, line); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not write to file %s", path))
+			return
+		}
+	}
+	tsv := csv.NewWriter(output)
 	tsv.Comma = '\t'
-	defer tsv.Flush()
-	err = tsv.WriteAll(data)
-	if err != nil {
+	var tbi *tabixIndex
+	if index {
+		tbi = newTabixIndex()
+	}
+	for _, line := range data {
+		var begin uint64
+		if bgzf != nil {
+			begin = bgzf.virtualOffset()
+		}
+		if err = tsv.Write(line); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not write to file %s", path))
+			return
+		}
+		if tbi == nil {
+			continue
+		}
+		// Offsets are only known once the line has reached the compressor
+		tsv.Flush()
+		if err = tsv.Error(); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not write to file %s", path))
+			return
+		}
+		if err = tbi.add(line, begin, bgzf.virtualOffset()); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not index file %s", path))
+			return
+		}
+	}
+	tsv.Flush()
+	if err = tsv.Error(); err != nil {
 		err = errors.Wrap(err, fmt.Sprintf("Could not write to file %s", path))
 		return
 	}
+	if bgzf != nil {
+		if err = bgzf.Close(); err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("Could not write to file %s", path))
+			return
+		}
+	}
+	if tbi != nil {
+		err = tbi.write(fmt.Sprintf("%s.tbi", path))
+	}
+	return
+}
+
+func printTsv(data [][]string) (err error) {
+	tsv := csv.NewWriter(os.Stdout)
+	tsv.Comma = '\t'
+	defer tsv.Flush()
+	err = tsv.WriteAll(data)
 	return
 }
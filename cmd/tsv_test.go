@@ -3,6 +3,7 @@ package cmd
 import (
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/go-test/deep"
@@ -95,3 +96,69 @@ func TestWriteTsv(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteBed(t *testing.T) {
+	var cases = map[string]struct {
+		header []string
+		data   [][]string
+		result string
+	}{
+		"Header is written as comments": {
+			[]string{"build: GRCh38", "ensembl_release: 110"},
+			[][]string{{"chr1", "100", "200", "GENE1"}},
+			"# build: GRCh38\n# ensembl_release: 110\nchr1\t100\t200\tGENE1\n",
+		},
+		"No header": {
+			nil,
+			[][]string{{"chr1", "100", "200", "GENE1"}},
+			"chr1\t100\t200\tGENE1\n",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.bed")
+			err := writeBed(path, c.header, c.data)
+			checkError(t, err, false)
+			result, err := os.ReadFile(path)
+			checkError(t, err, false)
+			if diff := deep.Equal(string(result), c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestFilterAnalysis(t *testing.T) {
+	rows := []DbTableRow{
+		{Analyses: map[string]struct{}{"cnv": {}, "snv": {}}, Id: "GENE1"},
+		{Analyses: map[string]struct{}{"snv": {}}, Id: "GENE2"},
+	}
+	var cases = map[string]struct {
+		analysis string
+		result   []string
+	}{
+		"Rows of several analyses are shared": {
+			"cnv",
+			[]string{"GENE1"},
+		},
+		"All rows of analysis are selected": {
+			"snv",
+			[]string{"GENE1", "GENE2"},
+		},
+		"Analysis without rows": {
+			"sv",
+			nil,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var result []string
+			for _, row := range filterAnalysis(rows, c.analysis) {
+				result = append(result, row.Id)
+			}
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"regexp"
@@ -12,27 +13,107 @@ import (
 
 var missingEnsemblIds []DbTableRow
 
-func tsvToDb() (err error) {
+func tsvToDb(ctx context.Context) (err error) {
 	tsv, err := readTsv(session.Tsv)
 	if err != nil {
 		err = errors.Wrap(err, fmt.Sprintf("Could not read file %s", session.Tsv))
 		return
 	}
-	var header []string
-	for i, row := range tsv {
-		if i == 0 {
-			if err = validateTsvHeader(row); err != nil {
-				return
+	if len(tsv) == 0 {
+		err = errors.New(fmt.Sprintf("File %s is empty", session.Tsv))
+		return
+	}
+	header := tsv[0]
+	if err = validateTsvHeader(header); err != nil {
+		return
+	}
+	if err = session.setSource(session.Tsv); err != nil {
+		return
+	}
+	missingEnsemblIds = nil
+	if session.AllowPartial {
+		var dbRows []DbTableRow
+		for _, row := range tsv[1:] {
+			var dbRow DbTableRow
+			if dbRow, err = rowToDbRow(row, header); err != nil {
+				log.Printf("%v", err)
+				continue
 			}
-			header = row
-		} else {
-			if err = addRowToDb(row, header); err != nil {
+			if err = dbRow.normalizeSymbol(); err != nil {
+				log.Printf("%v", err)
+				continue
+			}
+			dbRows = append(dbRows, dbRow)
+		}
+		if err = resolveNewRows(ctx, dbRows); err != nil {
+			log.Printf("Could not resolve regions in bulk, looking them up one by one: %v", err)
+		}
+		resolved, errs := resolveAllRows(ctx, dbRows)
+		for i, dbRow := range dbRows {
+			if errs[i] != nil {
+				log.Printf("Could not resolve %s: %v", dbRow.Id, errs[i])
+				continue
+			}
+			if err = dbRow.addToDb(ctx, resolved[i]); err != nil {
 				log.Printf("%v", err)
 			}
 		}
+		err = nil
+		if len(missingEnsemblIds) > 0 {
+			log.Printf("The following ids were not found and excluded: %s. Double check spelling or consider classing them as regions", getMissingEnsemblIds())
+		}
+		return
 	}
-	if len(missingEnsemblIds) > 0 {
-		log.Printf("The following ids were not found and excluded: %s. Double check spelling or consider classing them as regions", getMissingEnsemblIds())
+	dbRows, err := validateRows(tsv[1:], header)
+	if err != nil {
+		return
+	}
+	if err = resolveNewRows(ctx, dbRows); err != nil {
+		return
+	}
+	resolved, errs := resolveAllRows(ctx, dbRows)
+	err = collectErrors(errs, func(i int) string {
+		return fmt.Sprintf("line %d (%s)", i+2, dbRows[i].Id)
+	})
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("Could not resolve regions of %s, nothing was added", session.Tsv))
+		return
+	}
+	err = inTransaction(ctx, func() (err error) {
+		for i, dbRow := range dbRows {
+			if err = dbRow.addToDb(ctx, resolved[i]); err != nil {
+				err = errors.Wrap(err, fmt.Sprintf("Could not add line %d (%s)", i+2, dbRow.Id))
+				return
+			}
+		}
+		if len(missingEnsemblIds) > 0 {
+			err = errors.New(fmt.Sprintf("The following ids were not found: %s. Double check spelling, consider classing them as regions or use --allow-partial", getMissingEnsemblIds()))
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	log.Printf("All %d rows of %s were added to database %s.", len(dbRows), session.Tsv, session.Db.Name)
+	return
+}
+
+func validateRows(rows [][]string, header []string) (dbRows []DbTableRow, err error) {
+	var messages []string
+	for i, row := range rows {
+		var dbRow DbTableRow
+		if dbRow, err = rowToDbRow(row, header); err == nil {
+			err = dbRow.normalizeSymbol()
+		}
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("line %d: %v", i+2, err))
+			continue
+		}
+		dbRows = append(dbRows, dbRow)
+	}
+	err = nil
+	if len(messages) > 0 {
+		err = errors.New(fmt.Sprintf("Found %d invalid rows in %s, nothing was added:\n%s", len(messages), session.Tsv, strings.Join(messages, "\n")))
 	}
 	return
 }
@@ -62,29 +143,93 @@ func validateTsvHeader(header []string) (err error) {
 	return
 }
 
-func addRowToDb(row []string, header []string) (err error) {
+func rowToDbRow(row []string, header []string) (dbRow DbTableRow, err error) {
 	var mpRow map[string]string
 	mpRow, err = rowToMap(row, header)
 	if err != nil {
 		return
 	}
-	var dbRow DbTableRow
 	dbRow, err = mapToDbRow(mpRow)
-	if err != nil {
+	return
+}
+
+// resolveAllRows resolves the rows concurrently, keeping the order of the input
+func resolveAllRows(ctx context.Context, rows []DbTableRow) (resolved [][]DbTableRow, errs []error) {
+	resolved = make([][]DbTableRow, len(rows))
+	errs = forEachConcurrently(ctx, len(rows), func(i int) (err error) {
+		resolved[i], err = rows[i].resolveRows(ctx)
+		return
+	})
+	return
+}
+
+// resolveRows expands partners and looks up regions missing in the database.
+// It only reads from the database and may therefore run concurrently.
+func (d DbTableRow) resolveRows(ctx context.Context) (rows []DbTableRow, err error) {
+	rows = []DbTableRow{d}
+	if d.IncludePartners {
+		if rows, err = d.getPartners(ctx); err != nil {
+			return
+		}
+		for i := range rows {
+			if err = rows[i].normalizeSymbol(); err != nil {
+				return
+			}
+		}
+	}
+	if d.Action == "remove" {
 		return
 	}
-	for _, table := range dbRow.Tables {
-		table = strings.ToLower(table)
-		if err = ensureTableExists(table); err != nil {
+	for i := range rows {
+		row := &rows[i]
+		// Rows resolved in bulk beforehand already carry their coordinates
+		if row.Coordinates != nil || session.Db.Connection.checkRegionExists(ctx, *row) {
+			continue
+		}
+		if err = row.getEnsemblIds(ctx); err != nil {
 			return
 		}
-		if err = dbRow.checkAndAddRow(table); err != nil {
+		if row.Class != "region" && row.EnsemblId37 == "" && row.EnsemblId38 == "" {
+			continue
+		}
+		if err = row.resolveCoordinates(ctx); err != nil {
 			return
 		}
 	}
 	return
 }
 
+func (d DbTableRow) addToDb(ctx context.Context, rows []DbTableRow) (err error) {
+	if d.Action == "remove" {
+		err = d.removeFromDb(ctx, rows)
+		return
+	}
+	for _, list := range d.Tables {
+		if err = ensureListExists(ctx, list); err != nil {
+			return
+		}
+		if err = addRows(ctx, list, rows); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (d DbTableRow) removeFromDb(ctx context.Context, rows []DbTableRow) (err error) {
+	for _, list := range d.Tables {
+		if !session.Db.Connection.checkListExists(ctx, list) {
+			err = errors.New(fmt.Sprintf("list %s is not present in database", list))
+			return
+		}
+		for _, row := range rows {
+			if err = session.Db.Connection.removeRow(ctx, list, row); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
 func rowToMap(row []string, header []string) (result map[string]string, err error) {
 	if len(row) != len(header) {
 		err = errors.New(fmt.Sprintf("Header and row length are differing for row: %s", strings.Join(row, " ")))
@@ -98,6 +243,9 @@ func rowToMap(row []string, header []string) (result map[string]string, err erro
 }
 
 func mapToDbRow(row map[string]string) (dbRow DbTableRow, err error) {
+	if err = dbRow.validateAction(strings.ToLower(strings.TrimSpace(row["action"]))); err != nil {
+		return
+	}
 	if err = dbRow.validateAnalyses(strings.ToLower(row["analyses"])); err != nil {
 		return
 	}
@@ -107,11 +255,28 @@ func mapToDbRow(row map[string]string) (dbRow DbTableRow, err error) {
 	if err = dbRow.validateCoordinates(row["coordinates"]); err != nil {
 		return
 	}
+	if err = dbRow.validateBuild(strings.TrimSpace(row["build"])); err != nil {
+		return
+	}
 	dbRow.Id = row["id"]
 	if err = dbRow.validateIncludePartners(row["include_partners"]); err != nil {
 		return
 	}
-	dbRow.Tables = strings.Split(row["tables"], ",")
+	if err = dbRow.validateTables(row["tables"]); err != nil {
+		return
+	}
+	return
+}
+
+func (d *DbTableRow) validateAction(action string) (err error) {
+	if action == "" {
+		action = "add"
+	}
+	if _, valid := actions[action]; !valid {
+		err = errors.New(fmt.Sprintf("%s is not a valid action (add, remove)", action))
+	} else {
+		d.Action = action
+	}
 	return
 }
 
@@ -128,6 +293,17 @@ func (d *DbTableRow) validateAnalyses(anString string) (err error) {
 	return
 }
 
+func (d *DbTableRow) validateTables(tables string) (err error) {
+	for _, list := range strings.Split(tables, ",") {
+		list = strings.ToLower(strings.TrimSpace(list))
+		if err = validateListName(list); err != nil {
+			return
+		}
+		d.Tables = append(d.Tables, list)
+	}
+	return
+}
+
 func (d *DbTableRow) validateClass(class string) (err error) {
 	if _, valid := classes[class]; !valid {
 		err = errors.New(fmt.Sprintf("%s is not a valid class", class))
@@ -156,6 +332,21 @@ func (d *DbTableRow) validateCoordinates(coordinates string) (err error) {
 	return
 }
 
+func (d *DbTableRow) validateBuild(build string) (err error) {
+	if build == "" || d.Class != "region" {
+		return
+	}
+	build = strings.TrimPrefix(strings.ToLower(build), "grch")
+	for _, valid := range builds {
+		if build == valid {
+			d.Build = build
+			return
+		}
+	}
+	err = errors.New(fmt.Sprintf("%s is not a valid build (37, 38)", build))
+	return
+}
+
 func split(r rune) bool {
 	return r == ':' || r == '-'
 }
@@ -199,31 +390,20 @@ func (d *DbTableRow) validateIncludePartners(include string) (err error) {
 	return
 }
 
-func (d DbTableRow) checkAndAddRow(table string) (err error) {
-	rows := []DbTableRow{d}
-	if d.IncludePartners {
-		rows, err = d.getPartners()
-		if err != nil {
-			return
-		}
-	}
+func addRows(ctx context.Context, list string, rows []DbTableRow) (err error) {
 	for _, row := range rows {
-		if session.Db.Connection.checkRegionExists(table, row) {
-			if err = session.Db.Connection.updateRow(table, row); err != nil {
-				return
-			}
-		} else {
-			if err = row.getEnsemblIds(); err != nil {
-				return
-			}
+		if !session.Db.Connection.checkRegionExists(ctx, row) {
 			if row.Class != "region" && row.EnsemblId37 == "" && row.EnsemblId38 == "" {
 				missingEnsemblIds = append(missingEnsemblIds, row)
 				continue
 			}
-			if err = session.Db.Connection.addNewRow(table, row); err != nil {
+			if err = session.Db.Connection.addNewRow(ctx, row); err != nil {
 				return
 			}
 		}
+		if err = session.Db.Connection.updateRow(ctx, list, row); err != nil {
+			return
+		}
 	}
 	return
 }
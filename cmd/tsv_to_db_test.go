@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/go-test/deep"
+	"github.com/jarcoal/httpmock"
 )
 
 func TestValidateTsvHeader(t *testing.T) {
@@ -122,6 +126,7 @@ func TestMapToDbRow(t *testing.T) {
 				"tables":           "my_list",
 			},
 			DbTableRow{
+				Action: "add",
 				Analyses: map[string]struct{}{
 					"snv": struct{}{},
 					"sv":  struct{}{},
@@ -145,6 +150,7 @@ func TestMapToDbRow(t *testing.T) {
 				"tables":           "my_list",
 			},
 			DbTableRow{
+				Action: "add",
 				Analyses: map[string]struct{}{
 					"snv": struct{}{},
 				},
@@ -165,6 +171,7 @@ func TestMapToDbRow(t *testing.T) {
 				"analyses": "tsv",
 			},
 			DbTableRow{
+				Action:   "add",
 				Analyses: map[string]struct{}{},
 			},
 			true,
@@ -175,6 +182,7 @@ func TestMapToDbRow(t *testing.T) {
 				"class":    "nonesense",
 			},
 			DbTableRow{
+				Action: "add",
 				Analyses: map[string]struct{}{
 					"sv": struct{}{},
 				},
@@ -188,6 +196,7 @@ func TestMapToDbRow(t *testing.T) {
 				"coordinates": "300:1-99",
 			},
 			DbTableRow{
+				Action: "add",
 				Analyses: map[string]struct{}{
 					"sv": struct{}{},
 				},
@@ -195,6 +204,74 @@ func TestMapToDbRow(t *testing.T) {
 			},
 			true,
 		},
+		"Table name is invalid": {
+			map[string]string{
+				"analyses":         "snv",
+				"class":            "gene",
+				"id":               "RUNX1",
+				"include_partners": "false",
+				"tables":           `aml"; DROP TABLE "all`,
+			},
+			DbTableRow{
+				Action: "add",
+				Analyses: map[string]struct{}{
+					"snv": struct{}{},
+				},
+				Class: "gene",
+				Id:    "RUNX1",
+			},
+			true,
+		},
+		"Table names are normalized": {
+			map[string]string{
+				"analyses":         "snv",
+				"class":            "gene",
+				"id":               "RUNX1",
+				"include_partners": "false",
+				"tables":           "AML, all",
+			},
+			DbTableRow{
+				Action: "add",
+				Analyses: map[string]struct{}{
+					"snv": struct{}{},
+				},
+				Class: "gene",
+				Id:    "RUNX1",
+				Tables: []string{
+					"aml",
+					"all",
+				},
+			},
+			false,
+		},
+		"Region is removed": {
+			map[string]string{
+				"action":           "Remove",
+				"analyses":         "cnv",
+				"class":            "gene",
+				"id":               "RUNX1",
+				"include_partners": "false",
+				"tables":           "aml",
+			},
+			DbTableRow{
+				Action: "remove",
+				Analyses: map[string]struct{}{
+					"cnv": struct{}{},
+				},
+				Class:  "gene",
+				Id:     "RUNX1",
+				Tables: []string{"aml"},
+			},
+			false,
+		},
+		"Action does not exist": {
+			map[string]string{
+				"action":   "retire",
+				"analyses": "cnv",
+			},
+			DbTableRow{},
+			true,
+		},
 		"Analyses do not allow include partners": {
 			map[string]string{
 				"analyses":         "snv",
@@ -203,6 +280,7 @@ func TestMapToDbRow(t *testing.T) {
 				"tables":           "test",
 			},
 			DbTableRow{
+				Action: "add",
 				Analyses: map[string]struct{}{
 					"snv": struct{}{},
 				},
@@ -361,6 +439,49 @@ func TestValidateCoordinates(t *testing.T) {
 	}
 }
 
+func TestValidateBuild(t *testing.T) {
+	var cases = map[string]struct {
+		dbTableRow DbTableRow
+		build      string
+		result     DbTableRow
+		wantErr    bool
+	}{
+		"Build of region": {
+			DbTableRow{Class: "region"},
+			"GRCh37",
+			DbTableRow{Build: "37", Class: "region"},
+			false,
+		},
+		"Build is optional": {
+			DbTableRow{Class: "region"},
+			"",
+			DbTableRow{Class: "region"},
+			false,
+		},
+		"Build is ignored for genes": {
+			DbTableRow{Class: "gene"},
+			"37",
+			DbTableRow{Class: "gene"},
+			false,
+		},
+		"Build is invalid": {
+			DbTableRow{Class: "region"},
+			"19",
+			DbTableRow{Class: "region"},
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := c.dbTableRow.validateBuild(c.build)
+			checkError(t, err, c.wantErr)
+			if diff := deep.Equal(c.dbTableRow, c.result); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
 func TestValidateChromosome(t *testing.T) {
 	var cases = map[string]struct {
 		dbTableRow DbTableRow
@@ -511,3 +632,75 @@ func TestValidateIncludePartners(t *testing.T) {
 		})
 	}
 }
+
+func TestTsvToDb(t *testing.T) {
+	var cases = map[string]struct {
+		tsv          string
+		allowPartial bool
+		result       []string
+		wantErr      bool
+	}{
+		"All rows are valid": {
+			"id\tclass\tanalyses\ttables\tinclude_partners\tcoordinates\nREGION1\tregion\tsnv\taml\tfalse\tchr1:100-200\nREGION2\tregion\tsnv\taml\tfalse\tchr2:100-200\n",
+			false,
+			[]string{"REGION1", "REGION2"},
+			false,
+		},
+		"Invalid row rolls back everything": {
+			"id\tclass\tanalyses\ttables\tinclude_partners\tcoordinates\nREGION1\tregion\tsnv\taml\tfalse\tchr1:100-200\nREGION2\tregion\tsnv\taml\tfalse\tchr99:100-200\n",
+			false,
+			nil,
+			true,
+		},
+		"Unresolvable row rolls back everything": {
+			"id\tclass\tanalyses\ttables\tinclude_partners\tcoordinates\nREGION1\tregion\tsnv\taml\tfalse\tchr1:100-200\nGENE9\tgene\tsnv\taml\tfalse\t\n",
+			false,
+			nil,
+			true,
+		},
+		"Genes are resolved in bulk": {
+			"id\tclass\tanalyses\ttables\tinclude_partners\tcoordinates\nREGION1\tregion\tsnv\taml\tfalse\tchr1:100-200\nGENE1\tgene\tsnv\taml\tfalse\t\nGENE2\tgene\tsnv\taml\tfalse\t\n",
+			false,
+			[]string{"GENE1", "GENE2", "REGION1"},
+			false,
+		},
+		"Invalid row is skipped in partial mode": {
+			"id\tclass\tanalyses\ttables\tinclude_partners\tcoordinates\nREGION1\tregion\tsnv\taml\tfalse\tchr1:100-200\nREGION2\tregion\tsnv\taml\tfalse\tchr99:100-200\nGENE9\tgene\tsnv\taml\tfalse\t\n",
+			true,
+			[]string{"REGION1"},
+			false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+			httpmock.RegisterResponder("GET", "/xrefs/symbol/homo_sapiens/GENE9?content-type=application/json",
+				httpmock.NewStringResponder(200, `[]`))
+			httpmock.RegisterResponder("POST", "/lookup/symbol/homo_sapiens?content-type=application/json",
+				httpmock.NewStringResponder(200, `{"GENE1": {"id": "ENSG0001", "seq_region_name": "1"}, "GENE2": {"id": "ENSG0002", "seq_region_name": "2"}}`))
+			httpmock.RegisterResponder("POST", "/lookup/id?content-type=application/json",
+				httpmock.NewStringResponder(200, `{"ENSG0001": {"id": "ENSG0001", "seq_region_name": "1", "start": 100, "end": 200, "Transcript": [{"id": "ENST0001", "Exon": [{"id": "ENSE0001", "seq_region_name": "1", "start": 100, "end": 150}]}]}, "ENSG0002": {"id": "ENSG0002", "seq_region_name": "2", "start": 300, "end": 400}}`))
+			getSqliteDb(t, true)
+			session.AllowPartial = c.allowPartial
+			session.Tsv = filepath.Join(t.TempDir(), "list.tsv")
+			if err := os.WriteFile(session.Tsv, []byte(c.tsv), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := tsvToDb(context.Background())
+			checkError(t, err, c.wantErr)
+			var result []string
+			session.Tables = []string{"aml"}
+			regions, _ := session.Db.Connection.getRegions(context.Background(), []string{"snv"})
+			for _, region := range regions {
+				result = append(result, region.Id)
+			}
+			if diff := deep.Equal(result, c.result); diff != nil {
+				t.Error(diff)
+			}
+			if calls := httpmock.GetCallCountInfo()["POST /lookup/id?content-type=application/json"]; calls > len(builds) {
+				t.Errorf("Expected at most one batch lookup per build, got %d", calls)
+			}
+		})
+	}
+}
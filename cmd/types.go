@@ -1,54 +1,158 @@
 package cmd
 
 import (
+	"context"
 	"database/sql"
+	"time"
 )
 
 type Session struct {
-	Db       database
-	Web      web
-	Analysis string
-	Bed      string
-	Build    string
-	Chr      bool
-	Tables   []string
-	Tsv      string
+	Annotation         annotation
+	Db                 database
+	Liftover           liftover
+	Web                web
+	AllowPartial       bool
+	Analysis           string
+	Bed                string
+	Bgzip              bool
+	Build              string
+	Chr                bool
+	Concurrency        int `env:"CONCURRENCY" envDefault:"4"`
+	ExonMode           string
+	Format             string
+	Padding            map[string]int
+	PaddingRules       string `env:"PADDING"`
+	PinnedTranscripts  map[string]string
+	ProvenanceHeader   bool
+	Releases           []Release
+	ResolveMissing     bool
+	SequenceDictionary string
+	Source             source
+	Tables             []string
+	Targets            []Target
+	Transcripts        string
+	Tsv                string
+	User               string `env:"GENE_LIST_USER"`
+}
+
+type annotation struct {
+	Backend      AnnotationSource
+	Gtf37        string `env:"GTF_37_PATH"`
+	Gtf38        string `env:"GTF_38_PATH"`
+	Hgnc         string `env:"HGNC_PATH"`
+	Release      string `env:"ENSEMBL_RELEASE"`
+	ReleaseCheck string `env:"ENSEMBL_RELEASE_CHECK" envDefault:"warn"`
+	Source       string `env:"ANNOTATION_SOURCE" envDefault:"ensembl"`
+	liveReleases map[string]string
+	symbols      *hgncIndex
+}
+
+type liftover struct {
+	Chain37To38 string `env:"CHAIN_37_TO_38_PATH"`
+	Chain38To37 string `env:"CHAIN_38_TO_37_PATH"`
+	chains      map[string]*chainIndex
+}
+
+type source struct {
+	Checksum string
+	File     string
 }
 
 type database struct {
-	Connection DbConnection
-	Host       string `env:"DB_HOST" envDefault:"localhost"`
-	Name       string `env:"DB_NAME" envDefault:"gene_list"`
-	Password   string `env:"DB_PASSWORD"`
-	Port       int    `env:"DB_PORT" envDefault:"5432"`
-	User       string `env:"DB_USER"`
+	Connection       DbConnection
+	Driver           string        `env:"DB_DRIVER" envDefault:"postgres"`
+	Host             string        `env:"DB_HOST" envDefault:"localhost"`
+	MigrationTimeout time.Duration `env:"DB_MIGRATION_TIMEOUT" envDefault:"5m"`
+	Name             string        `env:"DB_NAME" envDefault:"gene_list"`
+	Password         string        `env:"DB_PASSWORD"`
+	Path             string        `env:"DB_PATH" envDefault:"gene_list.db"`
+	Port             int           `env:"DB_PORT" envDefault:"5432"`
+	Timeout          time.Duration `env:"DB_TIMEOUT" envDefault:"30s"`
+	User             string        `env:"DB_USER"`
 }
 
+type AnnotationSource interface {
+	getFeature(ctx context.Context, build string, id string, expand bool) (feature Feature, err error)
+	getId(ctx context.Context, build string, class string, name string) (id string, err error)
+	getRelease(ctx context.Context, build string) (release string, err error)
+	lookupFeatures(ctx context.Context, build string, ids []string, expand bool) (features map[string]Feature, err error)
+	lookupSymbols(ctx context.Context, build string, symbols []string) (ids map[string]string, err error)
+}
+
+type ensemblSource struct{}
+
 type DbConnection interface {
-	addNewRow(table string, region DbTableRow) (err error)
-	checkRegionExists(table string, region DbTableRow) (exists bool)
-	checkTableExists(table string) (exists bool)
-	createTable(table string) (err error)
-	getRegions() (regions []DbTableRow, err error)
-	getTables() (tables map[string]struct{}, err error)
-	updateRow(table string, region DbTableRow) (err error)
+	addNewRow(ctx context.Context, region DbTableRow) (err error)
+	applyMigration(ctx context.Context, m migration, statements []string) (err error)
+	begin(ctx context.Context) (tx DbConnection, err error)
+	checkListExists(ctx context.Context, list string) (exists bool)
+	checkRegionExists(ctx context.Context, region DbTableRow) (exists bool)
+	checkReleaseExists(ctx context.Context, release Release) (exists bool, err error)
+	checkTableExists(ctx context.Context, table string) (exists bool)
+	commit() (err error)
+	createList(ctx context.Context, list string) (err error)
+	createMigrationTable(ctx context.Context) (err error)
+	createRelease(ctx context.Context, release Release, regions []DbTableRow, members map[string][]string) (err error)
+	getAppliedMigrations(ctx context.Context) (applied map[int]string, err error)
+	getConflictingRegions(ctx context.Context, tables []string) (ids []string, err error)
+	getDatabaseState(ctx context.Context) (state DatabaseState, err error)
+	getHistory(ctx context.Context, filter HistoryFilter) (entries []AuditEntry, err error)
+	getLegacyListTables(ctx context.Context) (tables map[string]struct{}, err error)
+	getListContent(ctx context.Context, list string) (regions []DbTableRow, members map[string][]string, err error)
+	getLists(ctx context.Context) (lists map[string]struct{}, err error)
+	getMigrations() []migration
+	getPaddingRules(ctx context.Context) (rules []PaddingRule, err error)
+	getRegions(ctx context.Context, analyses []string) (regions []DbTableRow, err error)
+	getReleasePadding(ctx context.Context, release Release) (rules []PaddingRule, err error)
+	getReleaseRegions(ctx context.Context, analyses []string) (regions []DbTableRow, err error)
+	getReleases(ctx context.Context) (releases []Release, err error)
+	getStoredRegions(ctx context.Context) (regions []DbTableRow, err error)
+	removePaddingRule(ctx context.Context, rule PaddingRule) (err error)
+	removeRow(ctx context.Context, list string, region DbTableRow) (err error)
+	replaceCoordinates(ctx context.Context, region DbTableRow) (err error)
+	rollback() (err error)
+	setPaddingRule(ctx context.Context, rule PaddingRule) (err error)
+	updateRow(ctx context.Context, list string, region DbTableRow) (err error)
 }
 
 type dbConnection struct {
 	db *sql.DB
+	tx *sql.Tx
+}
+
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type sqliteConnection struct {
+	dbConnection
 }
 
 type web struct {
-	AtlasGO   string `env:"ATLAS_ROOT_URL" envDefault:"http://atlasgeneticsoncology.org"`
-	Ensembl38 string `env:"ENSEMBL_38_REST_URL" envDefault:"https://rest.ensembl.org"`
-	Ensembl37 string `env:"ENSEMBL_37_REST_URL" envDefault:"https://grch37.rest.ensembl.org"`
+	AtlasGO    string        `env:"ATLAS_ROOT_URL" envDefault:"http://atlasgeneticsoncology.org"`
+	CacheDir   string        `env:"ENSEMBL_CACHE_DIR"`
+	CacheTTL   time.Duration `env:"ENSEMBL_CACHE_TTL" envDefault:"720h"`
+	Ensembl38  string        `env:"ENSEMBL_38_REST_URL" envDefault:"https://rest.ensembl.org"`
+	Ensembl37  string        `env:"ENSEMBL_37_REST_URL" envDefault:"https://grch37.rest.ensembl.org"`
+	Offline    bool          `env:"ENSEMBL_OFFLINE"`
+	Retries    int           `env:"HTTP_RETRIES" envDefault:"5"`
+	RetryDelay time.Duration `env:"HTTP_RETRY_DELAY" envDefault:"1s"`
+	Timeout    time.Duration `env:"HTTP_TIMEOUT" envDefault:"30s"`
+	releases   map[string]string
 }
 
 type DbTableRow struct {
+	Action          string
 	Analyses        map[string]struct{}
+	Build           string
+	Coordinates     map[string]EnsemblBaseObj
 	End             string
 	EnsemblId38     string
 	EnsemblId37     string
+	Exons           map[string][]EnsemblBaseObj
 	Chromosome      string
 	Class           string
 	Id              string
@@ -57,6 +161,11 @@ type DbTableRow struct {
 	Tables          []string
 }
 
+type Feature struct {
+	Exons  []EnsemblBaseObj
+	Region EnsemblBaseObj
+}
+
 type EnsemblGeneObj struct {
 	Chromosome  string            `json:"seq_region_name"`
 	EnsemblId   string            `json:"id"`
@@ -65,15 +174,68 @@ type EnsemblGeneObj struct {
 }
 
 type EnsemblTransObj struct {
-	EnsemblId string           `json:"id"`
-	Exons     []EnsemblBaseObj `json:"Exon"`
+	Biotype     string           `json:"biotype"`
+	Canonical   int              `json:"is_canonical"`
+	EnsemblId   string           `json:"id"`
+	Exons       []EnsemblBaseObj `json:"Exon"`
+	Mane        []EnsemblManeObj `json:"MANE"`
+	Translation *EnsemblBaseObj  `json:"Translation"`
+}
+
+type EnsemblManeObj struct {
+	Type string `json:"type"`
 }
 
 type EnsemblBaseObj struct {
-	Annotation string
-	Chromosome string `json:"seq_region_name"`
-	End        int    `json:"end"`
-	EnsemblId  string `json:"id"`
-	Start      int    `json:"start"`
-	Transcript string
+	Annotation  string   `json:"-"`
+	Biotype     string   `json:"-"`
+	Chromosome  string   `json:"seq_region_name"`
+	CodingEnd   int      `json:"-"`
+	CodingStart int      `json:"-"`
+	End         int      `json:"end"`
+	EnsemblId   string   `json:"id"`
+	Release     string   `json:"ensembl_release,omitempty"`
+	Start       int      `json:"start"`
+	Strand      int      `json:"strand,omitempty"`
+	Tags        []string `json:"-"`
+	Transcript  string   `json:"-"`
+}
+
+type AuditEntry struct {
+	Action         string
+	ChangedAt      time.Time
+	ChangedBy      string
+	List           string
+	NewValue       string
+	OldValue       string
+	RegionId       string
+	SourceChecksum string
+	SourceFile     string
+}
+
+type HistoryFilter struct {
+	List     string
+	RegionId string
+	Since    time.Time
+	Until    time.Time
+}
+
+type PaddingRule struct {
+	Analysis string `json:"analysis"`
+	Class    string `json:"class"`
+	List     string `json:"list,omitempty"`
+	Size     int    `json:"size"`
+}
+
+type Release struct {
+	CreatedAt time.Time
+	CreatedBy string
+	List      string
+	Notes     string
+	Version   string
+}
+
+type Target struct {
+	Analysis string
+	Build    string
 }
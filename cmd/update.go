@@ -10,17 +10,30 @@ import (
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Add genetic regions to database",
-	Long:  `Add genetic regions, specified in a tsv file, to corresponding list in database`,
+	Long:  `Add genetic regions, specified in a tsv file, to corresponding list in database. All rows are added in a single transaction unless --allow-partial is set`,
 	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
 		var err error
 		session.Tsv, err = cmd.Flags().GetString("tsv")
 		if err != nil {
 			log.Fatalf("%v", err)
 		}
-		if err = session.initDbConnection(); err != nil {
+		session.AllowPartial, err = cmd.Flags().GetBool("allow-partial")
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if session.Annotation.Hgnc != "" {
+			if session.Annotation.symbols, err = loadHgnc(session.Annotation.Hgnc); err != nil {
+				log.Fatalf("%v", err)
+			}
+		}
+		if err = session.initDbConnection(ctx); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err = checkSchemaVersion(ctx); err != nil {
 			log.Fatalf("%v", err)
 		}
-		if err = tsvToDb(); err != nil {
+		if err = tsvToDb(ctx); err != nil {
 			log.Fatalf("%v", err)
 		}
 	},
@@ -30,6 +43,8 @@ func init() {
 	// Add update command
 	rootCmd.AddCommand(updateCmd)
 
-	// Add tsv flag to update command
+	// Add flags to update command
+	updateCmd.PersistentFlags().Bool("allow-partial", false, "skip invalid or unresolvable rows instead of rolling back all changes")
+	updateCmd.PersistentFlags().StringVar(&session.Annotation.Hgnc, "hgnc", session.Annotation.Hgnc, "HGNC complete set file used to replace aliases and previous symbols")
 	updateCmd.PersistentFlags().String("tsv", "", "tsv containg list of genetic regions")
 }
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify bed file against its manifest",
+	Long:  `Confirm that the intervals of a file written by extract still match the checksum recorded in its manifest`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bed, err := cmd.Flags().GetString("bed")
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		manifestPath, err := cmd.Flags().GetString("manifest")
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if manifestPath == "" {
+			manifestPath = getManifestPath(bed)
+		}
+		manifest, err := verifyIntervals(bed, manifestPath)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		log.Printf("%s matches manifest %s (%d intervals, %s, created %s by %s).", bed, manifestPath, manifest.Intervals, manifest.Checksum, manifest.CreatedAt.Format("2006-01-02"), manifest.CreatedBy)
+	},
+}
+
+func init() {
+	// Add verify command
+	rootCmd.AddCommand(verifyCmd)
+
+	// Add flags to verify command
+	verifyCmd.PersistentFlags().String("bed", "", "bed file written by extract")
+	verifyCmd.PersistentFlags().String("manifest", "", `manifest of bed file (default "bed.manifest.json")`)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// forEachConcurrently calls work for every index below n on at most
+// session.Concurrency goroutines and returns the error of each index
+func forEachConcurrently(ctx context.Context, n int, work func(i int) error) (errs []error) {
+	errs = make([]error, n)
+	workers := session.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				errs[i] = work(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return
+}
+
+func collectErrors(errs []error, label func(i int) string) (err error) {
+	var messages []string
+	for i, e := range errs {
+		if e != nil {
+			messages = append(messages, fmt.Sprintf("%s: %v", label(i), e))
+		}
+	}
+	if len(messages) > 0 {
+		err = errors.New(fmt.Sprintf("%d of %d rows failed:\n%s", len(messages), len(errs), strings.Join(messages, "\n")))
+	}
+	return
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestForEachConcurrently(t *testing.T) {
+	var cases = map[string]struct {
+		concurrency int
+		n           int
+		failing     map[int]bool
+	}{
+		"Sequential": {
+			0,
+			5,
+			map[int]bool{},
+		},
+		"More workers than items": {
+			8,
+			3,
+			map[int]bool{1: true},
+		},
+		"Bounded pool": {
+			3,
+			20,
+			map[int]bool{0: true, 7: true, 19: true},
+		},
+		"No items": {
+			4,
+			0,
+			map[int]bool{},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			session = Session{
+				Concurrency: c.concurrency,
+			}
+			var running, peak int32
+			results := make([]int, c.n)
+			errs := forEachConcurrently(context.Background(), c.n, func(i int) (err error) {
+				current := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					max := atomic.LoadInt32(&peak)
+					if current <= max || atomic.CompareAndSwapInt32(&peak, max, current) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				if c.failing[i] {
+					err = errors.New(fmt.Sprintf("row %d failed", i))
+					return
+				}
+				results[i] = i * i
+				return
+			})
+			if len(errs) != c.n {
+				t.Fatalf("Expected %d errors, got %d", c.n, len(errs))
+			}
+			for i := 0; i < c.n; i++ {
+				if (errs[i] != nil) != c.failing[i] {
+					t.Errorf("Unexpected error for index %d: %v", i, errs[i])
+				}
+				if !c.failing[i] && results[i] != i*i {
+					t.Errorf("Expected result %d for index %d, got %d", i*i, i, results[i])
+				}
+			}
+			limit := int32(c.concurrency)
+			if limit < 1 {
+				limit = 1
+			}
+			if peak > limit {
+				t.Errorf("Expected at most %d concurrent workers, got %d", limit, peak)
+			}
+		})
+	}
+}
+
+func TestForEachConcurrentlyCancelled(t *testing.T) {
+	session = Session{
+		Concurrency: 2,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var calls int32
+	errs := forEachConcurrently(ctx, 10, func(i int) (err error) {
+		atomic.AddInt32(&calls, 1)
+		return
+	})
+	if calls != 0 {
+		t.Errorf("Expected no calls after cancellation, got %d", calls)
+	}
+	for i, err := range errs {
+		if err != context.Canceled {
+			t.Errorf("Expected index %d to be cancelled, got %v", i, err)
+		}
+	}
+}
+
+func TestCollectErrors(t *testing.T) {
+	var cases = map[string]struct {
+		errs    []error
+		result  string
+		wantErr bool
+	}{
+		"No errors": {
+			[]error{nil, nil},
+			"",
+			false,
+		},
+		"Errors are listed in order": {
+			[]error{errors.New("not found"), nil, errors.New("timeout")},
+			"2 of 3 rows failed:\nGENE0: not found\nGENE2: timeout",
+			true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := collectErrors(c.errs, func(i int) string {
+				return fmt.Sprintf("GENE%d", i)
+			})
+			checkError(t, err, c.wantErr)
+			if err != nil {
+				if diff := deep.Equal(err.Error(), c.result); diff != nil {
+					t.Error(diff)
+				}
+			}
+		})
+	}
+}